@@ -0,0 +1,302 @@
+package tfstate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// resourceInstanceAddress returns the absolute address of a resource instance, e.g. `module.a["x"].data.foo.bar[0]`.
+func resourceInstanceAddress(module string, mode tfjson.ResourceMode, typ, name string, index interface{}) string {
+	var buf strings.Builder
+	if module != "" {
+		buf.WriteString(module)
+		buf.WriteString(".")
+	}
+	if mode == tfjson.DataResourceMode {
+		buf.WriteString("data.")
+	}
+	buf.WriteString(typ)
+	buf.WriteString(".")
+	buf.WriteString(name)
+	buf.WriteString(indexKeyString(index))
+	return buf.String()
+}
+
+// indexKeyString returns the instance key part of an address, e.g. `[0]` or `["foo"]`, or an empty string for no key.
+func indexKeyString(index interface{}) string {
+	switch index := index.(type) {
+	case nil:
+		return ""
+	case string:
+		return "[" + quoteKey(index) + "]"
+	case float64:
+		return fmt.Sprintf("[%d]", int(index))
+	default:
+		return fmt.Sprintf("[%v]", index)
+	}
+}
+
+// quoteKey quotes the string key the same way as Terraform does in addresses.
+func quoteKey(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '$', '%':
+			buf.WriteByte(c)
+			if i+1 < len(s) && s[i+1] == '{' {
+				buf.WriteByte(c)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Address is the address of a module instance, a resource or a resource instance in the state, e.g.
+// `module.a["x"]`, `module.a["x"].aws_instance.foo` or `module.a["x"].aws_instance.foo[0]`.
+type Address struct {
+	// Module is the path of the module instance, which is empty for the root module.
+	Module []ModuleInstanceStep
+
+	// Mode, Type and Name identify the resource, which are all empty for a module address.
+	Mode tfjson.ResourceMode
+	Type string
+	Name string
+
+	// Key is the instance key of the resource instance, which is either an int (count), a string (for_each) or nil.
+	// A nil key addresses all instances of the resource, which is also the only instance of a resource using neither
+	// count nor for_each.
+	Key interface{}
+}
+
+// ModuleInstanceStep is a step of the module instance path.
+type ModuleInstanceStep struct {
+	Name string
+	// Key is the instance key of the module instance, which is either an int (count), a string (for_each) or nil.
+	Key interface{}
+}
+
+// ParseAddress parses the address of a module instance, a resource or a resource instance.
+func ParseAddress(s string) (Address, error) {
+	p := &addressParser{s: s}
+	addr, err := p.parse()
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid address %q: %v", s, err)
+	}
+	return addr, nil
+}
+
+// IsModule tells whether the address is a module instance address.
+func (a Address) IsModule() bool {
+	return a.Type == ""
+}
+
+// ModuleAddress returns the address of the module instance, e.g. `module.a["x"]`, or an empty string for the root module.
+func (a Address) ModuleAddress() string {
+	var buf strings.Builder
+	for i, step := range a.Module {
+		if i != 0 {
+			buf.WriteString(".")
+		}
+		buf.WriteString("module.")
+		buf.WriteString(step.Name)
+		buf.WriteString(indexKeyString(step.Key))
+	}
+	return buf.String()
+}
+
+// ResourceAddress returns the address of the resource that the address belongs to, i.e. without the instance key.
+func (a Address) ResourceAddress() Address {
+	a.Key = nil
+	return a
+}
+
+// ConfigAddress returns the address without any instance key, neither of the resource nor of the modules, which is
+// how the resources are referenced in the "depends_on" of the state, e.g. `module.a.aws_instance.foo`.
+func (a Address) ConfigAddress() string {
+	a.Key = nil
+	module := make([]ModuleInstanceStep, len(a.Module))
+	for i, step := range a.Module {
+		module[i] = ModuleInstanceStep{Name: step.Name}
+	}
+	a.Module = module
+	return a.String()
+}
+
+// String returns the address in the form used by Terraform.
+func (a Address) String() string {
+	if a.IsModule() {
+		return a.ModuleAddress()
+	}
+	return resourceInstanceAddress(a.ModuleAddress(), a.Mode, a.Type, a.Name, a.Key)
+}
+
+// Equal tells whether two addresses are the same, regardless of the Go types of the keys.
+func (a Address) Equal(o Address) bool {
+	return a.String() == o.String()
+}
+
+// ModuleContains tells whether the module instance of the address is the given module instance or one of its
+// descendants.
+func (a Address) ModuleContains(module []ModuleInstanceStep) bool {
+	if len(a.Module) < len(module) {
+		return false
+	}
+	for i, step := range module {
+		if a.Module[i].Name != step.Name || indexKeyString(a.Module[i].Key) != indexKeyString(step.Key) {
+			return false
+		}
+	}
+	return true
+}
+
+type addressParser struct {
+	s   string
+	pos int
+}
+
+func (p *addressParser) parse() (Address, error) {
+	var addr Address
+	for strings.HasPrefix(p.s[p.pos:], "module.") {
+		p.pos += len("module.")
+		name, err := p.ident()
+		if err != nil {
+			return addr, err
+		}
+		key, err := p.key()
+		if err != nil {
+			return addr, err
+		}
+		addr.Module = append(addr.Module, ModuleInstanceStep{Name: name, Key: key})
+		if p.pos == len(p.s) {
+			return addr, nil
+		}
+		if err := p.expect("."); err != nil {
+			return addr, err
+		}
+	}
+
+	addr.Mode = tfjson.ManagedResourceMode
+	if strings.HasPrefix(p.s[p.pos:], "data.") {
+		p.pos += len("data.")
+		addr.Mode = tfjson.DataResourceMode
+	}
+	var err error
+	if addr.Type, err = p.ident(); err != nil {
+		return addr, err
+	}
+	if err := p.expect("."); err != nil {
+		return addr, err
+	}
+	if addr.Name, err = p.ident(); err != nil {
+		return addr, err
+	}
+	if addr.Key, err = p.key(); err != nil {
+		return addr, err
+	}
+	if p.pos != len(p.s) {
+		return addr, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	return addr, nil
+}
+
+func (p *addressParser) expect(s string) error {
+	if !strings.HasPrefix(p.s[p.pos:], s) {
+		return fmt.Errorf("expect %q at position %d", s, p.pos)
+	}
+	p.pos += len(s)
+	return nil
+}
+
+func (p *addressParser) ident() (string, error) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9' && p.pos != start) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expect an identifier at position %d", start)
+	}
+	return p.s[start:p.pos], nil
+}
+
+// key parses the optional instance key, e.g. `[0]` or `["foo"]`.
+func (p *addressParser) key() (interface{}, error) {
+	if p.pos == len(p.s) || p.s[p.pos] != '[' {
+		return nil, nil
+	}
+	p.pos++
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		var buf strings.Builder
+		for p.pos++; p.pos < len(p.s); p.pos++ {
+			c := p.s[p.pos]
+			switch c {
+			case '"':
+				p.pos++
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+				return buf.String(), nil
+			case '\\':
+				p.pos++
+				if p.pos == len(p.s) {
+					return nil, fmt.Errorf("unterminated string key")
+				}
+				switch e := p.s[p.pos]; e {
+				case 'n':
+					buf.WriteByte('\n')
+				case 'r':
+					buf.WriteByte('\r')
+				case 't':
+					buf.WriteByte('\t')
+				default:
+					buf.WriteByte(e)
+				}
+			case '$', '%':
+				buf.WriteByte(c)
+				// "$${" and "%%{" are the escapes of the template sequences
+				if strings.HasPrefix(p.s[p.pos:], string([]byte{c, c, '{'})) {
+					p.pos++
+				}
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string key")
+	}
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("expect a number or a string key at position %d", start)
+	}
+	idx, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
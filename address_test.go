@@ -0,0 +1,75 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect tfstate.Address
+		config string
+		err    bool
+	}{
+		{
+			name:   "resource",
+			input:  "null_resource.foo",
+			expect: tfstate.Address{Mode: "managed", Type: "null_resource", Name: "foo"},
+			config: "null_resource.foo",
+		},
+		{
+			name:   "data source instance",
+			input:  "data.null_data_source.foo[1]",
+			expect: tfstate.Address{Mode: "data", Type: "null_data_source", Name: "foo", Key: 1},
+			config: "data.null_data_source.foo",
+		},
+		{
+			name:  "nested module resource instance",
+			input: `module.a["x"].module.b[0].null_resource.foo["k\"ey"]`,
+			expect: tfstate.Address{
+				Module: []tfstate.ModuleInstanceStep{{Name: "a", Key: "x"}, {Name: "b", Key: 0}},
+				Mode:   "managed", Type: "null_resource", Name: "foo", Key: `k"ey`,
+			},
+			config: "module.a.module.b.null_resource.foo",
+		},
+		{
+			name:   "module",
+			input:  `module.a["x"]`,
+			expect: tfstate.Address{Module: []tfstate.ModuleInstanceStep{{Name: "a", Key: "x"}}},
+			config: "module.a",
+		},
+		{
+			name:  "missing name",
+			input: "null_resource",
+			err:   true,
+		},
+		{
+			name:  "invalid key",
+			input: "null_resource.foo[x]",
+			err:   true,
+		},
+		{
+			name:  "trailing dot",
+			input: "module.a.",
+			err:   true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := tfstate.ParseAddress(tt.input)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, addr)
+			require.Equal(t, tt.input, addr.String())
+			require.Equal(t, tt.config, addr.ConfigAddress())
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package tfstate
+
+import (
+	"fmt"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// As decodes the value of the resource into a Go value of type T, via gocty.FromCtyValue, where T is typically a
+// struct generated by the codegen package.
+//
+// The struct must have a field (tagged by `cty:"..."`) for each attribute of the value. The null values can only be
+// decoded into pointers, slices or maps, except that the null sets are decoded as empty ones (as there is no
+// difference between the two in practice).
+func As[T any](res *StateResource) (T, error) {
+	var ret T
+	if res == nil {
+		return ret, fmt.Errorf("resource is nil")
+	}
+	if res.Value == cty.NilVal || res.Value.IsNull() {
+		return ret, fmt.Errorf("resource %q: value is null", res.Address)
+	}
+	val, err := cty.Transform(res.Value, func(_ cty.Path, v cty.Value) (cty.Value, error) {
+		if v.IsNull() && v.Type().IsSetType() {
+			return cty.SetValEmpty(v.Type().ElementType()), nil
+		}
+		return v, nil
+	})
+	if err != nil {
+		return ret, fmt.Errorf("resource %q: %v", res.Address, err)
+	}
+	if err := gocty.FromCtyValue(val, &ret); err != nil {
+		return ret, fmt.Errorf("resource %q: %v", res.Address, wrapPathError(err))
+	}
+	return ret, nil
+}
@@ -0,0 +1,63 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type randomPassword struct {
+	BcryptHash *string           `cty:"bcrypt_hash"`
+	ID         *string           `cty:"id"`
+	Keepers    map[string]string `cty:"keepers"`
+	Length     float64           `cty:"length"`
+	Result     *string           `cty:"result"`
+	Special    *bool             `cty:"special"`
+}
+
+func TestAs(t *testing.T) {
+	state, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), loadOpenTofuSchemas(t))
+	require.NoError(t, err)
+	res := stateResources(state)["random_password.this"]
+	require.NotNil(t, res)
+
+	pw, err := tfstate.As[randomPassword](res)
+	require.NoError(t, err)
+	require.Equal(t, float64(12), pw.Length)
+	require.NotNil(t, pw.Special)
+	require.True(t, *pw.Special)
+	require.Equal(t, "Xk3#p9!qLm2@", *pw.Result)
+
+	// The struct lacks an attribute of the value.
+	_, err = tfstate.As[struct {
+		ID *string `cty:"id"`
+	}](res)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported attribute")
+
+	// The null sets are decoded as empty slices, while the null primitives need pointers.
+	type server struct {
+		Name    string   `cty:"name"`
+		Subnets []string `cty:"subnets"`
+	}
+	res = &tfstate.StateResource{
+		Address: "demo_server.this",
+		Value: cty.ObjectVal(map[string]cty.Value{
+			"name":    cty.StringVal("a"),
+			"subnets": cty.NullVal(cty.Set(cty.String)),
+		}),
+	}
+	srv, err := tfstate.As[server](res)
+	require.NoError(t, err)
+	require.Equal(t, server{Name: "a", Subnets: []string{}}, srv)
+
+	res.Value = cty.ObjectVal(map[string]cty.Value{
+		"name":    cty.NullVal(cty.String),
+		"subnets": cty.SetValEmpty(cty.String),
+	})
+	_, err = tfstate.As[server](res)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ".name: null value is not allowed")
+}
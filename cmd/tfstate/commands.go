@@ -0,0 +1,587 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/codegen"
+	"github.com/magodo/tfstate/render"
+	"github.com/magodo/tfstate/secrets"
+	"github.com/magodo/tfstate/table"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+func runShow(e *env, args []string) error {
+	fs := newFlagSet(e, "show", "<state> [address...]",
+		"Show the resources and outputs in the human readable format, with the sensitive values redacted.\n"+
+			"Only the resources matching any of the addresses are shown if specified, without the outputs.")
+	in := addInputFlags(fs)
+	color := fs.Bool("color", false, "Enable the colored output")
+	width := fs.Int("width", 0, "The maximum line width, within which the collections of primitive values are rendered inline")
+	noOutputs := fs.Bool("no-outputs", false, "Omit the outputs")
+	ignorePath := addIgnoreFlag(fs)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	rules, err := loadIgnoreRules(*ignorePath)
+	if err != nil {
+		return err
+	}
+	state, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := render.Options{
+		Schemas:   schemas,
+		Width:     *width,
+		Color:     *color,
+		NoOutputs: *noOutputs,
+		Ignore:    rules,
+	}
+	if fs.NArg() > 1 {
+		if opts.Filter, err = render.FilterAddresses(fs.Args()[1:]...); err != nil {
+			return usageErrorf("%v", err)
+		}
+		opts.NoOutputs = true
+	}
+	out, err := render.State(state, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(e.stdout, out)
+	return nil
+}
+
+func runList(e *env, args []string) error {
+	fs := newFlagSet(e, "ls", "<state> [address...]",
+		"List the addresses of the resource instances, in the order of the state.\n"+
+			"Only the resources matching any of the addresses (of module instances, resources or resource instances)\n"+
+			"and all the filter flags are listed.")
+	in := addInputFlags(fs)
+	typ := fs.String("type", "", "Only list the resources of this type")
+	mode := fs.String("mode", "", `Only list the resources of this mode, "managed" or "data"`)
+	provider := fs.String("provider", "", `Only list the resources of this provider, e.g. "registry.terraform.io/hashicorp/aws", "hashicorp/aws" or "aws"`)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if *mode != "" && *mode != string(tfjson.ManagedResourceMode) && *mode != string(tfjson.DataResourceMode) {
+		return usageErrorf("invalid -mode %q", *mode)
+	}
+	var filter func(res *tfstate.StateResource) bool
+	if fs.NArg() > 1 {
+		var err error
+		if filter, err = render.FilterAddresses(fs.Args()[1:]...); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	state, _, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, res := range stateResources(state) {
+		switch {
+		case *typ != "" && res.Type != *typ,
+			*mode != "" && string(res.Mode) != *mode,
+			*provider != "" && !matchProvider(res.ProviderName, *provider),
+			filter != nil && !filter(res):
+			continue
+		}
+		if res.DeposedKey != "" {
+			fmt.Fprintf(e.stdout, "%s (deposed object %s)\n", res.Address, res.DeposedKey)
+			continue
+		}
+		fmt.Fprintln(e.stdout, res.Address)
+	}
+	return nil
+}
+
+func runGet(e *env, args []string) error {
+	fs := newFlagSet(e, "get", "<state> <address> [path]",
+		"Print a resource instance, or one of its attributes, as JSON or HCL. The sensitive values are not redacted.\n"+
+			`The path is the attribute path of the value, e.g. ".tags.env", ".disk[0].size" or ".tags[\"team name\"]".`+"\n"+
+			`With the wildcards, e.g. "disk[*].size" or ".**.id", every matching value is printed by its path.`)
+	in := addInputFlags(fs)
+	format := fs.String("format", "json", `The output format, "json" or "hcl"`)
+	width := fs.Int("width", 80, "The maximum line width of the HCL format, within which the collections of primitive values are rendered inline")
+	if err := parseFlags(fs, args, 2, 3); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "hcl" {
+		return usageErrorf("invalid -format %q", *format)
+	}
+	addr, err := tfstate.ParseAddress(fs.Arg(1))
+	if err != nil || addr.IsModule() {
+		return usageErrorf("invalid resource instance address %q", fs.Arg(1))
+	}
+	var path cty.Path
+	if fs.NArg() > 2 {
+		if path, err = tfstate.ParsePath(fs.Arg(2)); err != nil {
+			return usageErrorf("invalid path %q: %v", fs.Arg(2), err)
+		}
+	}
+	state, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var res *tfstate.StateResource
+	for _, r := range stateResources(state) {
+		if r.DeposedKey != "" {
+			continue
+		}
+		if raddr, err := tfstate.ParseAddress(r.Address); err == nil && raddr.Equal(addr) {
+			res = r
+			break
+		}
+	}
+	if res == nil {
+		return fmt.Errorf("resource instance %s not found", addr)
+	}
+	for _, step := range path {
+		if step == tfstate.WildcardStep || step == tfstate.RecursiveWildcardStep {
+			return printMatches(e, addr, tfstate.EvalPath(res.Value, path), *format, *width)
+		}
+	}
+	val, err := tfstate.ApplyPath(res.Value, path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", addr, err)
+	}
+
+	switch *format {
+	case "hcl":
+		if len(path) == 0 {
+			out, err := render.Resource(res, render.Options{Schemas: schemas, Width: *width, ShowSensitive: true})
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(e.stdout, out)
+			return nil
+		}
+		fmt.Fprintln(e.stdout, render.Value(val, render.Options{Width: *width}))
+	default:
+		if !val.IsWhollyKnown() {
+			return fmt.Errorf("%s: the value is not wholly known", addr)
+		}
+		b, err := ctyjson.Marshal(val, val.Type())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, string(b))
+	}
+	return nil
+}
+
+// printMatches prints the values matched by a path expression, as a JSON object keyed by their paths, or as lines
+// of "<path> = <value>".
+func printMatches(e *env, addr tfstate.Address, matches []tfstate.PathMatch, format string, width int) error {
+	if format == "hcl" {
+		for _, m := range matches {
+			fmt.Fprintf(e.stdout, "%s = %s\n", tfstate.FormatPath(m.Path), render.Value(m.Value, render.Options{Width: width}))
+		}
+		return nil
+	}
+	obj := map[string]json.RawMessage{}
+	for _, m := range matches {
+		if !m.Value.IsWhollyKnown() {
+			return fmt.Errorf("%s: %s is not wholly known", addr, tfstate.FormatPath(m.Path))
+		}
+		b, err := ctyjson.Marshal(m.Value, m.Value.Type())
+		if err != nil {
+			return err
+		}
+		obj[tfstate.FormatPath(m.Path)] = b
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, string(b))
+	return nil
+}
+
+func runDiff(e *env, args []string) error {
+	fs := newFlagSet(e, "diff", "<old state> <new state>",
+		"Show the difference of the resources between two states in the style of the Terraform plan, with the\n"+
+			"sensitive values redacted. The resource instances are matched by their addresses (and deposed keys).")
+	in := addInputFlags(fs)
+	color := fs.Bool("color", false, "Enable the colored output")
+	width := fs.Int("width", 0, "The maximum line width, within which the collections of primitive values are rendered inline")
+	normalize := fs.Bool("normalize", false, "Normalize the null and empty collections (per the schema) before diffing, to hide the inconsistencies of providers")
+	ignorePath := addIgnoreFlag(fs)
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+	rules, err := loadIgnoreRules(*ignorePath)
+	if err != nil {
+		return err
+	}
+	oldState, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newState, _, err := in.load(e, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		address, deposed string
+	}
+	var keys []key
+	oldResources := map[key]*tfstate.StateResource{}
+	for _, res := range stateResources(oldState) {
+		k := key{res.Address, res.DeposedKey}
+		oldResources[k] = res
+		keys = append(keys, k)
+	}
+	newResources := map[key]*tfstate.StateResource{}
+	for _, res := range stateResources(newState) {
+		k := key{res.Address, res.DeposedKey}
+		newResources[k] = res
+		if _, ok := oldResources[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	opts := render.Options{Schemas: schemas, Color: *color, Width: *width, Normalize: *normalize, Ignore: rules}
+	var diffs []string
+	for _, k := range keys {
+		out, err := render.ResourceDiff(oldResources[k], newResources[k], opts)
+		if err != nil {
+			return err
+		}
+		if out != "" {
+			diffs = append(diffs, out)
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintln(e.stdout, "No changes.")
+		return nil
+	}
+	fmt.Fprint(e.stdout, strings.Join(diffs, "\n"))
+	return nil
+}
+
+func runValidate(e *env, args []string) error {
+	fs := newFlagSet(e, "validate", "<state>",
+		"Validate the state against the provider schemas. Every resource instance must be decodable with the schema\n"+
+			"of its resource type. A warning is reported for the ones recorded with a different schema version.")
+	in := addInputFlags(fs)
+	ignorePath := addIgnoreFlag(fs)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	rules, err := loadIgnoreRules(*ignorePath)
+	if err != nil {
+		return err
+	}
+	schemas, err := in.schemas()
+	if err != nil {
+		return err
+	}
+	rawState, err := readJSONState(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var resources []*tfjson.StateResource
+	var walk func(module *tfjson.StateModule)
+	walk = func(module *tfjson.StateModule) {
+		if module == nil {
+			return
+		}
+		resources = append(resources, module.Resources...)
+		for _, module := range module.ChildModules {
+			walk(module)
+		}
+	}
+	if rawState.Values != nil {
+		walk(rawState.Values.RootModule)
+	}
+
+	var errs int
+	for _, res := range resources {
+		if _, err := tfstate.FromJSONStateResource(rules.JSONResource(res), schemas); err != nil {
+			errs++
+			fmt.Fprintf(e.stdout, "Error: %s: %v\n", res.Address, err)
+			continue
+		}
+		schema, err := tfstate.LookupResourceSchema(schemas, res.ProviderName, res.Mode, res.Type)
+		if err == nil && schema.Version != res.SchemaVersion {
+			fmt.Fprintf(e.stdout, "Warning: %s: recorded with the schema version %d, but the provider schema version is %d\n", res.Address, res.SchemaVersion, schema.Version)
+		}
+	}
+	if errs != 0 {
+		fmt.Fprintf(e.stdout, "%d of %d resource instances are invalid.\n", errs, len(resources))
+		return errInvalid
+	}
+	fmt.Fprintf(e.stdout, "The state is valid (%d resource instances).\n", len(resources))
+	return nil
+}
+
+func runScan(e *env, args []string) error {
+	fs := newFlagSet(e, "scan", "<state>",
+		"Scan the resources and outputs for the secrets held in the values that are not marked sensitive, e.g. private\n"+
+			"keys, access keys, tokens or high-entropy strings. The sensitive values (per the state or the schemas) are skipped.")
+	in := addInputFlags(fs)
+	rulesPath := fs.String("rules", "", "The secret rule set file (YAML or JSON) of the detectors, instead of the embedded default ones")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	var rules *secrets.Rules
+	if *rulesPath != "" {
+		var err error
+		if rules, err = secrets.Load(*rulesPath); err != nil {
+			return err
+		}
+	}
+	state, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	findings, err := secrets.Scan(state, secrets.Options{Schemas: schemas, Rules: rules})
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		fmt.Fprintln(e.stdout, f)
+	}
+	if len(findings) != 0 {
+		fmt.Fprintf(e.stdout, "%d possible secrets found.\n", len(findings))
+		return errInvalid
+	}
+	fmt.Fprintln(e.stdout, "No secrets found.")
+	return nil
+}
+
+func runExport(e *env, args []string) error {
+	fs := newFlagSet(e, "export", "<state>",
+		"Export the state. The sensitive values are not redacted.\n"+
+			`  csv:    One row per resource instance, with the columns of the -attribute paths`+"\n"+
+			`  ndjson: The same as csv, but as newline-delimited JSON`+"\n"+
+			`  json:   The same format as the output of "terraform show -json"`+"\n"+
+			`  hcl:    The same format as the output of "terraform show"`)
+	in := addInputFlags(fs)
+	format := fs.String("format", "json", `The output format, "csv", "ndjson", "json" or "hcl"`)
+	var attributes stringsFlag
+	fs.Var(&attributes, "attribute", `The attribute path of a column of csv or ndjson, e.g. ".tags.env" (repeatable). The whole value is exported as JSON if not specified`)
+	expand := fs.Bool("expand", false, "Expand the collection values of csv or ndjson into a column per element, instead of encoding them as JSON")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	switch *format {
+	case "csv", "ndjson", "json", "hcl":
+	default:
+		return usageErrorf("invalid -format %q", *format)
+	}
+	state, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv", "ndjson":
+		opts := table.Options{
+			Attributes: attributes,
+			Schemas:    schemas,
+		}
+		if len(opts.Attributes) == 0 {
+			opts.Attributes = []string{""}
+		}
+		if *expand {
+			opts.Nested = table.NestedExpand
+		}
+		tbl, err := table.New(state, opts)
+		if err != nil {
+			return err
+		}
+		if *format == "csv" {
+			return tbl.WriteCSV(e.stdout)
+		}
+		return tbl.WriteNDJSON(e.stdout)
+	case "hcl":
+		out, err := render.State(state, render.Options{Schemas: schemas, ShowSensitive: true})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(e.stdout, out)
+		return nil
+	default:
+		rawState, err := tfstate.ToJSONState(state)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(rawState, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, string(b))
+		return nil
+	}
+}
+
+func runRedact(e *env, args []string) error {
+	fs := newFlagSet(e, "redact", "<state>",
+		"Print the state, in the same format as the output of \"terraform show -json\", with the sensitive values (per the\n"+
+			"state or the schemas) and the chosen values replaced by placeholders of the same types, e.g. to attach it to a\n"+
+			"bug report. The same values have the same placeholders, which are derived from the HMAC of the values.")
+	in := addInputFlags(fs)
+	var paths, outputs stringsFlag
+	fs.Var(&paths, "path", `The path expression of the values to redact in every resource instance, e.g. ".**.password" (repeatable)`)
+	fs.Var(&outputs, "output", "The name of an output to redact, besides the sensitive ones (repeatable)")
+	key := fs.String("key", "", "The key of the HMAC of the placeholders, which makes them hard to guess from the candidate values")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	policy := tfstate.RedactPolicy{Outputs: outputs, Key: []byte(*key)}
+	for _, p := range paths {
+		path, err := tfstate.ParsePath(p)
+		if err != nil {
+			return usageErrorf("invalid -path %q: %v", p, err)
+		}
+		policy.Paths = append(policy.Paths, path)
+	}
+	state, schemas, err := in.load(e, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	policy.Schemas = schemas
+	redacted, err := tfstate.Redact(state, policy)
+	if err != nil {
+		return err
+	}
+	rawState, err := tfstate.ToJSONState(redacted)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rawState, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, string(b))
+	return nil
+}
+
+func runCodegen(e *env, args []string) error {
+	fs := newFlagSet(e, "codegen", "<type>...",
+		"Generate the Go structs of the resource types (prefixed by \"data.\" for the data sources) from the provider\n"+
+			"schemas, which can be decoded from the state via tfstate.As.")
+	in := addInputFlags(fs)
+	pkg := fs.String("package", "main", "The package name of the generated file")
+	provider := fs.String("provider", "", `The provider of the resource types, either the full source address or its trailing part (e.g. "hashicorp/aws"), required if the types are ambiguous`)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	schemas, err := in.schemas()
+	if err != nil {
+		return err
+	}
+	opts := codegen.Options{Package: *pkg}
+	for _, typ := range fs.Args() {
+		res, err := lookupResourceType(schemas, typ, *provider)
+		if err != nil {
+			return err
+		}
+		opts.Resources = append(opts.Resources, res)
+	}
+	b, err := codegen.Generate(schemas, opts)
+	if err != nil {
+		return err
+	}
+	_, err = e.stdout.Write(b)
+	return err
+}
+
+func runJSONSchema(e *env, args []string) error {
+	fs := newFlagSet(e, "jsonschema", "<type>",
+		"Print the JSON Schema (draft 2020-12) of the state values of the resource type (prefixed by \"data.\" for the\n"+
+			"data sources), i.e. the \"values\" of the resources in the output of \"terraform show -json\".")
+	in := addInputFlags(fs)
+	provider := fs.String("provider", "", `The provider of the resource type, either the full source address or its trailing part (e.g. "hashicorp/aws"), required if the type is ambiguous`)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	schemas, err := in.schemas()
+	if err != nil {
+		return err
+	}
+	res, err := lookupResourceType(schemas, fs.Arg(0), *provider)
+	if err != nil {
+		return err
+	}
+	schema, err := tfstate.LookupResourceSchema(schemas, res.ProviderName, res.Mode, res.Type)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(jsonschema.SchemaBlockJSONSchema(schema.Block), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, string(b))
+	return nil
+}
+
+// lookupResourceType finds the provider of the resource type (prefixed by "data." for the data sources) in the
+// provider schemas, among the ones matching the provider pattern (see matchProvider) if specified.
+func lookupResourceType(schemas *tfjson.ProviderSchemas, typ, provider string) (codegen.Resource, error) {
+	res := codegen.Resource{Mode: tfjson.ManagedResourceMode, Type: typ}
+	if strings.HasPrefix(typ, "data.") {
+		res.Mode = tfjson.DataResourceMode
+		res.Type = strings.TrimPrefix(typ, "data.")
+	}
+	var providers []string
+	for name, schema := range schemas.Schemas {
+		if provider != "" && !matchProvider(name, provider) {
+			continue
+		}
+		resSchemas := schema.ResourceSchemas
+		if res.Mode == tfjson.DataResourceMode {
+			resSchemas = schema.DataSourceSchemas
+		}
+		if _, ok := resSchemas[res.Type]; ok {
+			providers = append(providers, name)
+		}
+	}
+	switch len(providers) {
+	case 0:
+		return res, fmt.Errorf("no provider schema found for %s", typ)
+	case 1:
+		res.ProviderName = providers[0]
+		return res, nil
+	default:
+		sort.Strings(providers)
+		return res, usageErrorf("%s is ambiguous among providers %s, use -provider to choose one", typ, strings.Join(providers, ", "))
+	}
+}
+
+// stateResources returns all the resource instance objects of the state, in the order of the state.
+func stateResources(state *tfstate.State) []*tfstate.StateResource {
+	if state == nil || state.Values == nil {
+		return nil
+	}
+	var ret []*tfstate.StateResource
+	var walk func(module *tfstate.StateModule)
+	walk = func(module *tfstate.StateModule) {
+		if module == nil {
+			return
+		}
+		ret = append(ret, module.Resources...)
+		for _, module := range module.ChildModules {
+			walk(module)
+		}
+	}
+	walk(state.Values.RootModule)
+	return ret
+}
+
+// matchProvider tells whether the provider source address matches the pattern, which is either the full source
+// address, or its trailing part (e.g. "hashicorp/aws" or "aws").
+func matchProvider(source, pattern string) bool {
+	return source == pattern || strings.HasSuffix(source, "/"+pattern)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/ignore"
+	"github.com/magodo/tfstate/opentofu"
+)
+
+// passphraseEnv is the environment variable of the passphrase to decrypt the OpenTofu encrypted state file, whose key
+// is derived by the "pbkdf2" key provider.
+const passphraseEnv = "TFSTATE_PASSPHRASE"
+
+// inputFlags are the common flags of the commands that read the state.
+type inputFlags struct {
+	schema string
+}
+
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	f := &inputFlags{}
+	fs.StringVar(&f.schema, "schema", "", `The provider schemas file, i.e. the output of "terraform providers schema -json" (required)`)
+	return f
+}
+
+// schemas reads the provider schemas.
+func (f *inputFlags) schemas() (*tfjson.ProviderSchemas, error) {
+	if f.schema == "" {
+		return nil, usageErrorf("-schema is required")
+	}
+	b, err := os.ReadFile(f.schema)
+	if err != nil {
+		return nil, err
+	}
+	var schemas tfjson.ProviderSchemas
+	if err := json.Unmarshal(b, &schemas); err != nil {
+		return nil, fmt.Errorf("unmarshal schemas %s: %v", f.schema, err)
+	}
+	return &schemas, nil
+}
+
+// load reads the state and the provider schemas, and decodes the state.
+func (f *inputFlags) load(e *env, path string) (*tfstate.State, *tfjson.ProviderSchemas, error) {
+	schemas, err := f.schemas()
+	if err != nil {
+		return nil, nil, err
+	}
+	rawState, err := readJSONState(e, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := tfstate.FromJSONState(rawState, schemas)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode state %s: %v", path, err)
+	}
+	return state, schemas, nil
+}
+
+// addIgnoreFlag adds the -ignore flag of the ignore rule set file.
+func addIgnoreFlag(fs *flag.FlagSet) *string {
+	return fs.String("ignore", "", "The ignore rule set file (YAML or JSON) of the attributes to ignore")
+}
+
+// loadIgnoreRules loads the ignore rule set file, which ignores nothing if the path is empty.
+func loadIgnoreRules(path string) (*ignore.Rules, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return ignore.Load(path)
+}
+
+// readJSONState reads the state from the path ("-" for the stdin), which can be the state file (optionally encrypted
+// by OpenTofu), or the output of `terraform show -json`. The state file is converted to the latter.
+func readJSONState(e *env, path string) (*tfjson.State, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = io.ReadAll(e.stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opentofu.IsEncryptedState(b) {
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is an encrypted state, set %s to decrypt it", path, passphraseEnv)
+		}
+		if b, err = opentofu.DecryptState(b, opentofu.PBKDF2KeyProvider{Passphrase: passphrase}); err != nil {
+			return nil, fmt.Errorf("decrypt state %s: %v", path, err)
+		}
+	}
+
+	var probe struct {
+		FormatVersion string `json:"format_version"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, fmt.Errorf("unmarshal state %s: %v", path, err)
+	}
+	if probe.FormatVersion == "" {
+		rawState, err := tfstate.RawStateToJSONState(b)
+		if err != nil {
+			return nil, fmt.Errorf("read state file %s: %v", path, err)
+		}
+		return rawState, nil
+	}
+	var rawState tfjson.State
+	if err := json.Unmarshal(b, &rawState); err != nil {
+		return nil, fmt.Errorf("unmarshal state %s: %v", path, err)
+	}
+	return &rawState, nil
+}
@@ -0,0 +1,153 @@
+// Command tfstate inspects the Terraform (or OpenTofu) state, which can be either the state file or the output of
+// `terraform show -json`, together with the provider schemas (i.e. the output of `terraform providers schema -json`).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `Usage: tfstate <command> [flags] <state> [args]
+
+The <state> is either the state file or the output of "terraform show -json", or "-" to read from the stdin.
+
+Commands:
+  show        Show the resources and outputs in the human readable format, with the sensitive values redacted
+  ls          List the addresses of the resource instances
+  get         Print a resource instance, or one of its attributes, as JSON or HCL
+  diff        Show the difference of the resources between two states
+  validate    Validate the state against the provider schemas
+  scan        Scan the state for the secrets in the values that are not marked sensitive
+  export      Export the state as CSV, JSON or HCL
+  redact      Print the state with the sensitive values replaced by placeholders, for safe sharing
+  codegen     Generate the Go structs of the resource types from the provider schemas (takes no <state>)
+  jsonschema  Print the JSON Schema of the state values of a resource type (takes no <state>)
+
+Run "tfstate <command> -h" for the flags of a command.
+`
+
+// env is the environment of a command.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(e *env, args []string) error
+
+var commands = map[string]command{
+	"show":       runShow,
+	"ls":         runList,
+	"get":        runGet,
+	"diff":       runDiff,
+	"validate":   runValidate,
+	"scan":       runScan,
+	"redact":     runRedact,
+	"export":     runExport,
+	"codegen":    runCodegen,
+	"jsonschema": runJSONSchema,
+}
+
+var (
+	// errInvalid is returned by the commands that complete but have a negative result, e.g. validate finds errors.
+	// The details have already been written out.
+	errInvalid = errors.New("invalid")
+
+	// errFlag is returned for the invalid command line flags or arguments, whose details (and the usage) have
+	// already been written out by the flag set.
+	errFlag = errors.New("flag")
+)
+
+func main() {
+	os.Exit(run(&env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+func run(e *env, args []string) int {
+	stderr := e.stderr
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	err := cmd(e, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errInvalid):
+		return 1
+	case errors.Is(err, errFlag):
+		return 2
+	}
+	fmt.Fprintf(stderr, "%s: %v\n", args[0], err)
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		return 2
+	}
+	return 1
+}
+
+// usageError is the error of the invalid command line.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// newFlagSet returns the flag set of a command, which writes the usage to the stderr.
+func newFlagSet(e *env, name, args, desc string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tfstate %s [flags] %s\n\n%s\n\nFlags:\n", name, args, desc)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags, and checks the number of the positional arguments is within [minArgs, maxArgs].
+// A negative maxArgs means no upper bound.
+func parseFlags(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errFlag
+	}
+	if n := fs.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		fmt.Fprintf(fs.Output(), "wrong number of arguments\n")
+		fs.Usage()
+		return errFlag
+	}
+	return nil
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package codegen generates the Go structs of the resource types from the provider schemas, whose values can be
+// decoded from the state via tfstate.As, so that they can be accessed with the compile-time type checking, e.g.
+//
+//	pw, err := tfstate.As[RandomPassword](res)
+//	if err != nil {
+//		return err
+//	}
+//	if pw.Length < 16 {
+//		...
+//	}
+//
+// The structs are derived from the implied types of the schemas (without the write-only attributes, which are
+// absent in the state). The fields are tagged by `cty:"..."` with the attribute names, and are typed as:
+//
+//   - string, float64 and bool for the primitive attributes, or the pointers of them if the attributes are not
+//     required (i.e. can be null).
+//   - []T for the lists and sets, map[string]T for the maps, and cty.Value for the dynamic and tuple types.
+//   - Named structs for the objects (e.g. the nested attributes), whose attributes are all optional.
+//   - []T, map[string]T and *T for the nested blocks of the list (or set), map and single (or group) nesting modes
+//     respectively.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Resource is a resource type to generate the struct for.
+type Resource struct {
+	// ProviderName is the source address of the provider of the resource type, e.g.
+	// "registry.terraform.io/hashicorp/random".
+	ProviderName string
+	Mode         tfjson.ResourceMode
+	Type         string
+	// Name is the name of the struct, which defaults to the camel case of the resource type (prefixed by "Data" for
+	// the data sources), e.g. "RandomPassword" for "random_password".
+	Name string
+}
+
+type Options struct {
+	// Package is the package name of the generated file, which defaults to "main".
+	Package string
+	// Resources are the resource types to generate.
+	Resources []Resource
+}
+
+// Generate generates the gofmt-ed Go source file of the structs of the resource types.
+func Generate(schemas *tfjson.ProviderSchemas, opts Options) ([]byte, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "main"
+	}
+	g := &generator{names: map[string]bool{}}
+
+	// Reserve the names of the resource structs first, so that they are not taken by the nested structs.
+	names := make([]string, len(opts.Resources))
+	for i, res := range opts.Resources {
+		name := res.Name
+		if name == "" {
+			name = GoName(res.Type)
+			if res.Mode == tfjson.DataResourceMode {
+				name = "Data" + name
+			}
+		}
+		if g.names[name] {
+			return nil, fmt.Errorf("duplicate struct name %q", name)
+		}
+		g.names[name] = true
+		names[i] = name
+	}
+	for i, res := range opts.Resources {
+		schema, err := tfstate.LookupResourceSchema(schemas, res.ProviderName, res.Mode, res.Type)
+		if err != nil {
+			return nil, fmt.Errorf("resource type %q: %v", res.Type, err)
+		}
+		kind := "resource"
+		if res.Mode == tfjson.DataResourceMode {
+			kind = "data source"
+		}
+		g.block(names[i], fmt.Sprintf("%s is the value of the %s %s.", names[i], res.Type, kind), jsonschema.SchemaBlockWithoutWriteOnly(schema.Block))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tfstate codegen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.useCty {
+		buf.WriteString("import \"github.com/zclconf/go-cty/cty\"\n\n")
+	}
+	for _, def := range g.defs {
+		buf.WriteString(def)
+		buf.WriteString("\n")
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated code: %v", err)
+	}
+	return b, nil
+}
+
+type generator struct {
+	// names are the struct names that are taken.
+	names map[string]bool
+	// defs are the struct definitions, in the order of generation.
+	defs []string
+	// useCty tells whether the cty package is referenced.
+	useCty bool
+}
+
+type field struct {
+	name string
+	typ  string
+	tag  string
+}
+
+// newName returns a struct name based on the given one, which is not taken yet.
+func (g *generator) newName(name string) string {
+	ret := name
+	for i := 2; g.names[ret]; i++ {
+		ret = name + strconv.Itoa(i)
+	}
+	g.names[ret] = true
+	return ret
+}
+
+// define returns the definition of the struct of the fields.
+func define(name, doc string, fields []field) string {
+	var buf strings.Builder
+	if doc != "" {
+		fmt.Fprintf(&buf, "// %s\n", doc)
+	}
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for _, f := range fields {
+		fmt.Fprintf(&buf, "\t%s %s `cty:%q`\n", f.name, f.typ, f.tag)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// block defines the struct of the block, whose name must have been reserved.
+func (g *generator) block(name, doc string, b *tfjson.SchemaBlock) {
+	// The index of the struct definition is reserved, so that the nested structs follow their parent.
+	idx := len(g.defs)
+	g.defs = append(g.defs, "")
+
+	var attrs []string
+	for k := range b.Attributes {
+		attrs = append(attrs, k)
+	}
+	for k := range b.NestedBlocks {
+		attrs = append(attrs, k)
+	}
+	sort.Strings(attrs)
+
+	var fields []field
+	for _, k := range attrs {
+		var typ string
+		if attr, ok := b.Attributes[k]; ok {
+			typ = g.goType(jsonschema.SchemaAttributeImpliedType(attr), !attr.Required, name+GoName(k))
+		} else {
+			nb := b.NestedBlocks[k]
+			nbName := g.newName(name + GoName(k))
+			nbBlock := nb.Block
+			if nbBlock == nil {
+				nbBlock = &tfjson.SchemaBlock{}
+			}
+			g.block(nbName, "", nbBlock)
+			switch nb.NestingMode {
+			case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+				typ = "[]" + nbName
+			case tfjson.SchemaNestingModeMap:
+				typ = "map[string]" + nbName
+			default:
+				typ = "*" + nbName
+			}
+		}
+		fields = append(fields, field{name: GoName(k), typ: typ, tag: k})
+	}
+
+	g.defs[idx] = define(name, doc, fields)
+}
+
+// goType returns the Go type of the cty type, which is a pointer for the nullable primitives and objects. The name is
+// used for the struct of the object type.
+func (g *generator) goType(ty cty.Type, nullable bool, name string) string {
+	ptr := ""
+	if nullable {
+		ptr = "*"
+	}
+	switch {
+	case ty == cty.String:
+		return ptr + "string"
+	case ty == cty.Number:
+		return ptr + "float64"
+	case ty == cty.Bool:
+		return ptr + "bool"
+	case ty.IsListType(), ty.IsSetType():
+		return "[]" + g.goType(ty.ElementType(), false, name)
+	case ty.IsMapType():
+		return "map[string]" + g.goType(ty.ElementType(), false, name)
+	case ty.IsObjectType():
+		name = g.newName(name)
+		atys := ty.AttributeTypes()
+		var attrs []string
+		for k := range atys {
+			attrs = append(attrs, k)
+		}
+		sort.Strings(attrs)
+		idx := len(g.defs)
+		g.defs = append(g.defs, "")
+		var fields []field
+		for _, k := range attrs {
+			fields = append(fields, field{name: GoName(k), typ: g.goType(atys[k], true, name+GoName(k)), tag: k})
+		}
+		g.defs[idx] = define(name, "", fields)
+		return ptr + name
+	default:
+		// Dynamic, tuple and capsule types
+		g.useCty = true
+		return "cty.Value"
+	}
+}
+
+// commonInitialisms are the words that are upper cased as a whole in GoName, following the Go naming convention.
+var commonInitialisms = map[string]bool{
+	"acl": true, "api": true, "arn": true, "cidr": true, "cpu": true, "dns": true, "http": true, "https": true,
+	"id": true, "ip": true, "json": true, "sku": true, "ssh": true, "ssl": true, "tcp": true, "tls": true,
+	"ttl": true, "udp": true, "uri": true, "url": true, "uuid": true, "vm": true, "vpc": true,
+}
+
+// GoName returns the exported Go identifier of the snake cased name, e.g. "VPCSecurityGroupIDs" for
+// "vpc_security_group_ids".
+func GoName(name string) string {
+	var buf strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		lower := strings.ToLower(word)
+		switch {
+		case commonInitialisms[lower]:
+			buf.WriteString(strings.ToUpper(lower))
+		case strings.HasSuffix(lower, "s") && commonInitialisms[strings.TrimSuffix(lower, "s")]:
+			buf.WriteString(strings.ToUpper(strings.TrimSuffix(lower, "s")) + "s")
+		default:
+			r := []rune(word)
+			buf.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+		}
+	}
+	ret := buf.String()
+	if ret == "" || !unicode.IsLetter([]rune(ret)[0]) {
+		ret = "X" + ret
+	}
+	return ret
+}
@@ -0,0 +1,139 @@
+package codegen_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate/codegen"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestGenerate(t *testing.T) {
+	schemas := &tfjson.ProviderSchemas{
+		FormatVersion: "1.0",
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/hashicorp/demo": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"demo_server": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"id":       {AttributeType: cty.String, Computed: true},
+								"name":     {AttributeType: cty.String, Required: true},
+								"password": {AttributeType: cty.String, Optional: true, WriteOnly: true},
+								"tags":     {AttributeType: cty.Map(cty.String), Optional: true},
+								"extra":    {AttributeType: cty.DynamicPseudoType, Optional: true},
+								"network": {
+									AttributeNestedType: &tfjson.SchemaNestedAttributeType{
+										NestingMode: tfjson.SchemaNestingModeSingle,
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"subnet_ids": {AttributeType: cty.Set(cty.String), Required: true},
+										},
+									},
+									Optional: true,
+								},
+							},
+							NestedBlocks: map[string]*tfjson.SchemaBlockType{
+								"disk": {
+									NestingMode: tfjson.SchemaNestingModeList,
+									Block: &tfjson.SchemaBlock{
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"size": {AttributeType: cty.Number, Required: true},
+										},
+										NestedBlocks: map[string]*tfjson.SchemaBlockType{
+											"label": {
+												NestingMode: tfjson.SchemaNestingModeMap,
+												Block: &tfjson.SchemaBlock{
+													Attributes: map[string]*tfjson.SchemaAttribute{
+														"value": {AttributeType: cty.String, Optional: true},
+													},
+												},
+											},
+										},
+									},
+								},
+								"timeouts": {
+									NestingMode: tfjson.SchemaNestingModeSingle,
+									Block: &tfjson.SchemaBlock{
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"create": {AttributeType: cty.String, Optional: true},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				DataSourceSchemas: map[string]*tfjson.Schema{
+					"demo_server": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"id": {AttributeType: cty.String, Required: true},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	b, err := codegen.Generate(schemas, codegen.Options{
+		Package: "policy",
+		Resources: []codegen.Resource{
+			{ProviderName: "registry.terraform.io/hashicorp/demo", Mode: tfjson.ManagedResourceMode, Type: "demo_server"},
+			{ProviderName: "registry.terraform.io/hashicorp/demo", Mode: tfjson.DataResourceMode, Type: "demo_server"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "// Code generated by tfstate codegen. DO NOT EDIT.\n\n"+
+		"package policy\n\n"+
+		"import \"github.com/zclconf/go-cty/cty\"\n\n"+
+		"// DemoServer is the value of the demo_server resource.\n"+
+		"type DemoServer struct {\n"+
+		"\tDisk     []DemoServerDisk    `cty:\"disk\"`\n"+
+		"\tExtra    cty.Value           `cty:\"extra\"`\n"+
+		"\tID       *string             `cty:\"id\"`\n"+
+		"\tName     string              `cty:\"name\"`\n"+
+		"\tNetwork  *DemoServerNetwork  `cty:\"network\"`\n"+
+		"\tTags     map[string]string   `cty:\"tags\"`\n"+
+		"\tTimeouts *DemoServerTimeouts `cty:\"timeouts\"`\n"+
+		"}\n\n"+
+		"type DemoServerDisk struct {\n"+
+		"\tLabel map[string]DemoServerDiskLabel `cty:\"label\"`\n"+
+		"\tSize  float64                        `cty:\"size\"`\n"+
+		"}\n\n"+
+		"type DemoServerDiskLabel struct {\n"+
+		"\tValue *string `cty:\"value\"`\n"+
+		"}\n\n"+
+		"type DemoServerNetwork struct {\n"+
+		"\tSubnetIDs []string `cty:\"subnet_ids\"`\n"+
+		"}\n\n"+
+		"type DemoServerTimeouts struct {\n"+
+		"\tCreate *string `cty:\"create\"`\n"+
+		"}\n\n"+
+		"// DataDemoServer is the value of the demo_server data source.\n"+
+		"type DataDemoServer struct {\n"+
+		"\tID string `cty:\"id\"`\n"+
+		"}\n", string(b))
+
+	_, err = codegen.Generate(schemas, codegen.Options{
+		Resources: []codegen.Resource{
+			{ProviderName: "registry.terraform.io/hashicorp/demo", Mode: tfjson.ManagedResourceMode, Type: "demo_client"},
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestGoName(t *testing.T) {
+	for input, expect := range map[string]string{
+		"random_password":        "RandomPassword",
+		"id":                     "ID",
+		"vpc_security_group_ids": "VPCSecurityGroupIDs",
+		"https_only":             "HTTPSOnly",
+		"dns":                    "DNS",
+		"0day":                   "X0day",
+		"foo-bar":                "FooBar",
+	} {
+		require.Equal(t, expect, codegen.GoName(input), input)
+	}
+}
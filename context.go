@@ -0,0 +1,122 @@
+package tfstate
+
+import (
+	"context"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// ProgressFunc reports the progress of a conversion, i.e. the number of the resources done out of the total.
+// The total is -1 if it is unknown beforehand.
+type ProgressFunc func(done, total int)
+
+// ConvertOptions are the options of the context-aware conversions from the JSON state.
+type ConvertOptions struct {
+	// Parallelism is the maximum number of resources converted concurrently. A non-positive value means one.
+	Parallelism int
+
+	// Progress is called after each resource is converted, with the number of the resources converted so far.
+	// The calls are serialized, even when the resources are converted concurrently.
+	Progress ProgressFunc
+}
+
+// FromJSONStateContext is the same as FromJSONState, except that the conversion stops when the context is cancelled,
+// in which case the context error is returned. The order of the resources and modules is the same as the input,
+// regardless of the parallelism.
+func FromJSONStateContext(ctx context.Context, rawState *tfjson.State, schemas *tfjson.ProviderSchemas, opts ConvertOptions) (*State, error) {
+	if rawState == nil {
+		return nil, nil
+	}
+	state := &State{
+		TerraformVersion: rawState.TerraformVersion,
+	}
+	if rawState.Values == nil {
+		return state, nil
+	}
+	state.Values = &StateValues{}
+	if rawState.Values.RootModule != nil {
+		rootModule, err := fromJSONStateModuleContext(ctx, rawState.Values.RootModule, schemas, opts)
+		if err != nil {
+			return nil, err
+		}
+		state.Values.RootModule = rootModule
+	}
+	if rawState.Values.Outputs != nil {
+		m := make(map[string]*StateOutput, len(rawState.Values.Outputs))
+		for name, output := range rawState.Values.Outputs {
+			m[name] = FromJSONStateOutput(output)
+		}
+		state.Values.Outputs = m
+	}
+	return state, nil
+}
+
+// FromRawStateContext is the same as FromRawState, except that the conversion is done via FromJSONStateContext.
+func FromRawStateContext(ctx context.Context, b []byte, schemas *tfjson.ProviderSchemas, opts ConvertOptions) (*State, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rawState, err := RawStateToJSONState(b)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSONStateContext(ctx, rawState, schemas, opts)
+}
+
+// ToJSONStateContext is the same as ToJSONState, except that the conversion stops when the context is cancelled, in
+// which case the context error is returned. The progress is reported via the optional progress callback.
+func ToJSONStateContext(ctx context.Context, state *State, progress ProgressFunc) (*tfjson.State, error) {
+	p := &progressCounter{ctx: ctx, fn: progress}
+	if state != nil && state.Values != nil {
+		p.total = countResources(state.Values.RootModule)
+	}
+	return toJSONState(state, p)
+}
+
+// ToRawStateContext is the same as ToRawState, except that the conversion stops when the context is cancelled, in
+// which case the context error is returned. The progress is reported via the optional progress callback.
+func ToRawStateContext(ctx context.Context, state *State, lineage string, serial uint64, progress ProgressFunc) ([]byte, error) {
+	p := &progressCounter{ctx: ctx, fn: progress}
+	if state != nil && state.Values != nil {
+		p.total = countResources(state.Values.RootModule)
+	}
+	return toRawState(state, lineage, serial, p)
+}
+
+// progressCounter tracks the progress of a sequential conversion. A nil progressCounter is a no-op.
+type progressCounter struct {
+	ctx   context.Context
+	fn    ProgressFunc
+	done  int
+	total int
+}
+
+// check returns the context error, if any.
+func (p *progressCounter) check() error {
+	if p == nil || p.ctx == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
+
+// inc reports one more resource is done.
+func (p *progressCounter) inc() {
+	if p == nil {
+		return
+	}
+	p.done++
+	if p.fn != nil {
+		p.fn(p.done, p.total)
+	}
+}
+
+func countResources(module *StateModule) int {
+	if module == nil {
+		return 0
+	}
+	n := len(module.Resources)
+	for _, module := range module.ChildModules {
+		n += countResources(module)
+	}
+	return n
+}
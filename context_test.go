@@ -0,0 +1,148 @@
+package tfstate_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromJSONStateContext(t *testing.T) {
+	rawState, schemas := parallelTestState(20, 2)
+	expect, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+
+	var dones []int
+	actual, err := tfstate.FromJSONStateContext(context.Background(), rawState, schemas, tfstate.ConvertOptions{
+		Parallelism: 4,
+		Progress: func(done, total int) {
+			require.Equal(t, 60, total)
+			dones = append(dones, done)
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, expect, actual)
+	require.Len(t, dones, 60)
+	for i, done := range dones {
+		require.Equal(t, i+1, done)
+	}
+
+	// Cancel in the middle of the conversion.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = tfstate.FromJSONStateContext(ctx, rawState, schemas, tfstate.ConvertOptions{
+		Progress: func(done, total int) {
+			if done == 10 {
+				cancel()
+			}
+		},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFromRawStateContext(t *testing.T) {
+	b, err := os.ReadFile("testdata/opentofu/terraform.tfstate")
+	require.NoError(t, err)
+	schemas := loadOpenTofuSchemas(t)
+	expect, err := tfstate.FromRawState(b, schemas)
+	require.NoError(t, err)
+
+	var n int
+	actual, err := tfstate.FromRawStateContext(context.Background(), b, schemas, tfstate.ConvertOptions{
+		Progress: func(done, total int) { n = done },
+	})
+	require.NoError(t, err)
+	require.Equal(t, expect, actual)
+	require.Equal(t, len(stateResources(expect)), n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tfstate.FromRawStateContext(ctx, b, schemas, tfstate.ConvertOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestToJSONStateContext(t *testing.T) {
+	rawState, schemas := parallelTestState(5, 2)
+	state, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+
+	expect, err := tfstate.ToJSONState(state)
+	require.NoError(t, err)
+	var dones []int
+	actual, err := tfstate.ToJSONStateContext(context.Background(), state, func(done, total int) {
+		require.Equal(t, 15, total)
+		dones = append(dones, done)
+	})
+	require.NoError(t, err)
+	require.Equal(t, expect, actual)
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, dones)
+
+	// The cancellation in a child module is not wrapped.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = tfstate.ToJSONStateContext(ctx, state, func(done, total int) {
+		if done == 7 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestToRawStateContext(t *testing.T) {
+	rawState, schemas := parallelTestState(5, 2)
+	state, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+
+	expect, err := tfstate.ToRawState(state, "lineage", 1)
+	require.NoError(t, err)
+	var n int
+	actual, err := tfstate.ToRawStateContext(context.Background(), state, "lineage", 1, func(done, total int) {
+		require.Equal(t, 15, total)
+		n = done
+	})
+	require.NoError(t, err)
+	require.Equal(t, string(expect), string(actual))
+	require.Equal(t, 15, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = tfstate.ToRawStateContext(ctx, state, "lineage", 1, func(done, total int) {
+		if done == 3 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestJSONStateDecoderContext(t *testing.T) {
+	rawState, schemas := parallelTestState(5, 2)
+	b, err := json.Marshal(rawState)
+	require.NoError(t, err)
+
+	var dones []int
+	dec := tfstate.NewJSONStateDecoder(bytes.NewReader(b), schemas)
+	dec.Progress(func(done, total int) {
+		require.Equal(t, -1, total)
+		dones = append(dones, done)
+	})
+	_, err = dec.DecodeContext(context.Background(), func(res *tfstate.StateResource) error { return nil })
+	require.NoError(t, err)
+	require.Len(t, dones, 15)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var n int
+	_, err = tfstate.NewJSONStateDecoder(bytes.NewReader(b), schemas).DecodeContext(ctx, func(res *tfstate.StateResource) error {
+		n++
+		if n == 8 {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 8, n)
+}
@@ -3,7 +3,6 @@ package tfstate
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
@@ -343,19 +342,5 @@ func (e PathError) Error() string {
 }
 
 func pathStr(path cty.Path) string {
-	if len(path) == 0 {
-		return ""
-	}
-	var buf strings.Builder
-	for _, step := range path {
-		switch step := step.(type) {
-		case cty.GetAttrStep:
-			fmt.Fprintf(&buf, ".%s", step.Name)
-		case cty.IndexStep:
-			fmt.Fprintf(&buf, "[%#v]", step.Key)
-		default:
-			fmt.Fprintf(&buf, "<INVALID: %#v>", step)
-		}
-	}
-	return buf.String()
+	return FormatPath(path)
 }
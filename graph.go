@@ -0,0 +1,448 @@
+package tfstate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type GraphNodeKind string
+
+const (
+	GraphNodeResource GraphNodeKind = "resource"
+	GraphNodeModule   GraphNodeKind = "module"
+)
+
+type GraphEdgeKind string
+
+const (
+	// GraphEdgeDependsOn is an edge derived from the DependsOn of the resources.
+	GraphEdgeDependsOn GraphEdgeKind = "depends_on"
+	// GraphEdgeInferred is an edge inferred from the references between the resource values, see InferDependencies.
+	GraphEdgeInferred GraphEdgeKind = "inferred"
+)
+
+// GraphNode is a node of the dependency graph, which is either a resource instance or a module instance.
+type GraphNode struct {
+	Kind    GraphNodeKind
+	Address string
+
+	// Resource is the resource instance object of a resource node. In case there are deposed objects, this is
+	// the current object (or the first deposed one if there is no current object).
+	Resource *StateResource
+	// Module is the module of a module node.
+	Module *StateModule
+
+	dependencies map[*GraphNode]GraphEdgeKind
+	dependents   map[*GraphNode]GraphEdgeKind
+}
+
+// Dependencies returns the nodes that the node directly depends on, sorted by address.
+func (n *GraphNode) Dependencies() []*GraphNode {
+	return sortedNodes(n.dependencies)
+}
+
+// Dependents returns the nodes that directly depend on the node, sorted by address.
+func (n *GraphNode) Dependents() []*GraphNode {
+	return sortedNodes(n.dependents)
+}
+
+// EdgeKind returns the kind of the edge from the node to the dependency, or an empty string if there is no such edge.
+func (n *GraphNode) EdgeKind(dependency *GraphNode) GraphEdgeKind {
+	return n.dependencies[dependency]
+}
+
+// Graph is the dependency graph of the resource instances in a state, built from their DependsOn.
+//
+// A resource instance depends on all the instances of each resource in its DependsOn. A module instance depends on
+// the resource instances outside of it that anything inside it depends on, which are also the only edges of
+// the module nodes. Hence, the module nodes never introduce cycles.
+//
+// Edges are either from the DependsOn, or inferred (see AddInferredDependencies). An edge that is both is regarded
+// to be from the DependsOn.
+type Graph struct {
+	nodes   map[string]*GraphNode
+	addrs   map[*GraphNode]Address
+	modules []*GraphNode
+}
+
+// NewGraph builds the dependency graph of the state. The references to resources that don't exist in the state are
+// ignored.
+func NewGraph(state *State) (*Graph, error) {
+	g := &Graph{
+		nodes: map[string]*GraphNode{},
+		addrs: map[*GraphNode]Address{},
+	}
+	if state == nil {
+		return g, nil
+	}
+	instances, err := state.instances()
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Values != nil && state.Values.RootModule != nil {
+		var f func(*StateModule) error
+		f = func(module *StateModule) error {
+			for _, module := range module.ChildModules {
+				addr, err := ParseAddress(module.Address)
+				if err != nil {
+					return err
+				}
+				node := g.addNode(GraphNodeModule, addr)
+				node.Module = module
+				g.modules = append(g.modules, node)
+				if err := f(module); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := f(state.Values.RootModule); err != nil {
+			return nil, err
+		}
+	}
+
+	configAddrs := map[string][]*GraphNode{}
+	for _, inst := range instances {
+		node, ok := g.nodes[inst.addr.String()]
+		if !ok {
+			node = g.addNode(GraphNodeResource, inst.addr)
+			node.Resource = inst.resource
+			configAddr := inst.addr.ConfigAddress()
+			configAddrs[configAddr] = append(configAddrs[configAddr], node)
+		} else if node.Resource.DeposedKey != "" && inst.resource.DeposedKey == "" {
+			node.Resource = inst.resource
+		}
+	}
+
+	// The depends on of each object of a resource instance (i.e. the current and the deposed ones) are all counted.
+	for _, inst := range instances {
+		node := g.nodes[inst.addr.String()]
+		for _, dep := range inst.resource.DependsOn {
+			for _, depNode := range configAddrs[dep] {
+				g.addDependency(node, depNode, GraphEdgeDependsOn)
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// AddInferredDependencies adds the inferred dependencies (see InferDependencies) to the graph as inferred edges.
+// It fails if any resource instance of the dependencies is not in the graph.
+func (g *Graph) AddInferredDependencies(deps []InferredDependency) error {
+	for _, dep := range deps {
+		from, ok := g.nodes[dep.Address]
+		if !ok || from.Kind != GraphNodeResource {
+			return fmt.Errorf("no resource node found for %s", dep.Address)
+		}
+		to, ok := g.nodes[dep.DependsOn]
+		if !ok || to.Kind != GraphNodeResource {
+			return fmt.Errorf("no resource node found for %s", dep.DependsOn)
+		}
+		g.addDependency(from, to, GraphEdgeInferred)
+	}
+	return nil
+}
+
+func (g *Graph) addNode(kind GraphNodeKind, addr Address) *GraphNode {
+	node := &GraphNode{
+		Kind:         kind,
+		Address:      addr.String(),
+		dependencies: map[*GraphNode]GraphEdgeKind{},
+		dependents:   map[*GraphNode]GraphEdgeKind{},
+	}
+	g.nodes[node.Address] = node
+	g.addrs[node] = addr
+	return node
+}
+
+// addDependency adds an edge between two resource instance nodes, together with the edges from each module that
+// contains the depending instance, but not the dependency.
+func (g *Graph) addDependency(from, to *GraphNode, kind GraphEdgeKind) {
+	addEdge(from, to, kind)
+	for _, module := range g.modules {
+		moduleAddr := g.addrs[module]
+		if g.addrs[from].ModuleContains(moduleAddr.Module) && !g.addrs[to].ModuleContains(moduleAddr.Module) {
+			addEdge(module, to, kind)
+		}
+	}
+}
+
+func addEdge(from, to *GraphNode, kind GraphEdgeKind) {
+	if from.dependencies[to] == GraphEdgeDependsOn {
+		return
+	}
+	from.dependencies[to] = kind
+	to.dependents[from] = kind
+}
+
+// Node returns the node of the address, or nil if not found.
+func (g *Graph) Node(address string) *GraphNode {
+	return g.nodes[address]
+}
+
+// Nodes returns all the nodes, sorted by address.
+func (g *Graph) Nodes() []*GraphNode {
+	m := make(map[*GraphNode]GraphEdgeKind, len(g.nodes))
+	for _, node := range g.nodes {
+		m[node] = ""
+	}
+	return sortedNodes(m)
+}
+
+// DependentsOf returns all the nodes that directly or indirectly depend on the address, sorted by address.
+// This is the blast radius of a change to the address.
+//
+// The address can be a resource instance, a module instance, or a resource without instance key, which stands
+// for all its instances.
+func (g *Graph) DependentsOf(address string) ([]*GraphNode, error) {
+	return g.reachable(address, func(n *GraphNode) map[*GraphNode]GraphEdgeKind { return n.dependents })
+}
+
+// DependenciesOf returns all the nodes that the address directly or indirectly depends on, sorted by address.
+// The address is the same as is described in DependentsOf.
+func (g *Graph) DependenciesOf(address string) ([]*GraphNode, error) {
+	return g.reachable(address, func(n *GraphNode) map[*GraphNode]GraphEdgeKind { return n.dependencies })
+}
+
+func (g *Graph) reachable(address string, next func(*GraphNode) map[*GraphNode]GraphEdgeKind) ([]*GraphNode, error) {
+	starts, err := g.lookup(address)
+	if err != nil {
+		return nil, err
+	}
+	visited := map[*GraphNode]GraphEdgeKind{}
+	var visit func(*GraphNode)
+	visit = func(n *GraphNode) {
+		for m, kind := range next(n) {
+			if _, ok := visited[m]; ok {
+				continue
+			}
+			visited[m] = kind
+			visit(m)
+		}
+	}
+	for _, n := range starts {
+		visit(n)
+	}
+	for _, n := range starts {
+		delete(visited, n)
+	}
+	return sortedNodes(visited), nil
+}
+
+func (g *Graph) lookup(address string) ([]*GraphNode, error) {
+	if node, ok := g.nodes[address]; ok {
+		return []*GraphNode{node}, nil
+	}
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if node, ok := g.nodes[addr.String()]; ok {
+		return []*GraphNode{node}, nil
+	}
+	var ret []*GraphNode
+	if !addr.IsModule() && addr.Key == nil {
+		for _, node := range g.nodes {
+			if node.Kind != GraphNodeResource {
+				continue
+			}
+			if g.addrs[node].ResourceAddress().Equal(addr) {
+				ret = append(ret, node)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no node found for %s", address)
+	}
+	return ret, nil
+}
+
+// CycleError is returned when the graph has cycles, which can't be ordered.
+type CycleError struct {
+	Cycles [][]string
+}
+
+func (e *CycleError) Error() string {
+	var cycles []string
+	for _, cycle := range e.Cycles {
+		cycles = append(cycles, strings.Join(cycle, ", "))
+	}
+	return fmt.Sprintf("dependency cycles found: [%s]", strings.Join(cycles, "], ["))
+}
+
+// TopologicalOrder returns the nodes in the order that every node comes after all its dependencies, i.e. the
+// creation order. Nodes without ordering constraint between each other are sorted by address.
+// It returns a *CycleError if the graph has cycles.
+func (g *Graph) TopologicalOrder() ([]*GraphNode, error) {
+	if cycles := g.Cycles(); len(cycles) != 0 {
+		return nil, &CycleError{Cycles: cycles}
+	}
+	indegree := map[*GraphNode]int{}
+	var ready []*GraphNode
+	for _, node := range g.Nodes() {
+		indegree[node] = len(node.dependencies)
+		if indegree[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	var ret []*GraphNode
+	for len(ready) != 0 {
+		node := ready[0]
+		ready = ready[1:]
+		ret = append(ret, node)
+		var next []*GraphNode
+		for _, dependent := range node.Dependents() {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				next = append(next, dependent)
+			}
+		}
+		ready = append(ready, next...)
+		sort.Slice(ready, func(i, j int) bool { return ready[i].Address < ready[j].Address })
+	}
+	return ret, nil
+}
+
+// DestroyOrder returns the nodes in the order that every node comes before all its dependencies, which is the
+// reverse of the TopologicalOrder. It returns a *CycleError if the graph has cycles.
+func (g *Graph) DestroyOrder() ([]*GraphNode, error) {
+	nodes, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes, nil
+}
+
+// Cycles returns the cycles of the graph, each as the sorted addresses of the nodes involved (i.e. the strongly
+// connected components with more than one node, or with a node depending on itself). The cycles are sorted by
+// their first address.
+func (g *Graph) Cycles() [][]string {
+	// Tarjan's strongly connected components algorithm
+	var (
+		index   = map[*GraphNode]int{}
+		lowlink = map[*GraphNode]int{}
+		onStack = map[*GraphNode]bool{}
+		stack   []*GraphNode
+		counter int
+		cycles  [][]string
+	)
+	var strongConnect func(*GraphNode)
+	strongConnect = func(v *GraphNode) {
+		index[v] = counter
+		lowlink[v] = counter
+		counter++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range v.Dependencies() {
+			if _, ok := index[w]; !ok {
+				strongConnect(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+
+		if lowlink[v] != index[v] {
+			return
+		}
+		var scc []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w.Address)
+			if w == v {
+				break
+			}
+		}
+		if _, ok := v.dependencies[v]; len(scc) > 1 || ok {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+	for _, node := range g.Nodes() {
+		if _, ok := index[node]; !ok {
+			strongConnect(node)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// DOT returns the graph in the Graphviz DOT language, where the edges point from the dependents to the
+// dependencies. The inferred edges are dashed.
+func (g *Graph) DOT() string {
+	var buf strings.Builder
+	buf.WriteString("digraph {\n")
+	buf.WriteString("  rankdir = \"BT\"\n")
+	nodes := g.Nodes()
+	for _, node := range nodes {
+		shape := "box"
+		if node.Kind == GraphNodeModule {
+			shape = "folder"
+		}
+		fmt.Fprintf(&buf, "  %s [shape = %q]\n", dotQuote(node.Address), shape)
+	}
+	for _, node := range nodes {
+		for _, dep := range node.Dependencies() {
+			if node.EdgeKind(dep) == GraphEdgeInferred {
+				fmt.Fprintf(&buf, "  %s -> %s [style = \"dashed\"]\n", dotQuote(node.Address), dotQuote(dep.Address))
+				continue
+			}
+			fmt.Fprintf(&buf, "  %s -> %s\n", dotQuote(node.Address), dotQuote(dep.Address))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Mermaid returns the graph as a Mermaid flowchart, where the edges point from the dependents to the dependencies.
+// The inferred edges are dotted.
+func (g *Graph) Mermaid() string {
+	var buf strings.Builder
+	buf.WriteString("flowchart BT\n")
+	nodes := g.Nodes()
+	ids := make(map[*GraphNode]string, len(nodes))
+	for i, node := range nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node] = id
+		label := strings.ReplaceAll(node.Address, `"`, "#quot;")
+		if node.Kind == GraphNodeModule {
+			fmt.Fprintf(&buf, "  %s[[\"%s\"]]\n", id, label)
+		} else {
+			fmt.Fprintf(&buf, "  %s[\"%s\"]\n", id, label)
+		}
+	}
+	for _, node := range nodes {
+		for _, dep := range node.Dependencies() {
+			arrow := "-->"
+			if node.EdgeKind(dep) == GraphEdgeInferred {
+				arrow = "-.->"
+			}
+			fmt.Fprintf(&buf, "  %s %s %s\n", ids[node], arrow, ids[dep])
+		}
+	}
+	return buf.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func sortedNodes(m map[*GraphNode]GraphEdgeKind) []*GraphNode {
+	ret := make([]*GraphNode, 0, len(m))
+	for node := range m {
+		ret = append(ret, node)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Address < ret[j].Address })
+	return ret
+}
@@ -0,0 +1,139 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+)
+
+func nodeAddresses(nodes []*tfstate.GraphNode) []string {
+	var ret []string
+	for _, node := range nodes {
+		ret = append(ret, node.Address)
+	}
+	return ret
+}
+
+func TestGraph(t *testing.T) {
+	g, err := tfstate.NewGraph(loadMutateState(t))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"data.null_data_source.values",
+		`module.app["web"]`,
+		`module.app["web"].module.db`,
+		`module.app["web"].module.db.null_resource.db`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+		"random_password.this",
+		"random_pet.this",
+	}, nodeAddresses(g.Nodes()))
+
+	pet := g.Node("random_pet.this")
+	require.Equal(t, tfstate.GraphNodeResource, pet.Kind)
+	require.Equal(t, []string{"data.null_data_source.values"}, nodeAddresses(pet.Dependencies()))
+	require.Equal(t, []string{
+		`module.app["web"]`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+	}, nodeAddresses(pet.Dependents()))
+
+	module := g.Node(`module.app["web"]`)
+	require.Equal(t, tfstate.GraphNodeModule, module.Kind)
+	require.Equal(t, []string{"random_pet.this"}, nodeAddresses(module.Dependencies()))
+	require.Empty(t, g.Node(`module.app["web"].module.db`).Dependencies())
+
+	dependents, err := g.DependentsOf("data.null_data_source.values")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`module.app["web"]`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+		"random_pet.this",
+	}, nodeAddresses(dependents))
+
+	dependencies, err := g.DependenciesOf(`module.app["web"].null_resource.this`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"data.null_data_source.values", "random_pet.this"}, nodeAddresses(dependencies))
+
+	_, err = g.DependentsOf("random_pet.not_exist")
+	require.Error(t, err)
+
+	require.Empty(t, g.Cycles())
+	order, err := g.TopologicalOrder()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"data.null_data_source.values",
+		`module.app["web"].module.db`,
+		`module.app["web"].module.db.null_resource.db`,
+		"random_password.this",
+		"random_pet.this",
+		`module.app["web"]`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+	}, nodeAddresses(order))
+
+	destroyOrder, err := g.DestroyOrder()
+	require.NoError(t, err)
+	require.Equal(t, `module.app["web"].null_resource.this[1]`, destroyOrder[0].Address)
+	require.Equal(t, "data.null_data_source.values", destroyOrder[len(destroyOrder)-1].Address)
+}
+
+func TestGraphCycles(t *testing.T) {
+	state := loadMutateState(t)
+	resources := stateResources(state)
+	resources["data.null_data_source.values"].DependsOn = []string{`module.app.null_resource.this`}
+	resources["random_password.this"].DependsOn = []string{"random_password.this"}
+
+	g, err := tfstate.NewGraph(state)
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{
+			"data.null_data_source.values",
+			`module.app["web"].null_resource.this[0]`,
+			`module.app["web"].null_resource.this[1]`,
+			"random_pet.this",
+		},
+		{"random_password.this"},
+	}, g.Cycles())
+
+	_, err = g.TopologicalOrder()
+	var cycleErr *tfstate.CycleError
+	require.ErrorAs(t, err, &cycleErr)
+	require.Len(t, cycleErr.Cycles, 2)
+}
+
+func TestGraphExport(t *testing.T) {
+	state := loadMutateState(t)
+	require.NoError(t, state.Remove(`module.app["web"].module.db`))
+	require.NoError(t, state.Remove("random_password.this"))
+	g, err := tfstate.NewGraph(state)
+	require.NoError(t, err)
+
+	require.Equal(t, `digraph {
+  rankdir = "BT"
+  "data.null_data_source.values" [shape = "box"]
+  "module.app[\"web\"]" [shape = "folder"]
+  "module.app[\"web\"].null_resource.this[0]" [shape = "box"]
+  "module.app[\"web\"].null_resource.this[1]" [shape = "box"]
+  "random_pet.this" [shape = "box"]
+  "module.app[\"web\"]" -> "random_pet.this"
+  "module.app[\"web\"].null_resource.this[0]" -> "random_pet.this"
+  "module.app[\"web\"].null_resource.this[1]" -> "random_pet.this"
+  "random_pet.this" -> "data.null_data_source.values"
+}
+`, g.DOT())
+
+	require.Equal(t, `flowchart BT
+  n0["data.null_data_source.values"]
+  n1[["module.app[#quot;web#quot;]"]]
+  n2["module.app[#quot;web#quot;].null_resource.this[0]"]
+  n3["module.app[#quot;web#quot;].null_resource.this[1]"]
+  n4["random_pet.this"]
+  n1 --> n4
+  n2 --> n4
+  n3 --> n4
+  n4 --> n0
+`, g.Mermaid())
+}
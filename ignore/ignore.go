@@ -0,0 +1,234 @@
+// Package ignore suppresses the known-noisy attributes (e.g. "tags_all", "etag" or "last_modified") of the resources
+// when comparing, validating or rendering the state, similar to the `ignore_changes` of the lifecycle block.
+//
+// A rule set is loaded from YAML (or JSON), e.g.
+//
+//	rules:
+//	  - attributes: [tags_all]
+//	  - type: aws_s3_object
+//	    attributes: [etag, last_modified]
+//	  - address: module.app[*].aws_security_group.*
+//	    attributes: ["ingress[*].description"]
+//
+// Each rule applies to the resource instances whose type and address match the globs (all resources if absent),
+// where "*" matches any sequence of characters. The attributes are path expressions (see tfstate.ParsePath), whose
+// wildcards ("[*]" or ".*") match any element of a list, map or set, or any attribute of an object, and ".**" any
+// sequence of steps. An attribute also covers everything nested in it.
+package ignore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule ignores the attributes of the resource instances matching the type and address globs.
+type Rule struct {
+	// Type is the glob of the resource type, which matches all types if empty.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Address is the glob of the resource instance address, which matches all addresses if empty.
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	// Attributes are the attribute path patterns to ignore.
+	Attributes []string `json:"attributes" yaml:"attributes"`
+}
+
+// Rules is a set of ignore rules. A nil Rules ignores nothing.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	Rule
+	paths []cty.Path
+}
+
+// New compiles the rules.
+func New(rules []Rule) (*Rules, error) {
+	ret := &Rules{}
+	for i, r := range rules {
+		cr := rule{Rule: r}
+		for _, attr := range r.Attributes {
+			path, err := tfstate.ParsePath(attr)
+			if err == nil && len(path) == 0 {
+				err = fmt.Errorf("empty path")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid attribute %q: %v", i, attr, err)
+			}
+			cr.paths = append(cr.paths, path)
+		}
+		ret.rules = append(ret.rules, cr)
+	}
+	return ret, nil
+}
+
+// Parse parses the rule set in YAML (or JSON), which has the rules under the "rules" key.
+func Parse(b []byte) (*Rules, error) {
+	var doc struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return New(doc.Rules)
+}
+
+// Load reads and parses the rule set file.
+func Load(path string) (*Rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse ignore rules %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// paths returns the attribute path patterns that apply to the resource instance.
+func (rs *Rules) paths(typ, address string) []cty.Path {
+	if rs == nil {
+		return nil
+	}
+	var ret []cty.Path
+	for _, r := range rs.rules {
+		if r.Type != "" && !matchGlob(r.Type, typ) {
+			continue
+		}
+		if r.Address != "" && !matchGlob(r.Address, address) {
+			continue
+		}
+		ret = append(ret, r.paths...)
+	}
+	return ret
+}
+
+// Ignored tells whether the attribute path of the resource instance is ignored, i.e. it is (or is nested in) an
+// ignored attribute.
+func (rs *Rules) Ignored(typ, address string, path cty.Path) bool {
+	for _, pattern := range rs.paths(typ, address) {
+		for i := len(path); i >= 0; i-- {
+			if tfstate.MatchPath(pattern, path[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Value returns the value of the resource instance, with the ignored attributes set to null, which are then
+// neither rendered nor diffed.
+func (rs *Rules) Value(res *tfstate.StateResource) (cty.Value, error) {
+	patterns := rs.paths(res.Type, res.Address)
+	if len(patterns) == 0 || res.Value == cty.NilVal {
+		return res.Value, nil
+	}
+	return cty.Transform(res.Value, func(path cty.Path, v cty.Value) (cty.Value, error) {
+		for _, pattern := range patterns {
+			if tfstate.MatchPath(pattern, path) {
+				return cty.NullVal(v.Type()), nil
+			}
+		}
+		return v, nil
+	})
+}
+
+// Resource returns a shallow copy of the resource instance, whose value has the ignored attributes set to null. The
+// resource itself is returned if nothing is ignored.
+func (rs *Rules) Resource(res *tfstate.StateResource) (*tfstate.StateResource, error) {
+	if res == nil || len(rs.paths(res.Type, res.Address)) == 0 {
+		return res, nil
+	}
+	val, err := rs.Value(res)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: %v", res.Address, err)
+	}
+	ret := *res
+	ret.Value = val
+	return &ret, nil
+}
+
+// JSONResource returns a copy of the resource instance in the JSON state, whose attribute values have the ignored
+// attributes removed (or set to null for the elements of lists and sets), e.g. to validate it against the schema
+// regardless of the ignored attributes, which might even be absent from the schema. The resource itself is returned if
+// nothing is ignored.
+func (rs *Rules) JSONResource(res *tfjson.StateResource) *tfjson.StateResource {
+	if res == nil {
+		return nil
+	}
+	patterns := rs.paths(res.Type, res.Address)
+	if len(patterns) == 0 {
+		return res
+	}
+	ignored := func(path cty.Path) bool {
+		for _, pattern := range patterns {
+			if tfstate.MatchPath(pattern, path) {
+				return true
+			}
+		}
+		return false
+	}
+	var walk func(v interface{}, path cty.Path) interface{}
+	walk = func(v interface{}, path cty.Path) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			ret := make(map[string]interface{}, len(v))
+			for k, ev := range v {
+				epath := append(path.Copy(), cty.GetAttrStep{Name: k})
+				if !ignored(epath) {
+					ret[k] = walk(ev, epath)
+				}
+			}
+			return ret
+		case []interface{}:
+			ret := make([]interface{}, len(v))
+			for i, ev := range v {
+				epath := append(path.Copy(), cty.IndexStep{Key: cty.NumberIntVal(int64(i))})
+				if !ignored(epath) {
+					ret[i] = walk(ev, epath)
+				}
+			}
+			return ret
+		default:
+			return v
+		}
+	}
+	ret := *res
+	if attrs, ok := walk(res.AttributeValues, nil).(map[string]interface{}); ok {
+		ret.AttributeValues = attrs
+	}
+	return &ret
+}
+
+// matchGlob tells whether the string matches the glob, where "*" matches any sequence of characters, and the other
+// characters match themselves.
+func matchGlob(glob, s string) bool {
+	parts := strings.Split(glob, "*")
+	if len(parts) == 1 {
+		return glob == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
@@ -0,0 +1,136 @@
+package ignore_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/ignore"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const rulesYAML = `
+rules:
+  - attributes: [tags_all]
+  - type: aws_s3_*
+    attributes: [etag, "versions[*].last_modified"]
+  - address: module.app["web"].aws_security_group.*
+    attributes: ["ingress[*].description", "labels[\"x[*]\"]"]
+  - type: google_*
+    attributes: [".**.fingerprint"]
+`
+
+func TestParse(t *testing.T) {
+	rules, err := ignore.Parse([]byte(rulesYAML))
+	require.NoError(t, err)
+
+	cases := []struct {
+		typ, address, path string
+		expect             bool
+	}{
+		{"aws_instance", "aws_instance.a", "tags_all", true},
+		{"aws_instance", "aws_instance.a", `tags_all["env"]`, true},
+		{"aws_instance", "aws_instance.a", "tags", false},
+		{"aws_instance", "aws_instance.a", "etag", false},
+		{"aws_s3_object", "aws_s3_object.a", "etag", true},
+		{"aws_s3_object", "aws_s3_object.a", "versions[3].last_modified", true},
+		{"aws_s3_object", "aws_s3_object.a", "versions.3.last_modified", true},
+		{"aws_s3_object", "aws_s3_object.a", "versions[3].id", false},
+		{"aws_security_group", `module.app["web"].aws_security_group.a`, "ingress[0].description", true},
+		{"aws_security_group", `module.app["web"].aws_security_group.a`, `labels["x[*]"]`, true},
+		{"aws_security_group", `module.app["web"].aws_security_group.a`, `labels["y"]`, false},
+		{"aws_security_group", `module.app["db"].aws_security_group.a`, "ingress[0].description", false},
+		{"google_compute_instance", "google_compute_instance.a", "fingerprint", true},
+		{"google_compute_instance", "google_compute_instance.a", "disk[0].params.fingerprint", true},
+		{"google_compute_instance", "google_compute_instance.a", "disk[0].params", false},
+	}
+	for _, c := range cases {
+		path, err := tfstate.ParsePath(c.path)
+		require.NoError(t, err)
+		require.Equal(t, c.expect, rules.Ignored(c.typ, c.address, path), "%s %s", c.address, c.path)
+	}
+
+	// JSON is also accepted.
+	rules, err = ignore.Parse([]byte(`{"rules": [{"type": "aws_instance", "attributes": ["tags_all"]}]}`))
+	require.NoError(t, err)
+	require.True(t, rules.Ignored("aws_instance", "aws_instance.a", cty.GetAttrPath("tags_all")))
+
+	// An empty document ignores nothing.
+	rules, err = ignore.Parse(nil)
+	require.NoError(t, err)
+	require.False(t, rules.Ignored("aws_instance", "aws_instance.a", cty.GetAttrPath("tags_all")))
+
+	_, err = ignore.Parse([]byte("rules:\n  - attribute: [tags_all]\n"))
+	require.Error(t, err)
+	_, err = ignore.Parse([]byte("rules:\n  - attributes: [\"tags[\"]\n"))
+	require.Error(t, err)
+}
+
+func TestValue(t *testing.T) {
+	rules, err := ignore.New([]ignore.Rule{
+		{Attributes: []string{"tags_all", "rule[*].etag", "meta.*"}},
+	})
+	require.NoError(t, err)
+
+	res := &tfstate.StateResource{
+		Address: "demo.this",
+		Type:    "demo",
+		Value: cty.ObjectVal(map[string]cty.Value{
+			"id":       cty.StringVal("a"),
+			"tags_all": cty.MapVal(map[string]cty.Value{"env": cty.StringVal("dev")}),
+			"rule": cty.SetVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x"), "etag": cty.StringVal("1")}),
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("y"), "etag": cty.StringVal("2")}),
+			}),
+			"meta": cty.MapVal(map[string]cty.Value{"a": cty.StringVal("1"), "b": cty.StringVal("2")}),
+		}),
+	}
+	got, err := rules.Resource(res)
+	require.NoError(t, err)
+	expect := cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("a"),
+		"tags_all": cty.NullVal(cty.Map(cty.String)),
+		"rule": cty.SetVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x"), "etag": cty.NullVal(cty.String)}),
+			cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("y"), "etag": cty.NullVal(cty.String)}),
+		}),
+		"meta": cty.MapVal(map[string]cty.Value{"a": cty.NullVal(cty.String), "b": cty.NullVal(cty.String)}),
+	})
+	require.True(t, expect.RawEquals(got.Value), got.Value.GoString())
+	// The resource itself is not modified.
+	require.False(t, res.Value.GetAttr("tags_all").IsNull())
+
+	// Nothing ignored returns the resource itself.
+	var nilRules *ignore.Rules
+	got, err = nilRules.Resource(res)
+	require.NoError(t, err)
+	require.Same(t, res, got)
+}
+
+func TestJSONResource(t *testing.T) {
+	rules, err := ignore.New([]ignore.Rule{
+		{Type: "demo", Attributes: []string{"removed", "rule[*].etag", "list[1]"}},
+	})
+	require.NoError(t, err)
+	res := &tfjson.StateResource{
+		Address: "demo.this",
+		Type:    "demo",
+		AttributeValues: map[string]interface{}{
+			"id":      "a",
+			"removed": "x",
+			"rule":    []interface{}{map[string]interface{}{"name": "x", "etag": "1"}},
+			"list":    []interface{}{"a", "b"},
+		},
+	}
+	got := rules.JSONResource(res)
+	require.Equal(t, map[string]interface{}{
+		"id":   "a",
+		"rule": []interface{}{map[string]interface{}{"name": "x"}},
+		"list": []interface{}{"a", nil},
+	}, got.AttributeValues)
+	require.Contains(t, res.AttributeValues, "removed")
+
+	res.Type = "other"
+	require.Same(t, res, rules.JSONResource(res))
+}
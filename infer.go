@@ -0,0 +1,118 @@
+package tfstate
+
+import (
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// identifierAttributes are the top level attributes of a resource that are regarded as the identifiers of it,
+// which other resources might refer to.
+var identifierAttributes = []string{"arn", "id", "self_link"}
+
+// minIdentifierLength is the minimum length of an identifier to be indexed, to avoid matching trivial values
+// (e.g. "1", "none").
+const minIdentifierLength = 6
+
+// InferredDependency is a dependency of a resource instance on another one, inferred from that a string value of
+// the former equals to an identifier of the latter.
+type InferredDependency struct {
+	// Address is the address of the depending resource instance.
+	Address string
+	// Path is the path of the referring value in the depending resource instance.
+	Path cty.Path
+	// DependsOn is the address of the resource instance being depended on.
+	DependsOn string
+	// DependsOnPath is the path of the identifier in the resource instance being depended on.
+	DependsOnPath cty.Path
+	// Value is the identifier value.
+	Value string
+}
+
+// InferDependencies infers the dependencies between the resource instances from their values, regardless of
+// their DependsOn.
+//
+// The identifiers of each resource instance are indexed, which are the top level string attributes named "id",
+// "arn" or "self_link", of at least 6 characters. Then every string value in other resource instances (except for
+// their own identifiers) that equals to an indexed identifier results into an inferred dependency. Deposed objects
+// are ignored. The result is sorted by the address and the address being depended on.
+func InferDependencies(state *State) ([]InferredDependency, error) {
+	if state == nil {
+		return nil, nil
+	}
+	instances, err := state.instances()
+	if err != nil {
+		return nil, err
+	}
+
+	type identifier struct {
+		address string
+		path    cty.Path
+	}
+	index := map[string][]identifier{}
+	for _, inst := range instances {
+		val := inst.resource.Value
+		if inst.resource.DeposedKey != "" || val == cty.NilVal || val.IsNull() || !val.IsKnown() || !val.Type().IsObjectType() {
+			continue
+		}
+		for _, name := range identifierAttributes {
+			if !val.Type().HasAttribute(name) {
+				continue
+			}
+			v := val.GetAttr(name)
+			if v.Type() != cty.String || v.IsNull() || !v.IsKnown() || len(v.AsString()) < minIdentifierLength {
+				continue
+			}
+			index[v.AsString()] = append(index[v.AsString()], identifier{
+				address: inst.addr.String(),
+				path:    cty.GetAttrPath(name),
+			})
+		}
+	}
+
+	var ret []InferredDependency
+	for _, inst := range instances {
+		val := inst.resource.Value
+		if inst.resource.DeposedKey != "" || val == cty.NilVal {
+			continue
+		}
+		address := inst.addr.String()
+		err := cty.Walk(val, func(path cty.Path, v cty.Value) (bool, error) {
+			if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+				return true, nil
+			}
+			if len(path) == 1 {
+				if step, ok := path[0].(cty.GetAttrStep); ok {
+					for _, name := range identifierAttributes {
+						if step.Name == name {
+							return true, nil
+						}
+					}
+				}
+			}
+			for _, id := range index[v.AsString()] {
+				if id.address == address {
+					continue
+				}
+				ret = append(ret, InferredDependency{
+					Address:       address,
+					Path:          path.Copy(),
+					DependsOn:     id.address,
+					DependsOnPath: id.path,
+					Value:         v.AsString(),
+				})
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Address != ret[j].Address {
+			return ret[i].Address < ret[j].Address
+		}
+		return ret[i].DependsOn < ret[j].DependsOn
+	})
+	return ret, nil
+}
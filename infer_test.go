@@ -0,0 +1,82 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestInferDependencies(t *testing.T) {
+	state := loadMutateState(t)
+	resources := stateResources(state)
+	for _, res := range resources {
+		res.DependsOn = nil
+	}
+	db := resources[`module.app["web"].module.db.null_resource.db`]
+	db.Value = cty.ObjectVal(map[string]cty.Value{
+		"id": cty.StringVal("6129484611666145821"),
+		"triggers": cty.MapVal(map[string]cty.Value{
+			"upstream": cty.StringVal("5577006791947779410"),
+			// "none" is too short to be an identifier
+			"password": cty.StringVal("none"),
+		}),
+	})
+
+	deps, err := tfstate.InferDependencies(state)
+	require.NoError(t, err)
+	require.Equal(t, []tfstate.InferredDependency{
+		{
+			Address:       `module.app["web"].module.db.null_resource.db`,
+			Path:          cty.GetAttrPath("triggers").Index(cty.StringVal("upstream")),
+			DependsOn:     `module.app["web"].null_resource.this[0]`,
+			DependsOnPath: cty.GetAttrPath("id"),
+			Value:         "5577006791947779410",
+		},
+		{
+			Address:       `module.app["web"].null_resource.this[0]`,
+			Path:          cty.GetAttrPath("triggers").Index(cty.StringVal("pet")),
+			DependsOn:     "random_pet.this",
+			DependsOnPath: cty.GetAttrPath("id"),
+			Value:         "sunny-toucan",
+		},
+		{
+			Address:       `module.app["web"].null_resource.this[1]`,
+			Path:          cty.GetAttrPath("triggers").Index(cty.StringVal("pet")),
+			DependsOn:     "random_pet.this",
+			DependsOnPath: cty.GetAttrPath("id"),
+			Value:         "sunny-toucan",
+		},
+	}, deps)
+
+	g, err := tfstate.NewGraph(state)
+	require.NoError(t, err)
+	require.Empty(t, g.Node("random_pet.this").Dependents())
+	require.NoError(t, g.AddInferredDependencies(deps))
+
+	pet := g.Node("random_pet.this")
+	require.Equal(t, []string{
+		`module.app["web"]`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+	}, nodeAddresses(pet.Dependents()))
+	require.Equal(t, tfstate.GraphEdgeInferred, g.Node(`module.app["web"]`).EdgeKind(pet))
+	require.Equal(t, []string{`module.app["web"].null_resource.this[0]`}, nodeAddresses(g.Node(`module.app["web"].module.db`).Dependencies()))
+
+	require.Error(t, g.AddInferredDependencies([]tfstate.InferredDependency{{Address: "random_pet.not_exist", DependsOn: "random_pet.this"}}))
+}
+
+func TestGraphInferredEdgeKeepsDependsOn(t *testing.T) {
+	state := loadMutateState(t)
+	deps, err := tfstate.InferDependencies(state)
+	require.NoError(t, err)
+	require.Len(t, deps, 2)
+
+	g, err := tfstate.NewGraph(state)
+	require.NoError(t, err)
+	require.NoError(t, g.AddInferredDependencies(deps))
+	node := g.Node(`module.app["web"].null_resource.this[0]`)
+	require.Equal(t, tfstate.GraphEdgeDependsOn, node.EdgeKind(g.Node("random_pet.this")))
+	require.Contains(t, g.DOT(), `"module.app[\"web\"].null_resource.this[0]" -> "random_pet.this"`+"\n")
+}
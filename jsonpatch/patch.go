@@ -0,0 +1,551 @@
+// Package jsonpatch expresses the changes to a cty.Value (e.g. the value of a resource in the state) as a JSON Patch
+// document (RFC 6902), and applies such document to a cty.Value.
+//
+// The values are represented in JSON the same way as the resource values in the state. Paths in the JSON Patch
+// document are JSON Pointers (RFC 6901), which are mapped from and to cty.Path via PointerFromPath and
+// PathFromPointer.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/magodo/tfstate"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+// Operation is an operation of a JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is a JSON Patch document.
+type Patch []Operation
+
+// Diff returns the Patch that transforms the old value into the new value. Both values must be wholly known, and
+// are expected to conform to the same type (e.g. the implied type of the resource schema). Where the types differ,
+// which happens for dynamically-typed attributes, the whole differing value is replaced.
+func Diff(old, new cty.Value) (Patch, error) {
+	var patch Patch
+	if err := diff(&patch, "", nil, old, new); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func diff(patch *Patch, ptr string, path cty.Path, old, new cty.Value) error {
+	if old.RawEquals(new) {
+		return nil
+	}
+	if !old.IsWhollyKnown() || !new.IsWhollyKnown() {
+		return path.NewErrorf("value is not wholly known")
+	}
+
+	ty := old.Type()
+	if old.IsNull() || new.IsNull() || ty.IsPrimitiveType() {
+		return addOp(patch, OpReplace, ptr, new)
+	}
+	if !ty.Equals(new.Type()) && !(ty.IsObjectType() && new.Type().IsObjectType()) {
+		return addOp(patch, OpReplace, ptr, new)
+	}
+
+	switch {
+	case ty.IsObjectType():
+		// The attributes of the two objects only differ for dynamically-typed values.
+		oldAttrs, newAttrs := ty.AttributeTypes(), new.Type().AttributeTypes()
+		names := make([]string, 0, len(oldAttrs))
+		for name := range oldAttrs {
+			names = append(names, name)
+		}
+		for name := range newAttrs {
+			if _, ok := oldAttrs[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, inOld := oldAttrs[name]
+			_, inNew := newAttrs[name]
+			aptr := ptr + "/" + escapeToken(name)
+			switch {
+			case !inNew:
+				*patch = append(*patch, Operation{Op: OpRemove, Path: aptr})
+			case !inOld:
+				if err := addOp(patch, OpAdd, aptr, new.GetAttr(name)); err != nil {
+					return err
+				}
+			default:
+				if err := diff(patch, aptr, path.GetAttr(name), old.GetAttr(name), new.GetAttr(name)); err != nil {
+					return err
+				}
+			}
+		}
+	case ty.IsMapType():
+		oldMap, newMap := old.AsValueMap(), new.AsValueMap()
+		keys := map[string]bool{}
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sortedKeys := make([]string, 0, len(keys))
+		for k := range keys {
+			sortedKeys = append(sortedKeys, k)
+		}
+		sort.Strings(sortedKeys)
+		for _, k := range sortedKeys {
+			ov, inOld := oldMap[k]
+			nv, inNew := newMap[k]
+			kptr := ptr + "/" + escapeToken(k)
+			switch {
+			case !inNew:
+				*patch = append(*patch, Operation{Op: OpRemove, Path: kptr})
+			case !inOld:
+				if err := addOp(patch, OpAdd, kptr, nv); err != nil {
+					return err
+				}
+			default:
+				if err := diff(patch, kptr, path.Index(cty.StringVal(k)), ov, nv); err != nil {
+					return err
+				}
+			}
+		}
+	case ty.IsListType(), ty.IsTupleType():
+		oldElems, newElems := old.AsValueSlice(), new.AsValueSlice()
+		common := len(oldElems)
+		if len(newElems) < common {
+			common = len(newElems)
+		}
+		for i := 0; i < common; i++ {
+			if err := diff(patch, fmt.Sprintf("%s/%d", ptr, i), path.IndexInt(i), oldElems[i], newElems[i]); err != nil {
+				return err
+			}
+		}
+		for i := common; i < len(newElems); i++ {
+			if err := addOp(patch, OpAdd, fmt.Sprintf("%s/%d", ptr, i), newElems[i]); err != nil {
+				return err
+			}
+		}
+		// Remove from the tail so that the indexes of the remaining elements are not shifted.
+		for i := len(oldElems) - 1; i >= common; i-- {
+			*patch = append(*patch, Operation{Op: OpRemove, Path: fmt.Sprintf("%s/%d", ptr, i)})
+		}
+	case ty.IsSetType():
+		for it := old.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if new.HasElement(ev).True() {
+				continue
+			}
+			token, _, err := stepToken(cty.IndexStep{Key: ev}, ty)
+			if err != nil {
+				return path.NewError(err)
+			}
+			*patch = append(*patch, Operation{Op: OpRemove, Path: ptr + "/" + escapeToken(token)})
+		}
+		for it := new.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if old.HasElement(ev).True() {
+				continue
+			}
+			if err := addOp(patch, OpAdd, ptr+"/-", ev); err != nil {
+				return err
+			}
+		}
+	default:
+		return path.NewErrorf("unsupported type %s", ty.FriendlyName())
+	}
+	return nil
+}
+
+func addOp(patch *Patch, op, ptr string, v cty.Value) error {
+	b, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return fmt.Errorf("encoding value for %q: %v", ptr, err)
+	}
+	*patch = append(*patch, Operation{Op: op, Path: ptr, Value: b})
+	return nil
+}
+
+// Apply applies the patch to the value, and returns the new value, which is type checked against the given type
+// (e.g. the implied type of the resource schema). The value must be wholly known and of an object type.
+func Apply(val cty.Value, patch Patch, ty cty.Type) (cty.Value, error) {
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("encoding value: %v", err)
+	}
+	doc, err := decodeJSON(b)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	for i, op := range patch {
+		doc, err = applyOp(doc, ty, op)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("operation %d (%s %q): %v", i, op.Op, op.Path, err)
+		}
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return cty.NilVal, fmt.Errorf("the patched document is not an object")
+	}
+	return tfstate.UnmarshalToCty(obj, ty)
+}
+
+// isProperPrefix tells whether the prefix tokens point to an ancestor of the location of the tokens.
+func isProperPrefix(prefix, tokens []string) bool {
+	if len(prefix) >= len(tokens) {
+		return false
+	}
+	for i, token := range prefix {
+		if tokens[i] != token {
+			return false
+		}
+	}
+	return true
+}
+
+func applyOp(doc interface{}, ty cty.Type, op Operation) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case OpAdd, OpReplace, OpTest:
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		value, err = decodeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+	case OpMove, OpCopy:
+		fromTokens, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == OpMove && isProperPrefix(fromTokens, tokens) {
+			// RFC 6902 4.4: a location can't be moved into one of its children.
+			return nil, fmt.Errorf("from %q is a proper prefix of the path", op.From)
+		}
+		if value, err = get(doc, ty, fromTokens); err != nil {
+			return nil, fmt.Errorf("from: %v", err)
+		}
+		if op.Op == OpCopy {
+			// Decouple the copy from the source, as they are containers shared by reference.
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = decodeJSON(b); err != nil {
+				return nil, err
+			}
+		}
+		if op.Op == OpMove {
+			if doc, err = remove(doc, ty, fromTokens); err != nil {
+				return nil, fmt.Errorf("from: %v", err)
+			}
+		}
+	}
+
+	switch op.Op {
+	case OpAdd, OpMove, OpCopy:
+		return add(doc, ty, tokens, value)
+	case OpRemove:
+		return remove(doc, ty, tokens)
+	case OpReplace:
+		return update(doc, ty, tokens, func(loc location) (interface{}, error) {
+			if !loc.exists {
+				return nil, fmt.Errorf("%q not found", loc.token)
+			}
+			return loc.set(value), nil
+		})
+	case OpTest:
+		actual, err := get(doc, ty, tokens)
+		if err != nil {
+			return nil, err
+		}
+		eq, err := jsonEqual(actual, value)
+		if err != nil {
+			return nil, err
+		}
+		if !eq {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation")
+	}
+}
+
+// get returns the value that the tokens point to in the document.
+func get(doc interface{}, ty cty.Type, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		loc, nty, err := locate(doc, ty, token)
+		if err != nil {
+			return nil, err
+		}
+		if !loc.exists {
+			return nil, fmt.Errorf("%q not found", token)
+		}
+		doc, ty = loc.get(), nty
+	}
+	return doc, nil
+}
+
+// add adds the value to the location that the tokens point to in the document, and returns the new document.
+func add(doc interface{}, ty cty.Type, tokens []string, value interface{}) (interface{}, error) {
+	return update(doc, ty, tokens, func(loc location) (interface{}, error) {
+		return loc.add(value)
+	})
+}
+
+// remove removes the value that the tokens point to in the document, and returns the new document.
+func remove(doc interface{}, ty cty.Type, tokens []string) (interface{}, error) {
+	return update(doc, ty, tokens, func(loc location) (interface{}, error) {
+		if !loc.exists {
+			return nil, fmt.Errorf("%q not found", loc.token)
+		}
+		return loc.remove(), nil
+	})
+}
+
+// update calls f with the location that the tokens point to, and returns the new document with the container of
+// that location replaced by the one returned by f.
+func update(doc interface{}, ty cty.Type, tokens []string, f func(location) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 0 {
+		return f(location{root: true, container: doc, exists: true})
+	}
+	loc, nty, err := locate(doc, ty, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return f(loc)
+	}
+	if !loc.exists {
+		return nil, fmt.Errorf("%q not found", tokens[0])
+	}
+	child, err := update(loc.get(), nty, tokens[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	return loc.set(child), nil
+}
+
+// location is a location inside a container (i.e. a JSON object or array) of the document.
+type location struct {
+	// root indicates the location is the whole document, in which case the container is the document itself.
+	root bool
+
+	container interface{}
+	token     string
+
+	// key is the key of the location if the container is an object.
+	key string
+	// index is the index of the location if the container is an array, which equals to the array length for appending.
+	index int
+
+	exists bool
+}
+
+// locate returns the location that the token points to in the container, together with the type of the value at
+// that location.
+func locate(container interface{}, ty cty.Type, token string) (location, cty.Type, error) {
+	loc := location{container: container, token: token}
+	switch c := container.(type) {
+	case map[string]interface{}:
+		var nty cty.Type
+		switch {
+		case ty.IsObjectType():
+			if !ty.HasAttribute(token) {
+				return loc, cty.NilType, fmt.Errorf("unsupported attribute %q", token)
+			}
+			nty = ty.AttributeType(token)
+		case ty.IsMapType():
+			nty = ty.ElementType()
+		case ty == cty.DynamicPseudoType:
+			nty = cty.DynamicPseudoType
+		default:
+			return loc, cty.NilType, fmt.Errorf("unexpected object for %s", ty.FriendlyName())
+		}
+		loc.key = token
+		_, loc.exists = c[token]
+		return loc, nty, nil
+	case []interface{}:
+		switch {
+		case ty.IsSetType():
+			if token == "-" {
+				loc.index = len(c)
+				return loc, ty.ElementType(), nil
+			}
+			for i, elem := range c {
+				eq, err := jsonTokenEqual(elem, token, ty.ElementType())
+				if err != nil {
+					return loc, cty.NilType, err
+				}
+				if eq {
+					loc.index, loc.exists = i, true
+					return loc, ty.ElementType(), nil
+				}
+			}
+			return loc, cty.NilType, fmt.Errorf("set element %s not found", token)
+		case ty.IsListType(), ty.IsTupleType(), ty == cty.DynamicPseudoType:
+			if token == "-" {
+				loc.index = len(c)
+			} else {
+				idx, err := parseIndex(token)
+				if err != nil {
+					return loc, cty.NilType, err
+				}
+				if idx > len(c) {
+					return loc, cty.NilType, fmt.Errorf("index %d out of range", idx)
+				}
+				loc.index, loc.exists = idx, idx < len(c)
+			}
+			nty := cty.DynamicPseudoType
+			switch {
+			case ty.IsListType():
+				nty = ty.ElementType()
+			case ty.IsTupleType():
+				if loc.index < len(ty.TupleElementTypes()) {
+					nty = ty.TupleElementType(loc.index)
+				}
+			}
+			return loc, nty, nil
+		default:
+			return loc, cty.NilType, fmt.Errorf("unexpected array for %s", ty.FriendlyName())
+		}
+	default:
+		return loc, cty.NilType, fmt.Errorf("can't traverse into a scalar value with %q", token)
+	}
+}
+
+func (l location) get() interface{} {
+	if l.root {
+		return l.container
+	}
+	switch c := l.container.(type) {
+	case map[string]interface{}:
+		return c[l.key]
+	case []interface{}:
+		return c[l.index]
+	}
+	return nil
+}
+
+func (l location) set(v interface{}) interface{} {
+	if l.root {
+		return v
+	}
+	switch c := l.container.(type) {
+	case map[string]interface{}:
+		c[l.key] = v
+		return c
+	case []interface{}:
+		c[l.index] = v
+		return c
+	}
+	return l.container
+}
+
+func (l location) add(v interface{}) (interface{}, error) {
+	if l.root {
+		return v, nil
+	}
+	switch c := l.container.(type) {
+	case map[string]interface{}:
+		c[l.key] = v
+		return c, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(c)+1)
+		ret = append(ret, c[:l.index]...)
+		ret = append(ret, v)
+		ret = append(ret, c[l.index:]...)
+		return ret, nil
+	}
+	return nil, fmt.Errorf("invalid container")
+}
+
+func (l location) remove() interface{} {
+	if l.root {
+		return nil
+	}
+	switch c := l.container.(type) {
+	case map[string]interface{}:
+		delete(c, l.key)
+		return c
+	case []interface{}:
+		ret := make([]interface{}, 0, len(c)-1)
+		ret = append(ret, c[:l.index]...)
+		ret = append(ret, c[l.index+1:]...)
+		return ret
+	}
+	return l.container
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %v", err)
+	}
+	return v, nil
+}
+
+// jsonTokenEqual tells whether the JSON value equals to the set element reference token, given the element type.
+func jsonTokenEqual(v interface{}, token string, ety cty.Type) (bool, error) {
+	tv, err := decodeJSON([]byte(token))
+	if err != nil {
+		return false, fmt.Errorf("invalid set element %q: %v", token, err)
+	}
+	if ety.HasDynamicTypes() {
+		return jsonEqual(v, tv)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	cv, err := ctyjson.Unmarshal(b, ety)
+	if err != nil {
+		return false, nil
+	}
+	ctv, err := ctyjson.Unmarshal([]byte(token), ety)
+	if err != nil {
+		return false, fmt.Errorf("invalid set element %q: %v", token, err)
+	}
+	return cv.Equals(ctv).True(), nil
+}
+
+// jsonEqual tells whether two decoded JSON values are equal, by comparing their encodings, which are canonical
+// in that the object keys are sorted.
+func jsonEqual(a, b interface{}) (bool, error) {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
@@ -0,0 +1,246 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var testType = cty.Object(map[string]cty.Type{
+	"name":  cty.String,
+	"count": cty.Number,
+	"tags":  cty.Map(cty.String),
+	"rules": cty.List(cty.Object(map[string]cty.Type{
+		"port": cty.Number,
+	})),
+	"ips": cty.Set(cty.String),
+	"nets": cty.Set(cty.Object(map[string]cty.Type{
+		"cidr": cty.String,
+	})),
+	"extra": cty.DynamicPseudoType,
+})
+
+func testValue(name string, count int64, tags map[string]cty.Value, ports []int64, ips []string, nets []string, extra cty.Value) cty.Value {
+	tagsVal := cty.MapValEmpty(cty.String)
+	if len(tags) != 0 {
+		tagsVal = cty.MapVal(tags)
+	}
+	rules := cty.ListValEmpty(cty.Object(map[string]cty.Type{"port": cty.Number}))
+	if len(ports) != 0 {
+		var l []cty.Value
+		for _, port := range ports {
+			l = append(l, cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(port)}))
+		}
+		rules = cty.ListVal(l)
+	}
+	ipsVal := cty.SetValEmpty(cty.String)
+	if len(ips) != 0 {
+		var l []cty.Value
+		for _, ip := range ips {
+			l = append(l, cty.StringVal(ip))
+		}
+		ipsVal = cty.SetVal(l)
+	}
+	netsVal := cty.SetValEmpty(cty.Object(map[string]cty.Type{"cidr": cty.String}))
+	if len(nets) != 0 {
+		var l []cty.Value
+		for _, net := range nets {
+			l = append(l, cty.ObjectVal(map[string]cty.Value{"cidr": cty.StringVal(net)}))
+		}
+		netsVal = cty.SetVal(l)
+	}
+	return cty.ObjectVal(map[string]cty.Value{
+		"name":  cty.StringVal(name),
+		"count": cty.NumberIntVal(count),
+		"tags":  tagsVal,
+		"rules": rules,
+		"ips":   ipsVal,
+		"nets":  netsVal,
+		"extra": extra,
+	})
+}
+
+func TestDiffAndApply(t *testing.T) {
+	cases := []struct {
+		name   string
+		old    cty.Value
+		new    cty.Value
+		expect string
+	}{
+		{
+			name:   "no change",
+			old:    testValue("a", 1, nil, nil, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			new:    testValue("a", 1, nil, nil, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			expect: `null`,
+		},
+		{
+			name: "primitives",
+			old:  testValue("a", 1, nil, nil, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			new:  testValue("b", 2, nil, nil, nil, nil, cty.StringVal("x")),
+			expect: `[
+  {"op": "replace", "path": "/count", "value": 2},
+  {"op": "replace", "path": "/extra", "value": "x"},
+  {"op": "replace", "path": "/name", "value": "b"}
+]`,
+		},
+		{
+			name: "map",
+			old:  testValue("a", 1, map[string]cty.Value{"a": cty.StringVal("1"), "b": cty.StringVal("2")}, nil, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			new:  testValue("a", 1, map[string]cty.Value{"b": cty.StringVal("3"), "c/d": cty.StringVal("4")}, nil, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			expect: `[
+  {"op": "remove", "path": "/tags/a"},
+  {"op": "replace", "path": "/tags/b", "value": "3"},
+  {"op": "add", "path": "/tags/c~1d", "value": "4"}
+]`,
+		},
+		{
+			name: "list grow",
+			old:  testValue("a", 1, nil, []int64{80}, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			new:  testValue("a", 1, nil, []int64{81, 443}, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			expect: `[
+  {"op": "replace", "path": "/rules/0/port", "value": 81},
+  {"op": "add", "path": "/rules/1", "value": {"port": 443}}
+]`,
+		},
+		{
+			name: "list shrink",
+			old:  testValue("a", 1, nil, []int64{80, 443, 8080}, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			new:  testValue("a", 1, nil, []int64{80}, nil, nil, cty.NullVal(cty.DynamicPseudoType)),
+			expect: `[
+  {"op": "remove", "path": "/rules/2"},
+  {"op": "remove", "path": "/rules/1"}
+]`,
+		},
+		{
+			name: "set",
+			old:  testValue("a", 1, nil, nil, []string{"1.1.1.1", "2.2.2.2"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+			new:  testValue("a", 1, nil, nil, []string{"2.2.2.2", "3.3.3.3"}, []string{"10.1.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+			expect: `[
+  {"op": "remove", "path": "/ips/\"1.1.1.1\""},
+  {"op": "add", "path": "/ips/-", "value": "3.3.3.3"},
+  {"op": "remove", "path": "/nets/{\"cidr\":\"10.0.0.0~116\"}"},
+  {"op": "add", "path": "/nets/-", "value": {"cidr": "10.1.0.0/16"}}
+]`,
+		},
+		{
+			name: "dynamic",
+			old: testValue("a", 1, nil, nil, nil, nil, cty.ObjectVal(map[string]cty.Value{
+				"foo": cty.StringVal("bar"),
+			})),
+			new: testValue("a", 1, nil, nil, nil, nil, cty.ObjectVal(map[string]cty.Value{
+				"foo": cty.StringVal("baz"),
+			})),
+			expect: `[
+  {"op": "replace", "path": "/extra/foo", "value": "baz"}
+]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch, err := Diff(c.old, c.new)
+			require.NoError(t, err)
+			b, err := json.Marshal(patch)
+			require.NoError(t, err)
+			require.JSONEq(t, c.expect, string(b))
+
+			actual, err := Apply(c.old, patch, testType)
+			require.NoError(t, err)
+			require.True(t, c.new.RawEquals(actual), "got: %#v", actual)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	old := testValue("a", 1, map[string]cty.Value{"env": cty.StringVal("prod")}, []int64{80, 443}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType))
+
+	cases := []struct {
+		name   string
+		patch  string
+		expect cty.Value
+		err    bool
+	}{
+		{
+			name: "test and replace",
+			patch: `[
+  {"op": "test", "path": "/name", "value": "a"},
+  {"op": "replace", "path": "/name", "value": "b"}
+]`,
+			expect: testValue("b", 1, map[string]cty.Value{"env": cty.StringVal("prod")}, []int64{80, 443}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name:  "test failed",
+			patch: `[{"op": "test", "path": "/name", "value": "b"}]`,
+			err:   true,
+		},
+		{
+			name:   "insert into list",
+			patch:  `[{"op": "add", "path": "/rules/0", "value": {"port": 22}}]`,
+			expect: testValue("a", 1, map[string]cty.Value{"env": cty.StringVal("prod")}, []int64{22, 80, 443}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name:   "append to list",
+			patch:  `[{"op": "add", "path": "/rules/-", "value": {"port": 22}}]`,
+			expect: testValue("a", 1, map[string]cty.Value{"env": cty.StringVal("prod")}, []int64{80, 443, 22}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name:   "replace set element",
+			patch:  `[{"op": "replace", "path": "/nets/{\"cidr\": \"10.0.0.0~116\"}/cidr", "value": "10.2.0.0/16"}]`,
+			expect: testValue("a", 1, map[string]cty.Value{"env": cty.StringVal("prod")}, []int64{80, 443}, []string{"1.1.1.1"}, []string{"10.2.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name:   "move",
+			patch:  `[{"op": "move", "from": "/tags/env", "path": "/name"}]`,
+			expect: testValue("prod", 1, nil, []int64{80, 443}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name: "move into its child",
+			patch: `[
+  {"op": "replace", "path": "/extra", "value": [[1], [2]]},
+  {"op": "move", "from": "/extra/0", "path": "/extra/0/0"}
+]`,
+			err: true,
+		},
+		{
+			name:   "copy",
+			patch:  `[{"op": "copy", "from": "/name", "path": "/tags/name"}]`,
+			expect: testValue("a", 1, map[string]cty.Value{"env": cty.StringVal("prod"), "name": cty.StringVal("a")}, []int64{80, 443}, []string{"1.1.1.1"}, []string{"10.0.0.0/16"}, cty.NullVal(cty.DynamicPseudoType)),
+		},
+		{
+			name:  "type mismatch",
+			patch: `[{"op": "replace", "path": "/count", "value": "not a number"}]`,
+			err:   true,
+		},
+		{
+			name:  "unknown attribute",
+			patch: `[{"op": "add", "path": "/foo", "value": "bar"}]`,
+			err:   true,
+		},
+		{
+			name:  "remove absent set element",
+			patch: `[{"op": "remove", "path": "/ips/\"9.9.9.9\""}]`,
+			err:   true,
+		},
+		{
+			name:  "list index out of range",
+			patch: `[{"op": "add", "path": "/rules/5", "value": {"port": 22}}]`,
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var patch Patch
+			require.NoError(t, json.Unmarshal([]byte(c.patch), &patch))
+			actual, err := Apply(old, patch, testType)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, c.expect.RawEquals(actual), "got: %#v", actual)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// PointerFromPath converts a cty.Path into a JSON Pointer (RFC 6901), given the type of the value that the path
+// is applied to.
+//
+// Attribute names, map keys and list/tuple indexes map to the reference tokens as is. As set elements have no
+// index, the element of a set is selected by its content instead, whose reference token is the JSON encoding of
+// the element value.
+func PointerFromPath(path cty.Path, ty cty.Type) (string, error) {
+	var buf strings.Builder
+	for i, step := range path {
+		token, nty, err := stepToken(step, ty)
+		if err != nil {
+			return "", path[:i+1].NewError(err)
+		}
+		buf.WriteString("/")
+		buf.WriteString(escapeToken(token))
+		ty = nty
+	}
+	return buf.String(), nil
+}
+
+// PathFromPointer converts a JSON Pointer (RFC 6901) into a cty.Path, given the type of the value that the
+// pointer is applied to. It is the inverse of PointerFromPath.
+func PathFromPointer(ptr string, ty cty.Type) (cty.Path, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	var path cty.Path
+	for _, token := range tokens {
+		step, nty, err := tokenStep(token, ty)
+		if err != nil {
+			return nil, path.NewError(err)
+		}
+		path = append(path, step)
+		ty = nty
+	}
+	return path, nil
+}
+
+// stepToken returns the reference token of the step, together with the type of the value that the step leads to.
+func stepToken(step cty.PathStep, ty cty.Type) (string, cty.Type, error) {
+	switch step := step.(type) {
+	case cty.GetAttrStep:
+		switch {
+		case ty.IsObjectType():
+			if !ty.HasAttribute(step.Name) {
+				return "", cty.NilType, fmt.Errorf("unsupported attribute %q", step.Name)
+			}
+			return step.Name, ty.AttributeType(step.Name), nil
+		case ty == cty.DynamicPseudoType:
+			return step.Name, cty.DynamicPseudoType, nil
+		default:
+			return "", cty.NilType, fmt.Errorf("can't access attribute %q on %s", step.Name, ty.FriendlyName())
+		}
+	case cty.IndexStep:
+		switch {
+		case ty.IsListType(), ty.IsTupleType():
+			idx, err := indexOf(step.Key)
+			if err != nil {
+				return "", cty.NilType, err
+			}
+			if ty.IsTupleType() {
+				if idx >= len(ty.TupleElementTypes()) {
+					return "", cty.NilType, fmt.Errorf("tuple index %d out of range", idx)
+				}
+				return strconv.Itoa(idx), ty.TupleElementType(idx), nil
+			}
+			return strconv.Itoa(idx), ty.ElementType(), nil
+		case ty.IsMapType():
+			if step.Key.Type() != cty.String || step.Key.IsNull() || !step.Key.IsKnown() {
+				return "", cty.NilType, fmt.Errorf("map key must be a known string")
+			}
+			return step.Key.AsString(), ty.ElementType(), nil
+		case ty.IsSetType():
+			b, err := ctyjson.Marshal(step.Key, ty.ElementType())
+			if err != nil {
+				return "", cty.NilType, fmt.Errorf("encoding set element: %v", err)
+			}
+			return string(b), ty.ElementType(), nil
+		case ty.IsObjectType():
+			if step.Key.Type() != cty.String || step.Key.IsNull() || !step.Key.IsKnown() {
+				return "", cty.NilType, fmt.Errorf("object key must be a known string")
+			}
+			return stepToken(cty.GetAttrStep{Name: step.Key.AsString()}, ty)
+		case ty == cty.DynamicPseudoType:
+			switch step.Key.Type() {
+			case cty.String:
+				return step.Key.AsString(), cty.DynamicPseudoType, nil
+			case cty.Number:
+				idx, err := indexOf(step.Key)
+				if err != nil {
+					return "", cty.NilType, err
+				}
+				return strconv.Itoa(idx), cty.DynamicPseudoType, nil
+			}
+			return "", cty.NilType, fmt.Errorf("unsupported key type %s", step.Key.Type().FriendlyName())
+		default:
+			return "", cty.NilType, fmt.Errorf("can't index %s", ty.FriendlyName())
+		}
+	default:
+		return "", cty.NilType, fmt.Errorf("unsupported path step %#v", step)
+	}
+}
+
+// tokenStep returns the path step of the reference token, together with the type of the value that the step leads to.
+func tokenStep(token string, ty cty.Type) (cty.PathStep, cty.Type, error) {
+	switch {
+	case ty.IsObjectType():
+		if !ty.HasAttribute(token) {
+			return nil, cty.NilType, fmt.Errorf("unsupported attribute %q", token)
+		}
+		return cty.GetAttrStep{Name: token}, ty.AttributeType(token), nil
+	case ty.IsMapType():
+		return cty.IndexStep{Key: cty.StringVal(token)}, ty.ElementType(), nil
+	case ty.IsListType(), ty.IsTupleType():
+		idx, err := parseIndex(token)
+		if err != nil {
+			return nil, cty.NilType, err
+		}
+		if ty.IsTupleType() {
+			if idx >= len(ty.TupleElementTypes()) {
+				return nil, cty.NilType, fmt.Errorf("tuple index %d out of range", idx)
+			}
+			return cty.IndexStep{Key: cty.NumberIntVal(int64(idx))}, ty.TupleElementType(idx), nil
+		}
+		return cty.IndexStep{Key: cty.NumberIntVal(int64(idx))}, ty.ElementType(), nil
+	case ty.IsSetType():
+		v, err := ctyjson.Unmarshal([]byte(token), ty.ElementType())
+		if err != nil {
+			return nil, cty.NilType, fmt.Errorf("decoding set element %q: %v", token, err)
+		}
+		return cty.IndexStep{Key: v}, ty.ElementType(), nil
+	case ty == cty.DynamicPseudoType:
+		// The value type is unknown, an attribute access is assumed as this is how a value is traversed in general.
+		return cty.GetAttrStep{Name: token}, cty.DynamicPseudoType, nil
+	default:
+		return nil, cty.NilType, fmt.Errorf("can't traverse into %s", ty.FriendlyName())
+	}
+}
+
+func indexOf(key cty.Value) (int, error) {
+	if key.Type() != cty.Number || key.IsNull() || !key.IsKnown() {
+		return 0, fmt.Errorf("index must be a known number")
+	}
+	bf := key.AsBigFloat()
+	if !bf.IsInt() || bf.Sign() < 0 || bf.Cmp(big.NewFloat(float64(int(^uint(0)>>1)))) > 0 {
+		return 0, fmt.Errorf("invalid index %s", bf.String())
+	}
+	idx, _ := bf.Int64()
+	return int(idx), nil
+}
+
+func parseIndex(token string) (int, error) {
+	// RFC 6901: array indexes are non-negative integers without leading zeros.
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with \"/\"", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = unescapeToken(token)
+	}
+	return tokens, nil
+}
+
+func escapeToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func unescapeToken(token string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+}
@@ -0,0 +1,101 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestPointer(t *testing.T) {
+	ty := cty.Object(map[string]cty.Type{
+		"name":    cty.String,
+		"a/b~c":   cty.String,
+		"tags":    cty.Map(cty.String),
+		"list":    cty.List(cty.Object(map[string]cty.Type{"port": cty.Number})),
+		"set":     cty.Set(cty.String),
+		"objset":  cty.Set(cty.Object(map[string]cty.Type{"port": cty.Number})),
+		"tuple":   cty.Tuple([]cty.Type{cty.String, cty.Number}),
+		"dynamic": cty.DynamicPseudoType,
+	})
+
+	cases := []struct {
+		name string
+		path cty.Path
+		ptr  string
+	}{
+		{
+			name: "root",
+			path: nil,
+			ptr:  "",
+		},
+		{
+			name: "attribute",
+			path: cty.GetAttrPath("name"),
+			ptr:  "/name",
+		},
+		{
+			name: "escaped attribute",
+			path: cty.GetAttrPath("a/b~c"),
+			ptr:  "/a~1b~0c",
+		},
+		{
+			name: "map key",
+			path: cty.GetAttrPath("tags").Index(cty.StringVal("env/x")),
+			ptr:  "/tags/env~1x",
+		},
+		{
+			name: "list index",
+			path: cty.GetAttrPath("list").IndexInt(1).GetAttr("port"),
+			ptr:  "/list/1/port",
+		},
+		{
+			name: "tuple index",
+			path: cty.GetAttrPath("tuple").IndexInt(1),
+			ptr:  "/tuple/1",
+		},
+		{
+			name: "set element",
+			path: cty.GetAttrPath("set").Index(cty.StringVal("a")),
+			ptr:  `/set/"a"`,
+		},
+		{
+			name: "object set element",
+			path: cty.GetAttrPath("objset").Index(cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)})).GetAttr("port"),
+			ptr:  `/objset/{"port":80}/port`,
+		},
+		{
+			name: "dynamic",
+			path: cty.GetAttrPath("dynamic").GetAttr("foo"),
+			ptr:  "/dynamic/foo",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ptr, err := PointerFromPath(c.path, ty)
+			require.NoError(t, err)
+			require.Equal(t, c.ptr, ptr)
+
+			path, err := PathFromPointer(c.ptr, ty)
+			require.NoError(t, err)
+			require.True(t, c.path.Equals(path), "%#v", path)
+		})
+	}
+}
+
+func TestPointerError(t *testing.T) {
+	ty := cty.Object(map[string]cty.Type{
+		"list": cty.List(cty.String),
+	})
+
+	_, err := PointerFromPath(cty.GetAttrPath("foo"), ty)
+	require.Error(t, err)
+	_, err = PointerFromPath(cty.GetAttrPath("list").Index(cty.StringVal("a")), ty)
+	require.Error(t, err)
+
+	for _, ptr := range []string{"foo", "/foo", "/list/01", "/list/-1", "/list/a"} {
+		_, err = PathFromPointer(ptr, ty)
+		require.Error(t, err, ptr)
+	}
+}
@@ -0,0 +1,208 @@
+package tfstate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Merge merges the states into a new state, which contains all the resources and outputs of the states.
+// It fails if any resource instance object (identified by its address and deposed key) or output exists in more
+// than one of the states. The Terraform version of the merged state is the one of the first state that has it.
+//
+// The resources of the merged state are copies, the states being merged are not modified.
+func Merge(states ...*State) (*State, error) {
+	ret := &State{
+		Values: &StateValues{
+			RootModule: &StateModule{},
+		},
+	}
+
+	var (
+		instances []stateInstance
+		conflicts []string
+		seen      = map[string]bool{}
+	)
+	for _, state := range states {
+		if state == nil {
+			continue
+		}
+		if ret.TerraformVersion == "" {
+			ret.TerraformVersion = state.TerraformVersion
+		}
+		stateInstances, err := state.instances()
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range stateInstances {
+			key := inst.addr.String()
+			if inst.resource.DeposedKey != "" {
+				key += " (deposed " + inst.resource.DeposedKey + ")"
+			}
+			if seen[key] {
+				conflicts = append(conflicts, "resource "+key)
+				continue
+			}
+			seen[key] = true
+			res := copyStateResource(inst.resource)
+			instances = append(instances, stateInstance{addr: inst.addr, resource: res})
+		}
+		if state.Values == nil {
+			continue
+		}
+		for name, output := range state.Values.Outputs {
+			if ret.Values.Outputs == nil {
+				ret.Values.Outputs = map[string]*StateOutput{}
+			}
+			if _, ok := ret.Values.Outputs[name]; ok {
+				conflicts = append(conflicts, "output "+name)
+				continue
+			}
+			if output != nil {
+				v := *output
+				output = &v
+			}
+			ret.Values.Outputs[name] = output
+		}
+	}
+	if len(conflicts) != 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("merge conflicts: %s", strings.Join(conflicts, ", "))
+	}
+	ret.setInstances(instances)
+	return ret, nil
+}
+
+// CrossPartitionDependency is a dependency of a resource instance on a resource that resides in other partitions,
+// which is removed from the depends on of the resource instance by Split.
+type CrossPartitionDependency struct {
+	// Address is the address of the depending resource instance.
+	Address string
+	// Partition is the partition of the depending resource instance.
+	Partition string
+	// DependsOn is the (config) address of the resource being depended on.
+	DependsOn string
+	// DependsOnPartitions are the partitions that the instances of the resource being depended on reside.
+	DependsOnPartitions []string
+}
+
+// Split partitions the state into multiple states, keyed by the partition name returned by the partition function
+// for each resource instance address. The outputs belong to the partition of the root module, which is determined
+// by calling the partition function with the zero Address.
+//
+// The depends on of a resource that crosses partitions, i.e. none of the instances of the resource being depended
+// on is in the same partition, is removed and returned in the report instead. The report is sorted by the address.
+//
+// The resources of the partitioned states are copies, the state being split is not modified.
+func Split(state *State, partition func(addr Address) string) (map[string]*State, []CrossPartitionDependency, error) {
+	ret := map[string]*State{}
+	if state == nil {
+		return ret, nil, nil
+	}
+	newState := func(name string) *State {
+		if s, ok := ret[name]; ok {
+			return s
+		}
+		s := &State{
+			TerraformVersion: state.TerraformVersion,
+			Values: &StateValues{
+				RootModule: &StateModule{},
+			},
+		}
+		ret[name] = s
+		return s
+	}
+
+	instances, err := state.instances()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		partitions          = map[string][]stateInstance{}
+		partitionOrder      []string
+		configAddrPartition = map[string]map[string]bool{}
+	)
+	for _, inst := range instances {
+		name := partition(inst.addr)
+		if _, ok := partitions[name]; !ok {
+			partitionOrder = append(partitionOrder, name)
+		}
+		partitions[name] = append(partitions[name], stateInstance{addr: inst.addr, resource: copyStateResource(inst.resource)})
+
+		configAddr := inst.addr.ConfigAddress()
+		if configAddrPartition[configAddr] == nil {
+			configAddrPartition[configAddr] = map[string]bool{}
+		}
+		configAddrPartition[configAddr][name] = true
+	}
+
+	var report []CrossPartitionDependency
+	for _, name := range partitionOrder {
+		for _, inst := range partitions[name] {
+			if len(inst.resource.DependsOn) == 0 {
+				continue
+			}
+			var deps []string
+			for _, dep := range inst.resource.DependsOn {
+				depPartitions, ok := configAddrPartition[dep]
+				// Keep the dangling references as is, as well as the ones within the same partition.
+				if !ok || depPartitions[name] {
+					deps = append(deps, dep)
+					continue
+				}
+				var names []string
+				for p := range depPartitions {
+					names = append(names, p)
+				}
+				sort.Strings(names)
+				report = append(report, CrossPartitionDependency{
+					Address:             inst.resource.Address,
+					Partition:           name,
+					DependsOn:           dep,
+					DependsOnPartitions: names,
+				})
+			}
+			inst.resource.DependsOn = deps
+		}
+		newState(name).setInstances(partitions[name])
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Address != report[j].Address {
+			return report[i].Address < report[j].Address
+		}
+		return report[i].DependsOn < report[j].DependsOn
+	})
+
+	if state.Values != nil && len(state.Values.Outputs) != 0 {
+		s := newState(partition(Address{}))
+		s.Values.Outputs = map[string]*StateOutput{}
+		for name, output := range state.Values.Outputs {
+			if output != nil {
+				v := *output
+				output = &v
+			}
+			s.Values.Outputs[name] = output
+		}
+	}
+
+	return ret, report, nil
+}
+
+// PartitionByModule is a partition function for Split, which partitions the resources by the top level module
+// instance that they belong to, e.g. `module.a["x"]`. The resources in the root module are in the "" partition.
+func PartitionByModule(addr Address) string {
+	if len(addr.Module) == 0 {
+		return ""
+	}
+	return Address{Module: addr.Module[:1]}.String()
+}
+
+// copyStateResource returns a copy of the resource, which doesn't share the depends on with the original one.
+func copyStateResource(res *StateResource) *StateResource {
+	ret := *res
+	if res.DependsOn != nil {
+		ret.DependsOn = append([]string{}, res.DependsOn...)
+	}
+	return &ret
+}
@@ -0,0 +1,78 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAndMerge(t *testing.T) {
+	state := loadMutateState(t)
+
+	states, report, err := tfstate.Split(state, tfstate.PartitionByModule)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+
+	root := states[""]
+	require.Equal(t, []string{
+		"data.null_data_source.values",
+		"random_password.this",
+		"random_pet.this",
+	}, stateAddresses(root))
+	require.Len(t, root.Values.Outputs, 2)
+	// The dependency within the same partition is kept.
+	require.Equal(t, []string{"data.null_data_source.values"}, stateResources(root)["random_pet.this"].DependsOn)
+
+	app := states[`module.app["web"]`]
+	require.Equal(t, []string{
+		`module.app["web"].module.db.null_resource.db`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+	}, stateAddresses(app))
+	require.Empty(t, app.Values.Outputs)
+	require.Empty(t, stateResources(app)[`module.app["web"].null_resource.this[0]`].DependsOn)
+
+	require.Equal(t, []tfstate.CrossPartitionDependency{
+		{
+			Address:             `module.app["web"].null_resource.this[0]`,
+			Partition:           `module.app["web"]`,
+			DependsOn:           "random_pet.this",
+			DependsOnPartitions: []string{""},
+		},
+		{
+			Address:             `module.app["web"].null_resource.this[1]`,
+			Partition:           `module.app["web"]`,
+			DependsOn:           "random_pet.this",
+			DependsOnPartitions: []string{""},
+		},
+	}, report)
+
+	// The original state is untouched.
+	require.Equal(t, []string{"random_pet.this"}, stateResources(state)[`module.app["web"].null_resource.this[0]`].DependsOn)
+
+	merged, err := tfstate.Merge(root, app)
+	require.NoError(t, err)
+	require.Equal(t, state.TerraformVersion, merged.TerraformVersion)
+	require.Equal(t, stateAddresses(state), stateAddresses(merged))
+	require.Equal(t, stateModuleAddresses(state), stateModuleAddresses(merged))
+	require.Equal(t, state.Values.Outputs, merged.Values.Outputs)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	state := loadMutateState(t)
+	other := loadMutateState(t)
+	require.NoError(t, other.Remove(`module.app["web"]`))
+	require.NoError(t, other.Remove("random_password.this"))
+	require.NoError(t, other.Remove("data.null_data_source.values"))
+
+	_, err := tfstate.Merge(state, other)
+	require.EqualError(t, err, "merge conflicts: output password, output pet, resource random_pet.this")
+
+	other.Values.Outputs = nil
+	require.NoError(t, other.Move("random_pet.this", "random_pet.other"))
+	merged, err := tfstate.Merge(state, other)
+	require.NoError(t, err)
+	require.Contains(t, stateAddresses(merged), "random_pet.other")
+	require.Len(t, stateAddresses(merged), 7)
+}
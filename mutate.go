@@ -0,0 +1,334 @@
+package tfstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stateInstance is a resource instance object in the state, together with its parsed address.
+type stateInstance struct {
+	addr     Address
+	resource *StateResource
+}
+
+// instances returns all the resource instance objects in the state, in the order of a depth-first traversal of
+// the modules.
+func (s *State) instances() ([]stateInstance, error) {
+	if s.Values == nil {
+		return nil, nil
+	}
+	var ret []stateInstance
+	var f func(*StateModule) error
+	f = func(module *StateModule) error {
+		if module == nil {
+			return nil
+		}
+		for _, res := range module.Resources {
+			addr, err := ParseAddress(res.Address)
+			if err != nil {
+				return err
+			}
+			ret = append(ret, stateInstance{addr: addr, resource: res})
+		}
+		for _, module := range module.ChildModules {
+			if err := f(module); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := f(s.Values.RootModule); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// setInstances rebuilds the module tree of the state from the resource instance objects, based on their addresses.
+// Modules that end up having no resource in itself and its descendants are removed.
+func (s *State) setInstances(instances []stateInstance) {
+	if s.Values == nil {
+		s.Values = &StateValues{}
+	}
+	root := s.Values.RootModule
+	if root == nil {
+		root = &StateModule{}
+		s.Values.RootModule = root
+	}
+	root.Resources = nil
+	root.ChildModules = nil
+
+	modules := map[string]*StateModule{"": root}
+	var moduleOf func(addr Address) *StateModule
+	moduleOf = func(addr Address) *StateModule {
+		key := addr.ModuleAddress()
+		if module, ok := modules[key]; ok {
+			return module
+		}
+		module := &StateModule{Address: key}
+		modules[key] = module
+		parent := moduleOf(Address{Module: addr.Module[:len(addr.Module)-1]})
+		parent.ChildModules = append(parent.ChildModules, module)
+		return module
+	}
+	for _, inst := range instances {
+		module := moduleOf(inst.addr)
+		module.Resources = append(module.Resources, inst.resource)
+	}
+}
+
+// Move moves the module instance, resource or resource instance at the "from" address to the "to" address, as
+// `terraform state mv` does.
+//
+//   - A module instance is moved to another module instance, including all its resources and child modules.
+//   - A resource (i.e. address without instance key) is moved to another resource of the same type, including all
+//     its instances, whose keys are kept.
+//   - A resource instance is moved to another resource instance of the same type, where the instance key can be
+//     converted between count (int), for_each (string) and no key. E.g. moving `foo.bar` to `foo.bar[0]`.
+//
+// It fails if the "from" address matches nothing, or the "to" address is already taken. The depends on of
+// other resources are updated in case the whole resource is moved.
+func (s *State) Move(from, to string) error {
+	fromAddr, err := ParseAddress(from)
+	if err != nil {
+		return err
+	}
+	toAddr, err := ParseAddress(to)
+	if err != nil {
+		return err
+	}
+	instances, err := s.instances()
+	if err != nil {
+		return err
+	}
+
+	// newAddrs records the new addresses of the moved instances, keyed by the index of the instances.
+	newAddrs := map[int]Address{}
+
+	switch {
+	case fromAddr.IsModule():
+		if !toAddr.IsModule() {
+			return fmt.Errorf("can't move module %s to a resource address %s", from, to)
+		}
+		if toAddr.ModuleContains(fromAddr.Module) {
+			return fmt.Errorf("can't move module %s into itself", from)
+		}
+		for i, inst := range instances {
+			if !inst.addr.ModuleContains(fromAddr.Module) {
+				continue
+			}
+			addr := inst.addr
+			addr.Module = append(append([]ModuleInstanceStep{}, toAddr.Module...), inst.addr.Module[len(fromAddr.Module):]...)
+			newAddrs[i] = addr
+		}
+		for i, inst := range instances {
+			if _, ok := newAddrs[i]; !ok && inst.addr.ModuleContains(toAddr.Module) {
+				return fmt.Errorf("module %s already exists", to)
+			}
+		}
+	case toAddr.IsModule():
+		return fmt.Errorf("can't move resource %s to a module address %s", from, to)
+	default:
+		if fromAddr.Mode != toAddr.Mode || fromAddr.Type != toAddr.Type {
+			return fmt.Errorf("can't move %s to %s: resource mode or type mismatch", from, to)
+		}
+		if fromAddr.Key == nil && toAddr.Key == nil {
+			// Resource to resource
+			for i, inst := range instances {
+				if !inst.addr.ResourceAddress().Equal(fromAddr) {
+					continue
+				}
+				addr := toAddr
+				addr.Key = inst.addr.Key
+				newAddrs[i] = addr
+			}
+			if len(newAddrs) != 0 && !fromAddr.Equal(toAddr) {
+				for i, inst := range instances {
+					if _, ok := newAddrs[i]; !ok && inst.addr.ResourceAddress().Equal(toAddr) {
+						return fmt.Errorf("resource %s already exists", to)
+					}
+				}
+			}
+			break
+		}
+		// Instance to instance
+		for i, inst := range instances {
+			if inst.addr.Equal(fromAddr) {
+				newAddrs[i] = toAddr
+			}
+		}
+		if len(newAddrs) == 0 {
+			break
+		}
+		for i, inst := range instances {
+			if _, ok := newAddrs[i]; ok {
+				continue
+			}
+			if inst.addr.Equal(toAddr) {
+				return fmt.Errorf("resource instance %s already exists", to)
+			}
+			if inst.addr.ResourceAddress().Equal(toAddr.ResourceAddress()) && !sameKeyKind(inst.addr.Key, toAddr.Key) {
+				return fmt.Errorf("can't move %s to %s: the instance key type mismatches the existing instance %s", from, to, inst.addr)
+			}
+		}
+	}
+
+	if len(newAddrs) == 0 {
+		return fmt.Errorf("no matching object found for %s", from)
+	}
+
+	oldConfigAddrs := map[string]string{}
+	for i, addr := range newAddrs {
+		inst := &instances[i]
+		oldConfigAddrs[inst.addr.ConfigAddress()] = addr.ConfigAddress()
+		inst.addr = addr
+		inst.resource.Address = addr.String()
+		inst.resource.Name = addr.Name
+		inst.resource.Index = jsonIndexKey(addr.Key)
+	}
+	s.setInstances(instances)
+	s.rewriteDependsOn(instances, oldConfigAddrs)
+	return nil
+}
+
+// Remove removes the module instance, resource or resource instance at the address from the state, as
+// `terraform state rm` does. It fails if the address matches nothing. The references to the removed resources in
+// the depends on of the remaining resources are removed.
+func (s *State) Remove(address string) error {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	instances, err := s.instances()
+	if err != nil {
+		return err
+	}
+
+	var (
+		kept    []stateInstance
+		removed = map[string]string{}
+	)
+	for _, inst := range instances {
+		var match bool
+		switch {
+		case addr.IsModule():
+			match = inst.addr.ModuleContains(addr.Module)
+		case addr.Key == nil:
+			match = inst.addr.ResourceAddress().Equal(addr)
+		default:
+			match = inst.addr.Equal(addr)
+		}
+		if match {
+			removed[inst.addr.ConfigAddress()] = ""
+			continue
+		}
+		kept = append(kept, inst)
+	}
+	if len(kept) == len(instances) {
+		return fmt.Errorf("no matching object found for %s", address)
+	}
+	s.setInstances(kept)
+	s.rewriteDependsOn(kept, removed)
+	return nil
+}
+
+// ReplaceProvider replaces the provider of all the resources using the old provider with the new provider, as
+// `terraform state replace-provider` does. The provider source addresses can be in their short form
+// (e.g. "hashicorp/aws"), which are regarded to be from the Terraform registry. It fails if no resource uses
+// the old provider.
+func (s *State) ReplaceProvider(old, new string) error {
+	oldName, err := normalizeProviderSource(old)
+	if err != nil {
+		return err
+	}
+	newName, err := normalizeProviderSource(new)
+	if err != nil {
+		return err
+	}
+	instances, err := s.instances()
+	if err != nil {
+		return err
+	}
+	var found bool
+	for _, inst := range instances {
+		if inst.resource.ProviderName == oldName {
+			inst.resource.ProviderName = newName
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no resource found using provider %s", oldName)
+	}
+	return nil
+}
+
+// rewriteDependsOn rewrites the depends on of the instances, by replacing the config addresses per the mapping.
+// The references are removed if mapped to an empty string. A config address is left untouched if there is still an
+// instance of it, which happens when only part of the instances of a resource is moved or removed.
+func (s *State) rewriteDependsOn(instances []stateInstance, mapping map[string]string) {
+	remaining := map[string]bool{}
+	for _, inst := range instances {
+		remaining[inst.addr.ConfigAddress()] = true
+	}
+	for _, inst := range instances {
+		if len(inst.resource.DependsOn) == 0 {
+			continue
+		}
+		var (
+			deps []string
+			seen = map[string]bool{}
+		)
+		for _, dep := range inst.resource.DependsOn {
+			if newDep, ok := mapping[dep]; ok && !remaining[dep] {
+				dep = newDep
+			}
+			if dep == "" || seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+		inst.resource.DependsOn = deps
+	}
+}
+
+// jsonIndexKey returns the instance key in the form of the "index" decoded from the JSON state, where numbers are float64.
+func jsonIndexKey(key interface{}) interface{} {
+	if i, ok := key.(int); ok {
+		return float64(i)
+	}
+	return key
+}
+
+// sameKeyKind tells whether the two instance keys are of the same kind, i.e. no key, count or for_each.
+func sameKeyKind(a, b interface{}) bool {
+	kind := func(k interface{}) int {
+		switch k.(type) {
+		case nil:
+			return 0
+		case string:
+			return 1
+		default:
+			return 2
+		}
+	}
+	return kind(a) == kind(b)
+}
+
+// normalizeProviderSource returns the fully qualified provider source address, e.g. "hashicorp/aws" results into
+// "registry.terraform.io/hashicorp/aws".
+func normalizeProviderSource(s string) (string, error) {
+	parts := strings.Split(s, "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid provider source address %q", s)
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return TerraformRegistryHost + "/" + s, nil
+	case 3:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid provider source address %q", s)
+	}
+}
@@ -0,0 +1,337 @@
+package tfstate_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadMutateState(t *testing.T) *tfstate.State {
+	state, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), loadOpenTofuSchemas(t))
+	require.NoError(t, err)
+	return state
+}
+
+// stateAddresses returns the sorted addresses of all the resources of the state.
+func stateAddresses(state *tfstate.State) []string {
+	var ret []string
+	for addr := range stateResources(state) {
+		ret = append(ret, addr)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// stateModuleAddresses returns the sorted addresses of all the non-root modules of the state.
+func stateModuleAddresses(state *tfstate.State) []string {
+	var ret []string
+	var f func(*tfstate.StateModule)
+	f = func(module *tfstate.StateModule) {
+		for _, module := range module.ChildModules {
+			ret = append(ret, module.Address)
+			f(module)
+		}
+	}
+	f(state.Values.RootModule)
+	sort.Strings(ret)
+	return ret
+}
+
+func TestStateMove(t *testing.T) {
+	cases := []struct {
+		name      string
+		from      string
+		to        string
+		addresses []string
+		modules   []string
+		dependsOn map[string][]string
+		err       bool
+	}{
+		{
+			name: "module",
+			from: `module.app["web"]`,
+			to:   "module.web",
+			addresses: []string{
+				"data.null_data_source.values",
+				"module.web.module.db.null_resource.db",
+				"module.web.null_resource.this[0]",
+				"module.web.null_resource.this[1]",
+				"random_password.this",
+				"random_pet.this",
+			},
+			modules: []string{"module.web", "module.web.module.db"},
+		},
+		{
+			name: "resource",
+			from: "random_pet.this",
+			to:   "random_pet.that",
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].module.db.null_resource.db`,
+				`module.app["web"].null_resource.this[0]`,
+				`module.app["web"].null_resource.this[1]`,
+				`random_password.this`,
+				`random_pet.that`,
+			},
+			modules: []string{`module.app["web"]`, `module.app["web"].module.db`},
+			dependsOn: map[string][]string{
+				`module.app["web"].null_resource.this[0]`: {"random_pet.that"},
+				`module.app["web"].null_resource.this[1]`: {"random_pet.that"},
+			},
+		},
+		{
+			name: "resource into module",
+			from: `module.app["web"].module.db.null_resource.db`,
+			to:   "null_resource.db",
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].null_resource.this[0]`,
+				`module.app["web"].null_resource.this[1]`,
+				`null_resource.db`,
+				`random_password.this`,
+				`random_pet.this`,
+			},
+			modules: []string{`module.app["web"]`},
+		},
+		{
+			name: "count to for_each",
+			from: `module.app["web"].null_resource.this[1]`,
+			to:   `module.app["web"].null_resource.other["b"]`,
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].module.db.null_resource.db`,
+				`module.app["web"].null_resource.other["b"]`,
+				`module.app["web"].null_resource.this[0]`,
+				`random_password.this`,
+				`random_pet.this`,
+			},
+			modules: []string{`module.app["web"]`, `module.app["web"].module.db`},
+		},
+		{
+			name: "no key to count",
+			from: "random_pet.this",
+			to:   "random_pet.this[0]",
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].module.db.null_resource.db`,
+				`module.app["web"].null_resource.this[0]`,
+				`module.app["web"].null_resource.this[1]`,
+				`random_password.this`,
+				`random_pet.this[0]`,
+			},
+			modules: []string{`module.app["web"]`, `module.app["web"].module.db`},
+		},
+		{
+			name: "no match",
+			from: "random_pet.not_exist",
+			to:   "random_pet.that",
+			err:  true,
+		},
+		{
+			name: "resource exists",
+			from: `module.app["web"].null_resource.this[0]`,
+			to:   `module.app["web"].null_resource.this[1]`,
+			err:  true,
+		},
+		{
+			name: "key type mismatch",
+			from: `module.app["web"].null_resource.this[0]`,
+			to:   `module.app["web"].null_resource.this["a"]`,
+			err:  true,
+		},
+		{
+			name: "type mismatch",
+			from: "random_pet.this",
+			to:   "random_password.that",
+			err:  true,
+		},
+		{
+			name: "module into itself",
+			from: `module.app["web"]`,
+			to:   `module.app["web"].module.nested`,
+			err:  true,
+		},
+		{
+			name: "module to resource",
+			from: `module.app["web"]`,
+			to:   "random_pet.that",
+			err:  true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			state := loadMutateState(t)
+			err := state.Move(tt.from, tt.to)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.addresses, stateAddresses(state))
+			require.Equal(t, tt.modules, stateModuleAddresses(state))
+			resources := stateResources(state)
+			for addr, deps := range tt.dependsOn {
+				require.Equal(t, deps, resources[addr].DependsOn, addr)
+			}
+			for addr, res := range resources {
+				parsed, err := tfstate.ParseAddress(addr)
+				require.NoError(t, err)
+				require.Equal(t, parsed.Name, res.Name)
+				require.EqualValues(t, parsed.Key, res.Index)
+			}
+		})
+	}
+}
+
+func TestStateMovePartialKeepsDependsOn(t *testing.T) {
+	state := loadMutateState(t)
+	require.NoError(t, state.Move(`module.app["web"]`, `module.app["api"]`))
+	require.NoError(t, state.Move(`random_pet.this`, `random_pet.this[0]`))
+	resources := stateResources(state)
+	// The config address of the resource is unchanged, so is the depends on.
+	require.Equal(t, []string{"random_pet.this"}, resources[`module.app["api"].null_resource.this[0]`].DependsOn)
+}
+
+func TestStateRemove(t *testing.T) {
+	cases := []struct {
+		name      string
+		address   string
+		addresses []string
+		modules   []string
+		dependsOn map[string][]string
+		err       bool
+	}{
+		{
+			name:    "module",
+			address: `module.app["web"]`,
+			addresses: []string{
+				"data.null_data_source.values",
+				"random_password.this",
+				"random_pet.this",
+			},
+		},
+		{
+			name:    "nested module",
+			address: `module.app["web"].module.db`,
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].null_resource.this[0]`,
+				`module.app["web"].null_resource.this[1]`,
+				`random_password.this`,
+				`random_pet.this`,
+			},
+			modules: []string{`module.app["web"]`},
+		},
+		{
+			name:    "resource",
+			address: "random_pet.this",
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].module.db.null_resource.db`,
+				`module.app["web"].null_resource.this[0]`,
+				`module.app["web"].null_resource.this[1]`,
+				`random_password.this`,
+			},
+			modules: []string{`module.app["web"]`, `module.app["web"].module.db`},
+			dependsOn: map[string][]string{
+				`module.app["web"].null_resource.this[0]`: nil,
+				`module.app["web"].null_resource.this[1]`: nil,
+			},
+		},
+		{
+			name:    "instance",
+			address: `module.app["web"].null_resource.this[0]`,
+			addresses: []string{
+				`data.null_data_source.values`,
+				`module.app["web"].module.db.null_resource.db`,
+				`module.app["web"].null_resource.this[1]`,
+				`random_password.this`,
+				`random_pet.this`,
+			},
+			modules: []string{`module.app["web"]`, `module.app["web"].module.db`},
+		},
+		{
+			name:    "no match",
+			address: `module.app["api"]`,
+			err:     true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			state := loadMutateState(t)
+			err := state.Remove(tt.address)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.addresses, stateAddresses(state))
+			require.Equal(t, tt.modules, stateModuleAddresses(state))
+			resources := stateResources(state)
+			for addr, deps := range tt.dependsOn {
+				require.Equal(t, deps, resources[addr].DependsOn, addr)
+			}
+		})
+	}
+}
+
+func TestStateReplaceProvider(t *testing.T) {
+	state := loadMutateState(t)
+	require.NoError(t, state.ReplaceProvider("registry.opentofu.org/hashicorp/null", "hashicorp/null"))
+	for addr, res := range stateResources(state) {
+		switch res.Type {
+		case "null_resource", "null_data_source":
+			require.Equal(t, "registry.terraform.io/hashicorp/null", res.ProviderName, addr)
+		default:
+			require.Equal(t, "registry.opentofu.org/hashicorp/random", res.ProviderName, addr)
+		}
+	}
+
+	require.Error(t, state.ReplaceProvider("registry.opentofu.org/hashicorp/null", "hashicorp/null"))
+	require.Error(t, state.ReplaceProvider("null", "hashicorp/null"))
+}
+
+func TestToJSONStateRoundTrip(t *testing.T) {
+	schemas := loadOpenTofuSchemas(t)
+	state := loadMutateState(t)
+	require.NoError(t, state.Move(`module.app["web"]`, "module.web"))
+
+	rawState, err := tfstate.ToJSONState(state)
+	require.NoError(t, err)
+	newState, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+	require.Equal(t, stateAddresses(state), stateAddresses(newState))
+	require.Equal(t, stateModuleAddresses(state), stateModuleAddresses(newState))
+	for addr, res := range stateResources(state) {
+		newRes := stateResources(newState)[addr]
+		require.True(t, res.Value.RawEquals(newRes.Value), addr)
+		require.Equal(t, res.DependsOn, newRes.DependsOn, addr)
+	}
+}
+
+func TestToJSONStateLargeNumber(t *testing.T) {
+	schemas := loadOpenTofuSchemas(t)
+	state := loadMutateState(t)
+	res := stateResources(state)["random_password.this"]
+	vals := res.Value.AsValueMap()
+	vals["length"] = cty.MustParseNumberVal("9007199254740993")
+	res.Value = cty.ObjectVal(vals)
+
+	// The numbers beyond the float64 precision survive the round trips.
+	rawState, err := tfstate.ToJSONState(state)
+	require.NoError(t, err)
+	newState, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+	require.True(t, res.Value.RawEquals(stateResources(newState)["random_password.this"].Value))
+
+	b, err := tfstate.ToRawState(state, "lineage", 1)
+	require.NoError(t, err)
+	newState, err = tfstate.FromRawState(b, schemas)
+	require.NoError(t, err)
+	require.True(t, res.Value.RawEquals(stateResources(newState)["random_password.this"].Value))
+}
@@ -0,0 +1,171 @@
+package tfstate
+
+import (
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Normalize normalizes the value of a resource (or nested block) of the schema block, so that the null and empty
+// collections, which providers write inconsistently, are represented the same way:
+//
+//   - The absent nested blocks of the list, set and map nesting modes are empty collections (rather than null), and
+//     the ones of the group nesting mode are objects of null attributes, as
+//     jsonschema.SchemaBlockTypeEmptyValue tells.
+//   - The empty collection attributes that are optional but not computed are null, which is what an absent attribute
+//     in the configuration is.
+//   - The null collection attributes that are computed (including optional and computed) are empty collections.
+//
+// The required attributes are left as is, except that their nested attributes (if any) are normalized recursively.
+// The unknown values and the values not conforming to the schema are left as is.
+func Normalize(val cty.Value, schema *tfjson.SchemaBlock) cty.Value {
+	if schema == nil || val == cty.NilVal || val.IsNull() || !val.IsKnown() || !val.Type().IsObjectType() {
+		return val
+	}
+	vals := val.AsValueMap()
+	if len(vals) == 0 {
+		return val
+	}
+	normalizeAttributes(vals, schema.Attributes)
+	for name, blockS := range schema.NestedBlocks {
+		if v, ok := vals[name]; ok {
+			vals[name] = normalizeNestedBlock(v, blockS)
+		}
+	}
+	return cty.ObjectVal(vals)
+}
+
+func normalizeNestedBlock(val cty.Value, schema *tfjson.SchemaBlockType) cty.Value {
+	if !val.IsKnown() {
+		return val
+	}
+	switch schema.NestingMode {
+	case tfjson.SchemaNestingModeSingle:
+		return Normalize(val, schema.Block)
+	case tfjson.SchemaNestingModeGroup:
+		if val.IsNull() && val.Type().IsObjectType() {
+			vals := map[string]cty.Value{}
+			for name, aty := range val.Type().AttributeTypes() {
+				vals[name] = cty.NullVal(aty)
+			}
+			val = cty.ObjectVal(vals)
+		}
+		return Normalize(val, schema.Block)
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet, tfjson.SchemaNestingModeMap:
+		if val.IsNull() {
+			if empty, ok := emptyCollection(val.Type()); ok {
+				return empty
+			}
+			return val
+		}
+		return mapElements(val, func(v cty.Value) cty.Value {
+			return Normalize(v, schema.Block)
+		})
+	default:
+		return val
+	}
+}
+
+// normalizeAttributes normalizes the attribute values in place.
+func normalizeAttributes(vals map[string]cty.Value, attrs map[string]*tfjson.SchemaAttribute) {
+	for name, attrS := range attrs {
+		if v, ok := vals[name]; ok {
+			vals[name] = normalizeAttribute(v, attrS)
+		}
+	}
+}
+
+func normalizeAttribute(val cty.Value, schema *tfjson.SchemaAttribute) cty.Value {
+	if !val.IsKnown() {
+		return val
+	}
+	if schema.AttributeNestedType != nil && !val.IsNull() {
+		val = normalizeNestedType(val, schema.AttributeNestedType)
+	}
+	ty := val.Type()
+	if schema.Required || !(ty.IsListType() || ty.IsSetType() || ty.IsMapType()) {
+		return val
+	}
+	switch {
+	case schema.Computed && val.IsNull():
+		if empty, ok := emptyCollection(ty); ok {
+			return empty
+		}
+	case !schema.Computed && !val.IsNull() && val.LengthInt() == 0:
+		return cty.NullVal(ty)
+	}
+	return val
+}
+
+func normalizeNestedType(val cty.Value, schema *tfjson.SchemaNestedAttributeType) cty.Value {
+	normalizeObject := func(v cty.Value) cty.Value {
+		if v.IsNull() || !v.IsKnown() || !v.Type().IsObjectType() {
+			return v
+		}
+		vals := v.AsValueMap()
+		if len(vals) == 0 {
+			return v
+		}
+		normalizeAttributes(vals, schema.Attributes)
+		return cty.ObjectVal(vals)
+	}
+	if schema.NestingMode == tfjson.SchemaNestingModeSingle {
+		return normalizeObject(val)
+	}
+	return mapElements(val, normalizeObject)
+}
+
+// emptyCollection returns the empty value of the collection type (or the structural type that a dynamically typed
+// collection is decoded as), or false for the other types.
+func emptyCollection(ty cty.Type) (cty.Value, bool) {
+	switch {
+	case ty.IsListType():
+		return cty.ListValEmpty(ty.ElementType()), true
+	case ty.IsSetType():
+		return cty.SetValEmpty(ty.ElementType()), true
+	case ty.IsMapType():
+		return cty.MapValEmpty(ty.ElementType()), true
+	case ty.IsTupleType():
+		return cty.EmptyTupleVal, true
+	case ty.IsObjectType():
+		return cty.EmptyObjectVal, true
+	default:
+		return cty.NilVal, false
+	}
+}
+
+// mapElements returns the collection (or structural) value whose elements are mapped by the function, which must
+// keep the element types.
+func mapElements(val cty.Value, fn func(cty.Value) cty.Value) cty.Value {
+	if val.IsNull() || !val.IsKnown() || val.LengthInt() == 0 {
+		return val
+	}
+	ty := val.Type()
+	switch {
+	case ty.IsListType(), ty.IsSetType(), ty.IsTupleType():
+		var elems []cty.Value
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			elems = append(elems, fn(v))
+		}
+		switch {
+		case ty.IsListType():
+			return cty.ListVal(elems)
+		case ty.IsSetType():
+			return cty.SetVal(elems)
+		default:
+			return cty.TupleVal(elems)
+		}
+	case ty.IsMapType(), ty.IsObjectType():
+		elems := map[string]cty.Value{}
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			elems[k.AsString()] = fn(v)
+		}
+		if ty.IsMapType() {
+			return cty.MapVal(elems)
+		}
+		return cty.ObjectVal(elems)
+	default:
+		return val
+	}
+}
@@ -0,0 +1,97 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNormalize(t *testing.T) {
+	ruleType := cty.Object(map[string]cty.Type{"ports": cty.List(cty.Number)})
+	schema := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"tags":  {AttributeType: cty.Map(cty.String), Optional: true},
+			"ids":   {AttributeType: cty.List(cty.String), Computed: true},
+			"zones": {AttributeType: cty.Set(cty.String), Optional: true, Computed: true},
+			"names": {AttributeType: cty.List(cty.String), Required: true},
+			"settings": {
+				AttributeNestedType: &tfjson.SchemaNestedAttributeType{
+					NestingMode: tfjson.SchemaNestingModeList,
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"labels": {AttributeType: cty.List(cty.String), Optional: true},
+					},
+				},
+				Required: true,
+			},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"rule": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"ports": {AttributeType: cty.List(cty.Number), Optional: true},
+					},
+				},
+			},
+			"timeouts": {
+				NestingMode: tfjson.SchemaNestingModeSingle,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"create": {AttributeType: cty.String, Optional: true},
+					},
+				},
+			},
+		},
+	}
+	settingType := cty.Object(map[string]cty.Type{"labels": cty.List(cty.String)})
+
+	input := cty.ObjectVal(map[string]cty.Value{
+		"tags":  cty.MapValEmpty(cty.String),
+		"ids":   cty.NullVal(cty.List(cty.String)),
+		"zones": cty.NullVal(cty.Set(cty.String)),
+		"names": cty.ListValEmpty(cty.String),
+		"settings": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"labels": cty.ListValEmpty(cty.String)}),
+		}),
+		"rule": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"ports": cty.ListValEmpty(cty.Number)}),
+		}),
+		"timeouts": cty.NullVal(cty.Object(map[string]cty.Type{"create": cty.String})),
+	})
+	expect := cty.ObjectVal(map[string]cty.Value{
+		"tags":  cty.NullVal(cty.Map(cty.String)),
+		"ids":   cty.ListValEmpty(cty.String),
+		"zones": cty.SetValEmpty(cty.String),
+		"names": cty.ListValEmpty(cty.String),
+		"settings": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"labels": cty.NullVal(cty.List(cty.String))}),
+		}),
+		"rule": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"ports": cty.NullVal(cty.List(cty.Number))}),
+		}),
+		"timeouts": cty.NullVal(cty.Object(map[string]cty.Type{"create": cty.String})),
+	})
+	require.True(t, expect.RawEquals(tfstate.Normalize(input, schema)), tfstate.Normalize(input, schema).GoString())
+
+	// The absent nested blocks are empty collections.
+	val := cty.ObjectVal(map[string]cty.Value{
+		"tags":     cty.NullVal(cty.Map(cty.String)),
+		"ids":      cty.ListValEmpty(cty.String),
+		"zones":    cty.SetValEmpty(cty.String),
+		"names":    cty.ListValEmpty(cty.String),
+		"settings": cty.ListValEmpty(settingType),
+		"rule":     cty.NullVal(cty.List(ruleType)),
+		"timeouts": cty.NullVal(cty.Object(map[string]cty.Type{"create": cty.String})),
+	})
+	require.True(t, cty.ListValEmpty(ruleType).RawEquals(tfstate.Normalize(val, schema).GetAttr("rule")))
+
+	// Normalizing is idempotent.
+	require.True(t, expect.RawEquals(tfstate.Normalize(expect, schema)))
+
+	// The null and unknown values are left as is.
+	require.True(t, cty.NullVal(cty.DynamicPseudoType).RawEquals(tfstate.Normalize(cty.NullVal(cty.DynamicPseudoType), schema)))
+	require.True(t, cty.DynamicVal.RawEquals(tfstate.Normalize(cty.DynamicVal, schema)))
+}
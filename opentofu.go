@@ -0,0 +1,39 @@
+package tfstate
+
+import (
+	"strings"
+)
+
+const (
+	// TerraformRegistryHost is the host of the provider registry used by Terraform.
+	TerraformRegistryHost = "registry.terraform.io"
+	// OpenTofuRegistryHost is the host of the provider registry used by OpenTofu.
+	OpenTofuRegistryHost = "registry.opentofu.org"
+)
+
+// IsOpenTofuState tells whether the state is produced by OpenTofu, which is the case when any resource in it
+// uses a provider from the OpenTofu registry.
+// An encrypted state file can be detected by opentofu.IsEncryptedState before decoding.
+func IsOpenTofuState(state *State) bool {
+	if state == nil || state.Values == nil {
+		return false
+	}
+	return isOpenTofuModule(state.Values.RootModule)
+}
+
+func isOpenTofuModule(module *StateModule) bool {
+	if module == nil {
+		return false
+	}
+	for _, res := range module.Resources {
+		if strings.HasPrefix(res.ProviderName, OpenTofuRegistryHost+"/") {
+			return true
+		}
+	}
+	for _, module := range module.ChildModules {
+		if isOpenTofuModule(module) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Package opentofu reads the OpenTofu specific formats of the state file.
+//
+// OpenTofu supports client-side state encryption (https://opentofu.org/docs/language/state/encryption/), where the
+// state file is stored as an envelope that holds the encrypted state, together with the metadata of the key providers
+// used to derive the encryption key. This package decrypts such envelope back to the plain state file, which can then
+// be decoded by tfstate.FromRawState.
+//
+// Only the "aes_gcm" encryption method is supported, which is the only method OpenTofu provides.
+package opentofu
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EncryptionVersion is the version of the encrypted state envelope that this package supports.
+const EncryptionVersion = "v0"
+
+// keyProviderMetaPrefix is the prefix of the keys in the envelope's metadata, followed by "<type>.<name>".
+const keyProviderMetaPrefix = "key_provider."
+
+// envelope is the encrypted state file written by OpenTofu.
+type envelope struct {
+	Meta    map[string][]byte `json:"meta"`
+	Data    []byte            `json:"encrypted_data"`
+	Version string            `json:"encryption_version"`
+}
+
+// KeyProvider provides the key to decrypt the state, as the key providers of OpenTofu.
+type KeyProvider interface {
+	// Type returns the type of the key provider, e.g. "pbkdf2". It is used to pick up the metadata stored by the
+	// key provider of the same type from the envelope.
+	Type() string
+
+	// DecryptionKey returns the key to decrypt the state, given the metadata stored in the envelope by the key
+	// provider. The meta is nil in case no metadata is stored.
+	DecryptionKey(meta []byte) ([]byte, error)
+}
+
+// IsEncryptedState tells whether the data is an OpenTofu encrypted state envelope.
+func IsEncryptedState(data []byte) bool {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return false
+	}
+	return env.Version != ""
+}
+
+// DecryptState decrypts the OpenTofu encrypted state envelope, and returns the plain state file.
+//
+// The envelope can contain metadata of multiple key providers (e.g. during key rotation), in which case every
+// metadata stored by a key provider of the same type as kp is tried in turn.
+func DecryptState(data []byte, kp KeyProvider) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("unmarshal encrypted state: %v", err)
+	}
+	if env.Version == "" {
+		return nil, fmt.Errorf("not an encrypted state")
+	}
+	if env.Version != EncryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %q", env.Version)
+	}
+
+	var metas [][]byte
+	var keys []string
+	for k := range env.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasPrefix(k, keyProviderMetaPrefix+kp.Type()+".") {
+			metas = append(metas, env.Meta[k])
+		}
+	}
+	if len(metas) == 0 {
+		metas = append(metas, nil)
+	}
+
+	var errs []string
+	for _, meta := range metas {
+		key, err := kp.DecryptionKey(meta)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("retrieving decryption key: %v", err))
+			continue
+		}
+		plain, err := decryptAESGCM(key, env.Data)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("decrypting state: %s", strings.Join(errs, "; "))
+}
+
+func decryptAESGCM(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating AES cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %v", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data: %v", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,55 @@
+package opentofu
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptState(t *testing.T) {
+	data, err := os.ReadFile("../testdata/opentofu/terraform.tfstate.encrypted")
+	require.NoError(t, err)
+	expect, err := os.ReadFile("../testdata/opentofu/terraform.tfstate")
+	require.NoError(t, err)
+
+	require.True(t, IsEncryptedState(data))
+	require.False(t, IsEncryptedState(expect))
+
+	actual, err := DecryptState(data, PBKDF2KeyProvider{Passphrase: "correct-horse-battery-staple"})
+	require.NoError(t, err)
+	require.Equal(t, expect, actual)
+
+	_, err = DecryptState(data, PBKDF2KeyProvider{Passphrase: "wrong"})
+	require.Error(t, err)
+
+	_, err = DecryptState(expect, PBKDF2KeyProvider{Passphrase: "correct-horse-battery-staple"})
+	require.Error(t, err)
+}
+
+func TestDecryptStateStaticKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	plain := []byte(`{"version": 4}`)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	data, err := json.Marshal(envelope{
+		Meta:    map[string][]byte{},
+		Data:    gcm.Seal(nonce, nonce, plain, nil),
+		Version: EncryptionVersion,
+	})
+	require.NoError(t, err)
+
+	actual, err := DecryptState(data, StaticKeyProvider{Key: key})
+	require.NoError(t, err)
+	require.Equal(t, plain, actual)
+
+	_, err = DecryptState(data, StaticKeyProvider{Key: []byte("fedcba9876543210fedcba9876543210")})
+	require.Error(t, err)
+}
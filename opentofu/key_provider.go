@@ -0,0 +1,80 @@
+package opentofu
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// StaticKeyProvider is a KeyProvider that always returns the same key, as the "static" key provider of OpenTofu.
+type StaticKeyProvider struct {
+	Key []byte
+}
+
+var _ KeyProvider = StaticKeyProvider{}
+
+func (p StaticKeyProvider) Type() string {
+	return "static"
+}
+
+func (p StaticKeyProvider) DecryptionKey(_ []byte) ([]byte, error) {
+	return p.Key, nil
+}
+
+// PBKDF2KeyProvider is a KeyProvider that derives the key from a passphrase, as the "pbkdf2" key provider of OpenTofu.
+// The salt, iterations, hash function and key length are read from the metadata stored in the envelope.
+type PBKDF2KeyProvider struct {
+	Passphrase string
+}
+
+var _ KeyProvider = PBKDF2KeyProvider{}
+
+// PBKDF2Metadata is the metadata stored by the "pbkdf2" key provider.
+type PBKDF2Metadata struct {
+	Salt         []byte `json:"salt"`
+	Iterations   int    `json:"iterations"`
+	HashFunction string `json:"hash_function"`
+	KeyLength    int    `json:"key_length"`
+}
+
+func (p PBKDF2KeyProvider) Type() string {
+	return "pbkdf2"
+}
+
+func (p PBKDF2KeyProvider) DecryptionKey(meta []byte) ([]byte, error) {
+	if meta == nil {
+		return nil, fmt.Errorf("no pbkdf2 metadata found")
+	}
+	var m PBKDF2Metadata
+	if err := json.Unmarshal(meta, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal pbkdf2 metadata: %v", err)
+	}
+	return m.Key(p.Passphrase)
+}
+
+// Key derives the key from the passphrase with the parameters of the metadata.
+func (m PBKDF2Metadata) Key(passphrase string) ([]byte, error) {
+	var h func() hash.Hash
+	switch m.HashFunction {
+	case "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported hash function %q", m.HashFunction)
+	}
+	if len(m.Salt) == 0 {
+		return nil, fmt.Errorf("empty salt")
+	}
+	if m.Iterations <= 0 {
+		return nil, fmt.Errorf("invalid iterations %d", m.Iterations)
+	}
+	if m.KeyLength <= 0 {
+		return nil, fmt.Errorf("invalid key length %d", m.KeyLength)
+	}
+	return pbkdf2.Key([]byte(passphrase), m.Salt, m.Iterations, m.KeyLength, h), nil
+}
@@ -0,0 +1,177 @@
+package tfstate_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/opentofu"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadOpenTofuSchemas(t *testing.T) *tfjson.ProviderSchemas {
+	b, err := os.ReadFile("testdata/opentofu/schemas.json")
+	require.NoError(t, err)
+	var schemas tfjson.ProviderSchemas
+	require.NoError(t, json.Unmarshal(b, &schemas))
+	return &schemas
+}
+
+func loadOpenTofuJSONState(t *testing.T) *tfjson.State {
+	b, err := os.ReadFile("testdata/opentofu/state.json")
+	require.NoError(t, err)
+	var state tfjson.State
+	require.NoError(t, json.Unmarshal(b, &state))
+	return &state
+}
+
+// stateResources returns all the resources of the state, keyed by their addresses.
+func stateResources(state *tfstate.State) map[string]*tfstate.StateResource {
+	ret := map[string]*tfstate.StateResource{}
+	var f func(*tfstate.StateModule)
+	f = func(module *tfstate.StateModule) {
+		if module == nil {
+			return
+		}
+		for _, res := range module.Resources {
+			ret[res.Address] = res
+		}
+		for _, module := range module.ChildModules {
+			f(module)
+		}
+	}
+	f(state.Values.RootModule)
+	return ret
+}
+
+func TestFromJSONStateOpenTofu(t *testing.T) {
+	state, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), loadOpenTofuSchemas(t))
+	require.NoError(t, err)
+	require.True(t, tfstate.IsOpenTofuState(state))
+	require.Equal(t, "1.8.0", state.TerraformVersion)
+
+	resources := stateResources(state)
+	require.Len(t, resources, 6)
+
+	pet := resources["random_pet.this"]
+	require.NotNil(t, pet)
+	require.Equal(t, "registry.opentofu.org/hashicorp/random", pet.ProviderName)
+	require.Equal(t, []string{"data.null_data_source.values"}, pet.DependsOn)
+	require.True(t, cty.ObjectVal(map[string]cty.Value{
+		"id": cty.StringVal("sunny-toucan"),
+		"keepers": cty.MapVal(map[string]cty.Value{
+			"env": cty.StringVal("test"),
+		}),
+		"length":    cty.NumberIntVal(2),
+		"prefix":    cty.NullVal(cty.String),
+		"separator": cty.StringVal("-"),
+	}).RawEquals(pet.Value), pet.Value.GoString())
+
+	require.True(t, resources[`module.app["web"].null_resource.this[1]`].Tainted)
+	require.Contains(t, resources, `module.app["web"].module.db.null_resource.db`)
+	require.Equal(t, tfjson.DataResourceMode, resources["data.null_data_source.values"].Mode)
+
+	require.True(t, state.Values.Outputs["password"].Sensitive)
+	require.Equal(t, "sunny-toucan", state.Values.Outputs["pet"].Value)
+}
+
+func TestFromJSONStateOpenTofuWithTerraformSchemas(t *testing.T) {
+	// The schemas retrieved by Terraform are keyed by the providers from the Terraform registry.
+	schemas := loadOpenTofuSchemas(t)
+	for name, schema := range schemas.Schemas {
+		delete(schemas.Schemas, name)
+		schemas.Schemas[strings.Replace(name, tfstate.OpenTofuRegistryHost, tfstate.TerraformRegistryHost, 1)] = schema
+	}
+	state, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), schemas)
+	require.NoError(t, err)
+	require.Len(t, stateResources(state), 6)
+}
+
+func TestFromRawStateOpenTofu(t *testing.T) {
+	schemas := loadOpenTofuSchemas(t)
+	expect, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), schemas)
+	require.NoError(t, err)
+
+	assertSameState := func(t *testing.T, actual *tfstate.State) {
+		require.True(t, tfstate.IsOpenTofuState(actual))
+		require.Equal(t, expect.TerraformVersion, actual.TerraformVersion)
+		require.Equal(t, expect.Values.Outputs, actual.Values.Outputs)
+
+		expectResources, actualResources := stateResources(expect), stateResources(actual)
+		require.Len(t, actualResources, len(expectResources))
+		for addr, expectRes := range expectResources {
+			actualRes, ok := actualResources[addr]
+			require.True(t, ok, addr)
+			require.Equal(t, expectRes.Mode, actualRes.Mode, addr)
+			require.Equal(t, expectRes.Type, actualRes.Type, addr)
+			require.Equal(t, expectRes.Name, actualRes.Name, addr)
+			require.Equal(t, expectRes.Index, actualRes.Index, addr)
+			require.Equal(t, expectRes.ProviderName, actualRes.ProviderName, addr)
+			require.Equal(t, expectRes.SchemaVersion, actualRes.SchemaVersion, addr)
+			require.Equal(t, expectRes.DependsOn, actualRes.DependsOn, addr)
+			require.Equal(t, expectRes.Tainted, actualRes.Tainted, addr)
+			require.True(t, expectRes.Value.RawEquals(actualRes.Value), addr)
+		}
+		require.JSONEq(t, `{"bcrypt_hash":true,"result":true}`, string(stateResources(actual)["random_password.this"].SensitiveValues))
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/opentofu/terraform.tfstate")
+		require.NoError(t, err)
+		actual, err := tfstate.FromRawState(b, schemas)
+		require.NoError(t, err)
+		assertSameState(t, actual)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		b, err := os.ReadFile("testdata/opentofu/terraform.tfstate.encrypted")
+		require.NoError(t, err)
+		require.True(t, opentofu.IsEncryptedState(b))
+		b, err = opentofu.DecryptState(b, opentofu.PBKDF2KeyProvider{Passphrase: "correct-horse-battery-staple"})
+		require.NoError(t, err)
+		actual, err := tfstate.FromRawState(b, schemas)
+		require.NoError(t, err)
+		assertSameState(t, actual)
+	})
+}
+
+func TestFromRawStateLargeNumber(t *testing.T) {
+	b, err := os.ReadFile("testdata/opentofu/terraform.tfstate")
+	require.NoError(t, err)
+	s := strings.Replace(string(b), `"length": 12`, `"length": 9007199254740993`, 1)
+	s = strings.Replace(s, `"value": "sunny-toucan",
+      "type": "string"`, `"value": 9007199254740993,
+      "type": "number"`, 1)
+
+	// The numbers beyond the float64 precision are kept.
+	state, err := tfstate.FromRawState([]byte(s), loadOpenTofuSchemas(t))
+	require.NoError(t, err)
+	length := stateResources(state)["random_password.this"].Value.GetAttr("length")
+	require.Equal(t, "9007199254740993", length.AsBigFloat().Text('f', -1))
+	require.Equal(t, json.Number("9007199254740993"), state.Values.Outputs["pet"].Value)
+}
+
+func TestToRawStateOpenTofu(t *testing.T) {
+	schemas := loadOpenTofuSchemas(t)
+	b, err := os.ReadFile("testdata/opentofu/terraform.tfstate")
+	require.NoError(t, err)
+	state, err := tfstate.FromRawState(b, schemas)
+	require.NoError(t, err)
+
+	out, err := tfstate.ToRawState(state, "3f3c2a83-6a1e-4b2b-9b6e-0c0a3c1c5f1d", 10)
+	require.NoError(t, err)
+
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &raw))
+	require.EqualValues(t, 4, raw["version"])
+	require.EqualValues(t, 10, raw["serial"])
+	require.Equal(t, "3f3c2a83-6a1e-4b2b-9b6e-0c0a3c1c5f1d", raw["lineage"])
+
+	newState, err := tfstate.FromRawState(out, schemas)
+	require.NoError(t, err)
+	require.Equal(t, state, newState)
+}
@@ -0,0 +1,134 @@
+package tfstate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// FromJSONStateParallel is the same as FromJSONState, except that the resources are converted concurrently by at most
+// parallelism workers (a non-positive parallelism means one worker). The order of the resources and modules is the
+// same as the input. The conversion stops when the context is cancelled, in which case the context error is returned.
+func FromJSONStateParallel(ctx context.Context, rawState *tfjson.State, schemas *tfjson.ProviderSchemas, parallelism int) (*State, error) {
+	return FromJSONStateContext(ctx, rawState, schemas, ConvertOptions{Parallelism: parallelism})
+}
+
+// FromJSONStateModuleParallel is the same as FromJSONStateModule, except that the resources of the module and its
+// descendants are converted concurrently. See FromJSONStateParallel for details.
+func FromJSONStateModuleParallel(ctx context.Context, module *tfjson.StateModule, schemas *tfjson.ProviderSchemas, parallelism int) (*StateModule, error) {
+	return fromJSONStateModuleContext(ctx, module, schemas, ConvertOptions{Parallelism: parallelism})
+}
+
+func fromJSONStateModuleContext(ctx context.Context, module *tfjson.StateModule, schemas *tfjson.ProviderSchemas, opts ConvertOptions) (*StateModule, error) {
+	if module == nil {
+		return nil, nil
+	}
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	// Build the module tree first, whose resource slots are then filled by the workers.
+	type job struct {
+		resource *tfjson.StateResource
+		slot     **StateResource
+		// depth is the depth of the module containing the resource, which is used to wrap the error once per module.
+		depth int
+	}
+	var jobs []job
+	var build func(module *tfjson.StateModule, depth int) *StateModule
+	build = func(module *tfjson.StateModule, depth int) *StateModule {
+		if module == nil {
+			return nil
+		}
+		ret := &StateModule{
+			Address: module.Address,
+		}
+		if size := len(module.Resources); size > 0 {
+			ret.Resources = make([]*StateResource, size)
+			for i, resource := range module.Resources {
+				jobs = append(jobs, job{resource: resource, slot: &ret.Resources[i], depth: depth})
+			}
+		}
+		if size := len(module.ChildModules); size > 0 {
+			ret.ChildModules = make([]*StateModule, size)
+			for i, module := range module.ChildModules {
+				ret.ChildModules[i] = build(module, depth+1)
+			}
+		}
+		return ret
+	}
+	ret := build(module, 0)
+
+	var (
+		mu sync.Mutex
+		// failed is the index of the first failed job, the jobs after which are skipped. The jobs before it still
+		// run, so that the reported error is the first one in the input order, regardless of the parallelism.
+		failed = len(jobs)
+		err    error
+		done   int
+	)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				mu.Lock()
+				skip := i > failed
+				mu.Unlock()
+				if skip {
+					continue
+				}
+				j := jobs[i]
+				res, jerr := FromJSONStateResource(j.resource, schemas)
+				if jerr != nil {
+					jerr = fmt.Errorf("converting json state for resource: %v", jerr)
+					for d := 0; d < j.depth; d++ {
+						jerr = fmt.Errorf("converting json state for module: %v", jerr)
+					}
+					mu.Lock()
+					if i < failed {
+						failed, err = i, jerr
+					}
+					mu.Unlock()
+					continue
+				}
+				*j.slot = res
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(done, len(jobs))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var ctxErr error
+feed:
+	for i := range jobs {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+	return ret, nil
+}
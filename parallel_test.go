@@ -0,0 +1,110 @@
+package tfstate_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parallelTestState returns a state of n resources in the root module and n resources in each of the m child modules.
+func parallelTestState(n, m int) (*tfjson.State, *tfjson.ProviderSchemas) {
+	schemas := &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/magodo/demo": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"demo_resource_foo": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"id":   {AttributeType: cty.String, Computed: true},
+								"tags": {AttributeType: cty.Map(cty.String), Optional: true},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	resources := func(module string) []*tfjson.StateResource {
+		var ret []*tfjson.StateResource
+		for i := 0; i < n; i++ {
+			ret = append(ret, &tfjson.StateResource{
+				Address:      fmt.Sprintf("%sdemo_resource_foo.test[%d]", module, i),
+				Mode:         tfjson.ManagedResourceMode,
+				Type:         "demo_resource_foo",
+				Name:         "test",
+				Index:        float64(i),
+				ProviderName: "registry.terraform.io/magodo/demo",
+				AttributeValues: map[string]interface{}{
+					"id":   fmt.Sprintf("%s%d", module, i),
+					"tags": map[string]interface{}{"index": fmt.Sprint(i)},
+				},
+			})
+		}
+		return ret
+	}
+	root := &tfjson.StateModule{Resources: resources("")}
+	for i := 0; i < m; i++ {
+		address := fmt.Sprintf("module.mod%d", i)
+		root.ChildModules = append(root.ChildModules, &tfjson.StateModule{
+			Address:   address,
+			Resources: resources(address + "."),
+		})
+	}
+	return &tfjson.State{
+		TerraformVersion: "1.5.0",
+		Values: &tfjson.StateValues{
+			RootModule: root,
+			Outputs: map[string]*tfjson.StateOutput{
+				"foo": {Value: "bar"},
+			},
+		},
+	}, schemas
+}
+
+func TestFromJSONStateParallel(t *testing.T) {
+	rawState, schemas := parallelTestState(50, 4)
+	expect, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+
+	for _, parallelism := range []int{0, 1, 4, 100} {
+		t.Run(fmt.Sprint(parallelism), func(t *testing.T) {
+			actual, err := tfstate.FromJSONStateParallel(context.Background(), rawState, schemas, parallelism)
+			require.NoError(t, err)
+			require.Equal(t, expect, actual)
+		})
+	}
+
+	// The OpenTofu fixture has resources with nested blocks and identities.
+	tofuExpect, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), loadOpenTofuSchemas(t))
+	require.NoError(t, err)
+	actual, err := tfstate.FromJSONStateParallel(context.Background(), loadOpenTofuJSONState(t), loadOpenTofuSchemas(t), 3)
+	require.NoError(t, err)
+	require.Equal(t, tofuExpect, actual)
+}
+
+func TestFromJSONStateParallelError(t *testing.T) {
+	rawState, schemas := parallelTestState(20, 3)
+	// Break two resources, the error of the first one in order is reported.
+	rawState.Values.RootModule.ChildModules[2].Resources[5].Type = "demo_resource_bar"
+	rawState.Values.RootModule.ChildModules[1].Resources[10].AttributeValues["unknown"] = "foo"
+
+	_, expect := tfstate.FromJSONState(rawState, schemas)
+	require.Error(t, expect)
+	for i := 0; i < 10; i++ {
+		_, err := tfstate.FromJSONStateParallel(context.Background(), rawState, schemas, 8)
+		require.EqualError(t, err, expect.Error())
+	}
+}
+
+func TestFromJSONStateParallelCancel(t *testing.T) {
+	rawState, schemas := parallelTestState(50, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := tfstate.FromJSONStateParallel(ctx, rawState, schemas, 4)
+	require.ErrorIs(t, err, context.Canceled)
+}
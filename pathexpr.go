@@ -0,0 +1,387 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// The wildcard steps of the path expressions, which are attribute steps named what no attribute is named.
+var (
+	// WildcardStep matches any attribute of an object, or any element of a list, map, set or tuple.
+	WildcardStep = cty.GetAttrStep{Name: "*"}
+	// RecursiveWildcardStep matches any sequence of zero or more steps.
+	RecursiveWildcardStep = cty.GetAttrStep{Name: "**"}
+)
+
+// ParsePath parses the path expression, in the format that the errors (e.g. PathError) report the paths, e.g.
+// `.a.b[0]["key"]`, where the leading dot is optional. The expression can have the wildcards, i.e. `[*]` (or `.*`)
+// matching any attribute or element, and `.**` matching any sequence of zero or more steps, which are parsed as
+// WildcardStep and RecursiveWildcardStep. A set element is indexed by the JSON of the element itself, e.g.
+// `.rule[{"name":"x","port":80}]`. An empty string is the empty path.
+func ParsePath(s string) (cty.Path, error) {
+	var path cty.Path
+	for i := 0; i < len(s); {
+		if s[i] == '[' {
+			end := indexEnd(s, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed index at offset %d", i)
+			}
+			key := strings.TrimSpace(s[i+1 : end])
+			step, err := parseIndex(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %s at offset %d: %v", key, i, err)
+			}
+			path = append(path, step)
+			i = end + 1
+			continue
+		}
+		if s[i] == '.' {
+			i++
+		} else if len(path) != 0 {
+			return nil, fmt.Errorf("unexpected %q at offset %d", s[i], i)
+		}
+		end := strings.IndexAny(s[i:], ".[")
+		if end < 0 {
+			end = len(s) - i
+		}
+		name := s[i : i+end]
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("empty attribute name at offset %d", i)
+		case name != WildcardStep.Name && name != RecursiveWildcardStep.Name && !validAttributeName(name):
+			return nil, fmt.Errorf("invalid attribute name %q at offset %d", name, i)
+		}
+		path = append(path, cty.GetAttrStep{Name: name})
+		i += end
+	}
+	return path, nil
+}
+
+// indexEnd returns the offset of the "]" that closes the index starting at the offset, skipping the quoted strings
+// and the nested brackets and braces of the JSON keys, or -1 if it is unclosed.
+func indexEnd(s string, start int) int {
+	depth := 0
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '[', '{':
+			depth++
+		case '}':
+			depth--
+		case ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func parseIndex(key string) (cty.PathStep, error) {
+	if key == WildcardStep.Name {
+		return WildcardStep, nil
+	}
+	switch {
+	case key == "":
+		return nil, fmt.Errorf("empty index")
+	case key[0] == '"':
+		var k string
+		if err := json.Unmarshal([]byte(key), &k); err != nil {
+			return nil, err
+		}
+		return cty.IndexStep{Key: cty.StringVal(k)}, nil
+	case key[0] == '{' || key[0] == '[' || key == "true" || key == "false":
+		ty, err := ctyjson.ImpliedType([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		v, err := ctyjson.Unmarshal([]byte(key), ty)
+		if err != nil {
+			return nil, err
+		}
+		return cty.IndexStep{Key: v}, nil
+	default:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("not a non-negative integer, a string or a set element")
+		}
+		return cty.IndexStep{Key: cty.NumberIntVal(n)}, nil
+	}
+}
+
+// validAttributeName tells whether the attribute name can be written as a dot separated step.
+func validAttributeName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ".[]\"* \t\n")
+}
+
+// FormatPath formats the path in the syntax of ParsePath, e.g. `.a.b[0]["key"]`, which is the canonical format of
+// the paths. The attribute names that can't be written as dot separated steps are formatted as quoted keys, and the
+// set elements as their JSON.
+func FormatPath(path cty.Path) string {
+	var buf strings.Builder
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			if step == WildcardStep || step == RecursiveWildcardStep || validAttributeName(step.Name) {
+				buf.WriteString("." + step.Name)
+				continue
+			}
+			b, _ := json.Marshal(step.Name)
+			fmt.Fprintf(&buf, "[%s]", b)
+		case cty.IndexStep:
+			fmt.Fprintf(&buf, "[%s]", formatKey(step.Key))
+		default:
+			fmt.Fprintf(&buf, "<INVALID: %#v>", step)
+		}
+	}
+	return buf.String()
+}
+
+func formatKey(key cty.Value) string {
+	switch {
+	case key.IsNull() || !key.IsWhollyKnown():
+		return key.GoString()
+	case key.Type() == cty.String:
+		b, _ := json.Marshal(key.AsString())
+		return string(b)
+	case key.Type() == cty.Number:
+		return key.AsBigFloat().Text('f', -1)
+	default:
+		b, err := ctyjson.Marshal(key, key.Type())
+		if err != nil {
+			return key.GoString()
+		}
+		return string(b)
+	}
+}
+
+// PathMatch is a value matched by a path expression.
+type PathMatch struct {
+	// Path is the path of the value, without wildcards. The attributes of objects are attribute steps, and the
+	// elements of lists, tuples, maps and sets are index steps, where the key of a set element is the element itself.
+	Path  cty.Path
+	Value cty.Value
+}
+
+// EvalPath returns all the values matching the path expression (see ParsePath), in the order of the iteration of the
+// value (and every value before its nested values for RecursiveWildcardStep), without duplicates.
+//
+// Different from cty.Path.Apply, the attribute steps also apply to the map keys and the number-like attribute steps
+// to the list or tuple indexes. The set elements, which are unordered, are only matched by the wildcards or by the
+// index steps whose keys are the elements (converted to the element type). The null and unknown values have nothing
+// nested.
+func EvalPath(val cty.Value, expr cty.Path) []PathMatch {
+	var matches []PathMatch
+	seen := map[string]bool{}
+	var eval func(val cty.Value, path, expr cty.Path)
+	eval = func(val cty.Value, path, expr cty.Path) {
+		if len(expr) == 0 {
+			if k := FormatPath(path); !seen[k] {
+				seen[k] = true
+				matches = append(matches, PathMatch{Path: path, Value: val})
+			}
+			return
+		}
+		switch step := expr[0]; step {
+		case RecursiveWildcardStep:
+			eval(val, path, expr[1:])
+			forEachNested(val, func(step cty.PathStep, v cty.Value) {
+				eval(v, appendStep(path, step), expr)
+			})
+		case WildcardStep:
+			forEachNested(val, func(step cty.PathStep, v cty.Value) {
+				eval(v, appendStep(path, step), expr[1:])
+			})
+		default:
+			if step, v, ok := applyStep(val, step); ok {
+				eval(v, appendStep(path, step), expr[1:])
+			}
+		}
+	}
+	if val != cty.NilVal {
+		eval(val, cty.Path{}, expr)
+	}
+	return matches
+}
+
+// ApplyPath returns the value at the path, which has no wildcards, with the same leniency as EvalPath. Different
+// from EvalPath, the error tells why the path doesn't exist in the value.
+func ApplyPath(val cty.Value, path cty.Path) (cty.Value, error) {
+	for i, step := range path {
+		if step == WildcardStep || step == RecursiveWildcardStep {
+			return cty.NilVal, fmt.Errorf("%s has a wildcard, which might match multiple values", FormatPath(path[:i+1]))
+		}
+		if val.IsNull() {
+			return cty.NilVal, fmt.Errorf("%s is null", describePath(path[:i]))
+		}
+		if !val.IsKnown() {
+			return cty.NilVal, fmt.Errorf("%s is unknown", describePath(path[:i]))
+		}
+		_, v, ok := applyStep(val, step)
+		if !ok {
+			return cty.NilVal, fmt.Errorf("%s (%s) has no %s", describePath(path[:i]), val.Type().FriendlyName(), FormatPath(path[i:i+1]))
+		}
+		val = v
+	}
+	return val, nil
+}
+
+// describePath describes the path in the error messages.
+func describePath(path cty.Path) string {
+	if len(path) == 0 {
+		return "the value"
+	}
+	return FormatPath(path)
+}
+
+func appendStep(path cty.Path, step cty.PathStep) cty.Path {
+	ret := make(cty.Path, len(path), len(path)+1)
+	copy(ret, path)
+	return append(ret, step)
+}
+
+// forEachNested calls the function with the step and value of each attribute or element of the value.
+func forEachNested(val cty.Value, fn func(cty.PathStep, cty.Value)) {
+	if val.IsNull() || !val.IsKnown() || !val.CanIterateElements() {
+		return
+	}
+	isObject := val.Type().IsObjectType()
+	for it := val.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		if isObject {
+			fn(cty.GetAttrStep{Name: k.AsString()}, v)
+			continue
+		}
+		fn(cty.IndexStep{Key: k}, v)
+	}
+}
+
+// applyStep returns the value at the (non-wildcard) step, together with the step in the form of EvalPath matches,
+// or false if there is none.
+func applyStep(val cty.Value, step cty.PathStep) (cty.PathStep, cty.Value, bool) {
+	if val.IsNull() || !val.IsKnown() {
+		return nil, cty.NilVal, false
+	}
+	ty := val.Type()
+	var key cty.Value
+	switch step := step.(type) {
+	case cty.GetAttrStep:
+		key = cty.StringVal(step.Name)
+		if ty.IsListType() || ty.IsTupleType() {
+			n, err := strconv.ParseInt(step.Name, 10, 64)
+			if err != nil {
+				return nil, cty.NilVal, false
+			}
+			key = cty.NumberIntVal(n)
+		}
+	case cty.IndexStep:
+		key = step.Key
+	default:
+		return nil, cty.NilVal, false
+	}
+	if key.IsNull() || !key.IsWhollyKnown() {
+		return nil, cty.NilVal, false
+	}
+
+	switch {
+	case ty.IsObjectType():
+		if key.Type() != cty.String || !ty.HasAttribute(key.AsString()) {
+			return nil, cty.NilVal, false
+		}
+		return cty.GetAttrStep{Name: key.AsString()}, val.GetAttr(key.AsString()), true
+	case ty.IsMapType():
+		if key.Type() != cty.String || !val.HasIndex(key).True() {
+			return nil, cty.NilVal, false
+		}
+		return cty.IndexStep{Key: key}, val.Index(key), true
+	case ty.IsListType(), ty.IsTupleType():
+		if key.Type() != cty.Number || !val.HasIndex(key).True() {
+			return nil, cty.NilVal, false
+		}
+		return cty.IndexStep{Key: key}, val.Index(key), true
+	case ty.IsSetType():
+		elem, err := convert.Convert(key, ty.ElementType())
+		if err != nil {
+			return nil, cty.NilVal, false
+		}
+		if has := val.HasElement(elem); !has.IsKnown() || has.False() {
+			return nil, cty.NilVal, false
+		}
+		return cty.IndexStep{Key: elem}, elem, true
+	default:
+		return nil, cty.NilVal, false
+	}
+}
+
+// MatchPath tells whether the path (e.g. one passed to the callback of cty.Walk) matches the path expression (see
+// ParsePath). Similar to EvalPath, the attribute steps and the index steps are interchangeable for the attributes,
+// map keys and list indexes, and the set elements are only matched by the wildcards or by the index steps of the
+// equal keys.
+func MatchPath(expr, path cty.Path) bool {
+	if len(expr) == 0 {
+		return len(path) == 0
+	}
+	switch expr[0] {
+	case RecursiveWildcardStep:
+		for i := 0; i <= len(path); i++ {
+			if MatchPath(expr[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	case WildcardStep:
+		return len(path) != 0 && MatchPath(expr[1:], path[1:])
+	default:
+		return len(path) != 0 && matchStep(expr[0], path[0]) && MatchPath(expr[1:], path[1:])
+	}
+}
+
+func matchStep(expr, step cty.PathStep) bool {
+	if ek, ok := stepKey(expr); ok {
+		k, ok := stepKey(step)
+		return ok && ek == k
+	}
+	eidx, ok := expr.(cty.IndexStep)
+	if !ok {
+		return false
+	}
+	idx, ok := step.(cty.IndexStep)
+	if !ok || idx.Key.IsNull() || !idx.Key.IsWhollyKnown() {
+		return false
+	}
+	key, err := convert.Convert(eidx.Key, idx.Key.Type())
+	return err == nil && key.Equals(idx.Key).True()
+}
+
+// stepKey returns the string form of the attribute name, map key or list index of the step, or false for the other
+// steps (e.g. the set elements).
+func stepKey(step cty.PathStep) (string, bool) {
+	switch step := step.(type) {
+	case cty.GetAttrStep:
+		return step.Name, true
+	case cty.IndexStep:
+		switch {
+		case step.Key.IsNull() || !step.Key.IsKnown():
+			return "", false
+		case step.Key.Type() == cty.String:
+			return step.Key.AsString(), true
+		case step.Key.Type() == cty.Number:
+			if i, acc := step.Key.AsBigFloat().Int64(); acc == 0 {
+				return strconv.FormatInt(i, 10), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,171 @@
+package tfstate_test
+
+import (
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParsePath(t *testing.T) {
+	rule := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x"), "port": cty.NumberIntVal(80)})
+	cases := []struct {
+		input  string
+		expect cty.Path
+		format string
+		err    bool
+	}{
+		{input: "", expect: nil, format: ""},
+		{input: "a", expect: cty.GetAttrPath("a"), format: ".a"},
+		{input: `.a.b[0]["key"]`, expect: cty.GetAttrPath("a").GetAttr("b").IndexInt(0).IndexString("key"), format: `.a.b[0]["key"]`},
+		{input: `.a["x.y]"]`, expect: cty.GetAttrPath("a").IndexString("x.y]"), format: `.a["x.y]"]`},
+		{input: "a[*].b", expect: cty.GetAttrPath("a").GetAttr("*").GetAttr("b"), format: ".a.*.b"},
+		{input: ".**.id", expect: cty.Path{tfstate.RecursiveWildcardStep, cty.GetAttrStep{Name: "id"}}, format: ".**.id"},
+		{input: `.rule[{"name":"x","port":80}]`, expect: cty.GetAttrPath("rule").Index(rule), format: `.rule[{"name":"x","port":80}]`},
+		{input: "a.", err: true},
+		{input: "a[0", err: true},
+		{input: "a[x]", err: true},
+		{input: "a[-1]", err: true},
+		{input: "a[0]b", err: true},
+		{input: "a.b*", err: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			actual, err := tfstate.ParsePath(tt.input)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, tt.expect.Equals(actual), "%#v", actual)
+			require.Equal(t, tt.format, tfstate.FormatPath(actual))
+		})
+	}
+}
+
+func TestEvalPath(t *testing.T) {
+	ruleX := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x"), "port": cty.NumberIntVal(80)})
+	ruleY := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("y"), "port": cty.NumberIntVal(443)})
+	val := cty.ObjectVal(map[string]cty.Value{
+		"id":   cty.StringVal("a"),
+		"tags": cty.MapVal(map[string]cty.Value{"env": cty.StringVal("dev"), "id": cty.StringVal("t")}),
+		"disk": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("d0")}),
+			cty.ObjectVal(map[string]cty.Value{"id": cty.NullVal(cty.String)}),
+		}),
+		"rule": cty.SetVal([]cty.Value{ruleX, ruleY}),
+	})
+
+	eval := func(expr string) map[string]cty.Value {
+		path, err := tfstate.ParsePath(expr)
+		require.NoError(t, err)
+		ret := map[string]cty.Value{}
+		for _, m := range tfstate.EvalPath(val, path) {
+			ret[tfstate.FormatPath(m.Path)] = m.Value
+		}
+		return ret
+	}
+
+	require.Equal(t, map[string]cty.Value{".tags": val.GetAttr("tags")}, eval(".tags"))
+	require.Equal(t, map[string]cty.Value{`.tags["env"]`: cty.StringVal("dev")}, eval(".tags.env"))
+	require.Equal(t, map[string]cty.Value{".disk[1]": val.GetAttr("disk").Index(cty.NumberIntVal(1))}, eval("disk.1"))
+	require.Empty(t, eval(".nope"))
+	require.Equal(t, map[string]cty.Value{
+		".disk[0].id": cty.StringVal("d0"),
+		".disk[1].id": cty.NullVal(cty.String),
+	}, eval(".disk[*].id"))
+	ids := map[string]cty.Value{
+		".id":         cty.StringVal("a"),
+		`.tags["id"]`: cty.StringVal("t"),
+		".disk[0].id": cty.StringVal("d0"),
+		".disk[1].id": cty.NullVal(cty.String),
+	}
+	require.Equal(t, ids, eval(".**.id"))
+	// The duplicate matches are dropped.
+	require.Equal(t, ids, eval(".**.**.id"))
+
+	// The set elements are matched by the wildcards, or by themselves, but not by the positions.
+	require.Equal(t, map[string]cty.Value{
+		`.rule[{"name":"x","port":80}].port`:  cty.NumberIntVal(80),
+		`.rule[{"name":"y","port":443}].port`: cty.NumberIntVal(443),
+	}, eval(".rule[*].port"))
+	require.Equal(t, map[string]cty.Value{
+		`.rule[{"name":"y","port":443}].name`: cty.StringVal("y"),
+	}, eval(`.rule[{"port":443,"name":"y"}].name`))
+	require.Empty(t, eval(".rule[0]"))
+	require.Empty(t, eval(`.rule[{"name":"z","port":443}]`))
+
+	// The null and unknown values have nothing nested.
+	require.Empty(t, tfstate.EvalPath(cty.NullVal(val.Type()), cty.Path{tfstate.WildcardStep}))
+	require.Empty(t, tfstate.EvalPath(cty.UnknownVal(val.Type()), cty.GetAttrPath("id")))
+}
+
+func TestMatchPath(t *testing.T) {
+	rule := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x")})
+	cases := []struct {
+		expr   string
+		path   cty.Path
+		expect bool
+	}{
+		{"", nil, true},
+		{".a", cty.GetAttrPath("a"), true},
+		{".a", cty.GetAttrPath("a").GetAttr("b"), false},
+		{".a.b", cty.GetAttrPath("a").IndexString("b"), true},
+		{".a.0", cty.GetAttrPath("a").IndexInt(0), true},
+		{".a[*]", cty.GetAttrPath("a").Index(rule), true},
+		{`.a[{"name":"x"}]`, cty.GetAttrPath("a").Index(rule), true},
+		{`.a[{"name":"y"}]`, cty.GetAttrPath("a").Index(rule), false},
+		{".a[0]", cty.GetAttrPath("a").Index(rule), false},
+		{".**", cty.GetAttrPath("a").IndexInt(0), true},
+		{".**.b", cty.GetAttrPath("b"), true},
+		{".**.b", cty.GetAttrPath("a").IndexInt(0).GetAttr("b"), true},
+		{".**.b", cty.GetAttrPath("a").IndexInt(0).GetAttr("c"), false},
+		{".a.**.c", cty.GetAttrPath("a").GetAttr("c"), true},
+	}
+	for _, tt := range cases {
+		expr, err := tfstate.ParsePath(tt.expr)
+		require.NoError(t, err)
+		require.Equal(t, tt.expect, tfstate.MatchPath(expr, tt.path), "%s %s", tt.expr, tfstate.FormatPath(tt.path))
+	}
+}
+
+func TestApplyPath(t *testing.T) {
+	rule := cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x")})
+	val := cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.MapVal(map[string]cty.Value{"env": cty.StringVal("dev")}),
+		"disk": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(10)})}),
+		"rule": cty.SetVal([]cty.Value{rule}),
+		"null": cty.NullVal(cty.List(cty.String)),
+	})
+	cases := []struct {
+		path   string
+		expect cty.Value
+		err    string
+	}{
+		{path: "", expect: val},
+		{path: ".tags.env", expect: cty.StringVal("dev")},
+		{path: `.tags["env"]`, expect: cty.StringVal("dev")},
+		{path: ".disk.0.size", expect: cty.NumberIntVal(10)},
+		{path: `.rule[{"name":"x"}].name`, expect: cty.StringVal("x")},
+		{path: ".nope", err: `the value (object) has no .nope`},
+		{path: ".tags.prod", err: `.tags (map of string) has no .prod`},
+		{path: ".disk[1]", err: `.disk (list of object) has no [1]`},
+		{path: ".rule[0]", err: `.rule (set of object) has no [0]`},
+		{path: ".null[0]", err: `.null is null`},
+		{path: ".disk[*].size", err: `.disk.* has a wildcard, which might match multiple values`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := tfstate.ParsePath(tt.path)
+			require.NoError(t, err)
+			actual, err := tfstate.ApplyPath(val, path)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, tt.expect.RawEquals(actual), "%#v", actual)
+		})
+	}
+}
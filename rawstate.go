@@ -0,0 +1,577 @@
+package tfstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// rawState is the V4 format of the state file, as is written by Terraform (since v0.12) and OpenTofu.
+type rawState struct {
+	Version          uint64                    `json:"version"`
+	TerraformVersion string                    `json:"terraform_version"`
+	Serial           uint64                    `json:"serial"`
+	Lineage          string                    `json:"lineage"`
+	Outputs          map[string]rawStateOutput `json:"outputs"`
+	Resources        []rawStateResource        `json:"resources"`
+	CheckResults     json.RawMessage           `json:"check_results,omitempty"`
+}
+
+type rawStateOutput struct {
+	Value     json.RawMessage `json:"value"`
+	Type      json.RawMessage `json:"type"`
+	Sensitive bool            `json:"sensitive,omitempty"`
+}
+
+type rawStateResource struct {
+	Module         string                     `json:"module,omitempty"`
+	Mode           string                     `json:"mode"`
+	Type           string                     `json:"type"`
+	Name           string                     `json:"name"`
+	EachMode       string                     `json:"each,omitempty"`
+	ProviderConfig string                     `json:"provider"`
+	Instances      []rawStateResourceInstance `json:"instances"`
+}
+
+type rawStateResourceInstance struct {
+	IndexKey                interface{}       `json:"index_key,omitempty"`
+	Status                  string            `json:"status,omitempty"`
+	Deposed                 string            `json:"deposed,omitempty"`
+	SchemaVersion           uint64            `json:"schema_version"`
+	AttributesRaw           json.RawMessage   `json:"attributes,omitempty"`
+	AttributesFlat          map[string]string `json:"attributes_flat,omitempty"`
+	AttributeSensitivePaths json.RawMessage   `json:"sensitive_attributes,omitempty"`
+	IdentitySchemaVersion   uint64            `json:"identity_schema_version"`
+	IdentityRaw             json.RawMessage   `json:"identity,omitempty"`
+	PrivateRaw              []byte            `json:"private,omitempty"`
+	Dependencies            []string          `json:"dependencies,omitempty"`
+	CreateBeforeDestroy     bool              `json:"create_before_destroy,omitempty"`
+}
+
+// rawStatePathStep is a step of the paths in the "sensitive_attributes" of a resource instance.
+type rawStatePathStep struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// FromRawState decodes the state file (i.e. the content of the "terraform.tfstate") into a State.
+func FromRawState(b []byte, schemas *tfjson.ProviderSchemas) (*State, error) {
+	rawState, err := RawStateToJSONState(b)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSONState(rawState, schemas)
+}
+
+// RawStateToJSONState converts the state file (i.e. the content of the "terraform.tfstate") into the tfjson.State,
+// which is the same as the output of `terraform show -json` on that state file.
+// Only the V4 format of the state file is supported.
+func RawStateToJSONState(b []byte) (*tfjson.State, error) {
+	var raw rawState
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshal state file: %v", err)
+	}
+	if raw.Version != 4 {
+		return nil, fmt.Errorf("unsupported state file version %d", raw.Version)
+	}
+
+	ret := &tfjson.State{
+		FormatVersion:    "1.0",
+		TerraformVersion: raw.TerraformVersion,
+		Values: &tfjson.StateValues{
+			RootModule: &tfjson.StateModule{},
+		},
+	}
+
+	if len(raw.Outputs) != 0 {
+		outputs := make(map[string]*tfjson.StateOutput, len(raw.Outputs))
+		for name, rawOutput := range raw.Outputs {
+			output := &tfjson.StateOutput{
+				Sensitive: rawOutput.Sensitive,
+			}
+			if err := unmarshalUseNumber(rawOutput.Value, &output.Value); err != nil {
+				return nil, fmt.Errorf("unmarshal value of output %q: %v", name, err)
+			}
+			if len(rawOutput.Type) != 0 {
+				if err := json.Unmarshal(rawOutput.Type, &output.Type); err != nil {
+					return nil, fmt.Errorf("unmarshal type of output %q: %v", name, err)
+				}
+			}
+			outputs[name] = output
+		}
+		ret.Values.Outputs = outputs
+	}
+
+	modules := map[string]*tfjson.StateModule{
+		"": ret.Values.RootModule,
+	}
+	for _, rawResource := range raw.Resources {
+		module := rawStateModule(modules, rawResource.Module)
+		for _, rawInstance := range rawResource.Instances {
+			resource, err := rawStateResourceToJSON(rawResource, rawInstance)
+			if err != nil {
+				return nil, err
+			}
+			module.Resources = append(module.Resources, resource)
+		}
+	}
+	for _, module := range modules {
+		sort.Slice(module.ChildModules, func(i, j int) bool {
+			return module.ChildModules[i].Address < module.ChildModules[j].Address
+		})
+	}
+
+	return ret, nil
+}
+
+// rawStateModule returns the module of the given address from the modules, which is created (together with its
+// ancestors) if not exists.
+func rawStateModule(modules map[string]*tfjson.StateModule, addr string) *tfjson.StateModule {
+	if module, ok := modules[addr]; ok {
+		return module
+	}
+	module := &tfjson.StateModule{
+		Address: addr,
+	}
+	modules[addr] = module
+	parent := rawStateModule(modules, parentModuleAddress(addr))
+	parent.ChildModules = append(parent.ChildModules, module)
+	return module
+}
+
+// parentModuleAddress returns the address of the parent module of the given module address, e.g. the parent of
+// `module.a["x"].module.b` is `module.a["x"]`, while the parent of `module.a` is the root module (i.e. "").
+func parentModuleAddress(addr string) string {
+	var (
+		inQuote bool
+		last    int
+	)
+	for i := 0; i < len(addr); i++ {
+		switch addr[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case '.':
+			if !inQuote && strings.HasPrefix(addr[i:], ".module.") {
+				last = i
+			}
+		}
+	}
+	return addr[:last]
+}
+
+func rawStateResourceToJSON(rawResource rawStateResource, rawInstance rawStateResourceInstance) (*tfjson.StateResource, error) {
+	providerName, err := parseProviderConfig(rawResource.ProviderConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &tfjson.StateResource{
+		Mode:          tfjson.ResourceMode(rawResource.Mode),
+		Type:          rawResource.Type,
+		Name:          rawResource.Name,
+		Index:         rawInstance.IndexKey,
+		ProviderName:  providerName,
+		SchemaVersion: rawInstance.SchemaVersion,
+		DependsOn:     rawInstance.Dependencies,
+		Tainted:       rawInstance.Status == "tainted",
+		DeposedKey:    rawInstance.Deposed,
+	}
+
+	ret.Address = resourceInstanceAddress(rawResource.Module, ret.Mode, ret.Type, ret.Name, ret.Index)
+
+	if len(rawInstance.AttributesFlat) != 0 {
+		return nil, fmt.Errorf("resource %q: the legacy flatmap attributes is not supported", ret.Address)
+	}
+	if len(rawInstance.AttributesRaw) != 0 {
+		if err := unmarshalUseNumber(rawInstance.AttributesRaw, &ret.AttributeValues); err != nil {
+			return nil, fmt.Errorf("resource %q: unmarshal attributes: %v", ret.Address, err)
+		}
+	}
+	if len(rawInstance.IdentityRaw) != 0 {
+		if err := unmarshalUseNumber(rawInstance.IdentityRaw, &ret.IdentityValues); err != nil {
+			return nil, fmt.Errorf("resource %q: unmarshal identity: %v", ret.Address, err)
+		}
+		version := rawInstance.IdentitySchemaVersion
+		ret.IdentitySchemaVersion = &version
+	}
+	sensitiveValues, err := sensitivePathsToValues(rawInstance.AttributeSensitivePaths)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: %v", ret.Address, err)
+	}
+	ret.SensitiveValues = sensitiveValues
+
+	return ret, nil
+}
+
+// unmarshalUseNumber is json.Unmarshal, except that the numbers are decoded as json.Number, keeping their full
+// precision.
+func unmarshalUseNumber(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after the top-level value")
+	}
+	return nil
+}
+
+// parseProviderConfig returns the provider source address from the provider configuration address, e.g.
+// `module.a.provider["registry.terraform.io/hashicorp/null"].alias` results into "registry.terraform.io/hashicorp/null".
+func parseProviderConfig(config string) (string, error) {
+	const prefix = `provider["`
+	idx := strings.Index(config, prefix)
+	if idx == -1 {
+		return "", fmt.Errorf("invalid provider configuration address %q", config)
+	}
+	rest := config[idx+len(prefix):]
+	end := strings.Index(rest, `"]`)
+	if end == -1 {
+		return "", fmt.Errorf("invalid provider configuration address %q", config)
+	}
+	return rest[:end], nil
+}
+
+// sensitivePathsToValues converts the "sensitive_attributes" of a resource instance in the state file, which is a
+// list of paths, to the "sensitive_values" of the tfjson.StateResource, which mirrors the structure of the value.
+func sensitivePathsToValues(b json.RawMessage) (json.RawMessage, error) {
+	var paths [][]rawStatePathStep
+	if len(b) != 0 {
+		if err := json.Unmarshal(b, &paths); err != nil {
+			return nil, fmt.Errorf("unmarshal sensitive attributes: %v", err)
+		}
+	}
+	root := map[string]interface{}{}
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		if path[0].Type != "get_attr" {
+			return nil, fmt.Errorf("sensitive attribute path must start with an attribute")
+		}
+		var parent interface{} = root
+		var set func(interface{})
+		for _, step := range path {
+			switch step.Type {
+			case "get_attr":
+				var name string
+				if err := json.Unmarshal(step.Value, &name); err != nil {
+					return nil, fmt.Errorf("unmarshal sensitive attribute path: %v", err)
+				}
+				m, ok := parent.(map[string]interface{})
+				if !ok {
+					m = map[string]interface{}{}
+					set(m)
+				}
+				if _, ok := m[name]; !ok {
+					m[name] = nil
+				}
+				parent = m[name]
+				set = func(v interface{}) { m[name] = v }
+			case "index":
+				var key struct {
+					Value json.RawMessage `json:"value"`
+					Type  json.RawMessage `json:"type"`
+				}
+				if err := json.Unmarshal(step.Value, &key); err != nil {
+					return nil, fmt.Errorf("unmarshal sensitive attribute path: %v", err)
+				}
+				var ty cty.Type
+				if err := json.Unmarshal(key.Type, &ty); err != nil {
+					return nil, fmt.Errorf("unmarshal sensitive attribute path: %v", err)
+				}
+				switch ty {
+				case cty.Number:
+					var idx int
+					if err := json.Unmarshal(key.Value, &idx); err != nil {
+						return nil, fmt.Errorf("unmarshal sensitive attribute path: %v", err)
+					}
+					l, _ := parent.([]interface{})
+					for len(l) <= idx {
+						l = append(l, false)
+					}
+					set(l)
+					parent = l[idx]
+					set = func(v interface{}) { l[idx] = v }
+				case cty.String:
+					var name string
+					if err := json.Unmarshal(key.Value, &name); err != nil {
+						return nil, fmt.Errorf("unmarshal sensitive attribute path: %v", err)
+					}
+					m, ok := parent.(map[string]interface{})
+					if !ok {
+						m = map[string]interface{}{}
+						set(m)
+					}
+					if _, ok := m[name]; !ok {
+						m[name] = nil
+					}
+					parent = m[name]
+					set = func(v interface{}) { m[name] = v }
+				default:
+					return nil, fmt.Errorf("unsupported index type %s in sensitive attribute path", ty.FriendlyName())
+				}
+			default:
+				return nil, fmt.Errorf("unsupported step type %q in sensitive attribute path", step.Type)
+			}
+		}
+		set(true)
+	}
+	return json.Marshal(root)
+}
+
+// ToRawState encodes the State into the V4 format of the state file (i.e. the content of the "terraform.tfstate"),
+// with the given lineage and serial.
+//
+// Some information of the state file is not tracked by the State, hence is not written: the private data of the
+// resource instances, the check results, and the provider configuration aliases or modules (all resources are
+// written to use the default configuration of their providers in the root module).
+func ToRawState(state *State, lineage string, serial uint64) ([]byte, error) {
+	return toRawState(state, lineage, serial, nil)
+}
+
+func toRawState(state *State, lineage string, serial uint64, p *progressCounter) ([]byte, error) {
+	raw := rawState{
+		Version:   4,
+		Serial:    serial,
+		Lineage:   lineage,
+		Outputs:   map[string]rawStateOutput{},
+		Resources: []rawStateResource{},
+	}
+	if state == nil {
+		return json.MarshalIndent(raw, "", "  ")
+	}
+	raw.TerraformVersion = state.TerraformVersion
+
+	if state.Values != nil {
+		for name, output := range state.Values.Outputs {
+			if output == nil {
+				continue
+			}
+			rawOutput, err := outputToRaw(output)
+			if err != nil {
+				return nil, fmt.Errorf("output %q: %v", name, err)
+			}
+			raw.Outputs[name] = rawOutput
+		}
+	}
+
+	instances, err := state.instances()
+	if err != nil {
+		return nil, err
+	}
+	resourceIndex := map[string]int{}
+	for _, inst := range instances {
+		if err := p.check(); err != nil {
+			return nil, err
+		}
+		res := inst.resource
+		key := inst.addr.ResourceAddress().String()
+		idx, ok := resourceIndex[key]
+		if !ok {
+			idx = len(raw.Resources)
+			resourceIndex[key] = idx
+			raw.Resources = append(raw.Resources, rawStateResource{
+				Module:         inst.addr.ModuleAddress(),
+				Mode:           string(res.Mode),
+				Type:           res.Type,
+				Name:           res.Name,
+				ProviderConfig: fmt.Sprintf("provider[%q]", res.ProviderName),
+			})
+		}
+		rawResource := &raw.Resources[idx]
+		switch inst.addr.Key.(type) {
+		case int:
+			rawResource.EachMode = "list"
+		case string:
+			rawResource.EachMode = "map"
+		}
+		rawInstance, err := resourceToRawInstance(res, inst.addr.Key)
+		if err != nil {
+			return nil, fmt.Errorf("resource %q: %v", res.Address, err)
+		}
+		rawResource.Instances = append(rawResource.Instances, rawInstance)
+		p.inc()
+	}
+
+	return json.MarshalIndent(raw, "", "  ")
+}
+
+func outputToRaw(output *StateOutput) (rawStateOutput, error) {
+	value, err := json.Marshal(output.Value)
+	if err != nil {
+		return rawStateOutput{}, fmt.Errorf("marshal value: %v", err)
+	}
+	ty, err := ctyjson.ImpliedType(value)
+	if err != nil {
+		return rawStateOutput{}, fmt.Errorf("implying type: %v", err)
+	}
+	tyJSON, err := ty.MarshalJSON()
+	if err != nil {
+		return rawStateOutput{}, fmt.Errorf("marshal type: %v", err)
+	}
+	return rawStateOutput{
+		Value:     value,
+		Type:      tyJSON,
+		Sensitive: output.Sensitive,
+	}, nil
+}
+
+func resourceToRawInstance(res *StateResource, key interface{}) (rawStateResourceInstance, error) {
+	ret := rawStateResourceInstance{
+		IndexKey:      key,
+		Deposed:       res.DeposedKey,
+		SchemaVersion: res.SchemaVersion,
+		Dependencies:  res.DependsOn,
+	}
+	if res.Tainted {
+		ret.Status = "tainted"
+	}
+	if res.Value != cty.NilVal && !res.Value.IsNull() {
+		b, err := ctyjson.Marshal(res.Value, res.Value.Type())
+		if err != nil {
+			return ret, fmt.Errorf("marshal attributes: %v", err)
+		}
+		ret.AttributesRaw = b
+
+		paths, err := sensitiveValuesToPaths(res.SensitiveValues, res.Value.Type())
+		if err != nil {
+			return ret, err
+		}
+		ret.AttributeSensitivePaths = paths
+	}
+	if res.Identity != cty.NilVal && !res.Identity.IsNull() {
+		b, err := ctyjson.Marshal(res.Identity, res.Identity.Type())
+		if err != nil {
+			return ret, fmt.Errorf("marshal identity: %v", err)
+		}
+		ret.IdentityRaw = b
+		if res.IdentitySchemaVersion != nil {
+			ret.IdentitySchemaVersion = *res.IdentitySchemaVersion
+		}
+	}
+	return ret, nil
+}
+
+// sensitiveValuesToPaths converts the "sensitive_values" of the tfjson.StateResource to the "sensitive_attributes" of
+// a resource instance in the state file, which is the reverse of sensitivePathsToValues. The type of the resource
+// value is used to tell an attribute from a map key. A set containing any sensitive value is regarded as sensitive
+// as a whole, as a set element can't be addressed by a path.
+func sensitiveValuesToPaths(b json.RawMessage, ty cty.Type) (json.RawMessage, error) {
+	paths := [][]rawStatePathStep{}
+	if len(b) == 0 {
+		return json.Marshal(paths)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("unmarshal sensitive values: %v", err)
+	}
+
+	var anySensitive func(v interface{}) bool
+	anySensitive = func(v interface{}) bool {
+		switch v := v.(type) {
+		case bool:
+			return v
+		case []interface{}:
+			for _, e := range v {
+				if anySensitive(e) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				if anySensitive(e) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var walk func(v interface{}, ty cty.Type, path []rawStatePathStep)
+	walk = func(v interface{}, ty cty.Type, path []rawStatePathStep) {
+		if sensitive, ok := v.(bool); ok {
+			if sensitive && len(path) != 0 {
+				paths = append(paths, append([]rawStatePathStep{}, path...))
+			}
+			return
+		}
+		switch {
+		case ty.IsSetType():
+			if anySensitive(v) && len(path) != 0 {
+				paths = append(paths, append([]rawStatePathStep{}, path...))
+			}
+			return
+		case ty.IsObjectType():
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return
+			}
+			for _, name := range sortedKeys(m) {
+				if !ty.HasAttribute(name) {
+					continue
+				}
+				walk(m[name], ty.AttributeType(name), append(path, getAttrPathStep(name)))
+			}
+		case ty.IsMapType():
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return
+			}
+			for _, key := range sortedKeys(m) {
+				walk(m[key], ty.ElementType(), append(path, indexPathStep(key, "string")))
+			}
+		case ty.IsListType(), ty.IsTupleType():
+			l, ok := v.([]interface{})
+			if !ok {
+				return
+			}
+			for i, e := range l {
+				ety := cty.DynamicPseudoType
+				if ty.IsListType() {
+					ety = ty.ElementType()
+				} else if i < len(ty.TupleElementTypes()) {
+					ety = ty.TupleElementType(i)
+				}
+				walk(e, ety, append(path, indexPathStep(i, "number")))
+			}
+		default:
+			if anySensitive(v) && len(path) != 0 {
+				paths = append(paths, append([]rawStatePathStep{}, path...))
+			}
+		}
+	}
+	walk(v, ty, nil)
+	return json.Marshal(paths)
+}
+
+func getAttrPathStep(name string) rawStatePathStep {
+	b, _ := json.Marshal(name)
+	return rawStatePathStep{Type: "get_attr", Value: b}
+}
+
+func indexPathStep(key interface{}, ty string) rawStatePathStep {
+	b, _ := json.Marshal(map[string]interface{}{"value": key, "type": ty})
+	return rawStatePathStep{Type: "index", Value: b}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParentModuleAddress(t *testing.T) {
+	cases := map[string]string{
+		"":                              "",
+		"module.a":                      "",
+		"module.a.module.b":             "module.a",
+		`module.a["x.module.y"]`:        "",
+		`module.a["x"].module.b[0]`:     `module.a["x"]`,
+		`module.a["\"x"].module.b[0]`:   `module.a["\"x"]`,
+		"module.a.module.b.module.c[1]": "module.a.module.b",
+	}
+	for addr, expect := range cases {
+		require.Equal(t, expect, parentModuleAddress(addr), addr)
+	}
+}
+
+func TestSensitivePathsToValues(t *testing.T) {
+	cases := []struct {
+		name   string
+		paths  string
+		expect string
+	}{
+		{
+			name:   "none",
+			paths:  ``,
+			expect: `{}`,
+		},
+		{
+			name:   "attribute",
+			paths:  `[[{"type":"get_attr","value":"password"}]]`,
+			expect: `{"password":true}`,
+		},
+		{
+			name: "nested",
+			paths: `[
+  [{"type":"get_attr","value":"block"},{"type":"index","value":{"value":1,"type":"number"}},{"type":"get_attr","value":"secret"}],
+  [{"type":"get_attr","value":"tags"},{"type":"index","value":{"value":"key","type":"string"}}]
+]`,
+			expect: `{"block":[false,{"secret":true}],"tags":{"key":true}}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := sensitivePathsToValues(json.RawMessage(c.paths))
+			require.NoError(t, err)
+			require.JSONEq(t, c.expect, string(actual))
+		})
+	}
+}
+
+func TestSensitiveValuesToPaths(t *testing.T) {
+	ty := cty.Object(map[string]cty.Type{
+		"password": cty.String,
+		"block":    cty.List(cty.Object(map[string]cty.Type{"secret": cty.String})),
+		"tags":     cty.Map(cty.String),
+		"set":      cty.Set(cty.Object(map[string]cty.Type{"secret": cty.String})),
+	})
+	cases := []struct {
+		name   string
+		values string
+		expect string
+	}{
+		{
+			name:   "none",
+			values: `{}`,
+			expect: `[]`,
+		},
+		{
+			name:   "attribute",
+			values: `{"password":true}`,
+			expect: `[[{"type":"get_attr","value":"password"}]]`,
+		},
+		{
+			name:   "nested",
+			values: `{"block":[false,{"secret":true}],"tags":{"key":true}}`,
+			expect: `[
+  [{"type":"get_attr","value":"block"},{"type":"index","value":{"value":1,"type":"number"}},{"type":"get_attr","value":"secret"}],
+  [{"type":"get_attr","value":"tags"},{"type":"index","value":{"value":"key","type":"string"}}]
+]`,
+		},
+		{
+			name:   "set",
+			values: `{"set":[{},{"secret":true}]}`,
+			expect: `[[{"type":"get_attr","value":"set"}]]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := sensitiveValuesToPaths(json.RawMessage(c.values), ty)
+			require.NoError(t, err)
+			require.JSONEq(t, c.expect, string(actual))
+		})
+	}
+}
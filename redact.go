@@ -0,0 +1,278 @@
+package tfstate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// RedactPlaceholderPrefix is the prefix of the placeholders of the redacted strings.
+const RedactPlaceholderPrefix = "redacted-"
+
+// RedactPolicy is the policy of Redact.
+type RedactPolicy struct {
+	// Schemas are the provider schemas, whose sensitive attributes are redacted. Only the sensitive values recorded
+	// in the state are redacted if nil.
+	Schemas *tfjson.ProviderSchemas
+	// Paths are the path expressions (see ParsePath) of the values to redact in every resource instance, besides the
+	// sensitive ones, e.g. `.**.password` or `.tags.owner`.
+	Paths []cty.Path
+	// Outputs are the names of the outputs to redact, besides the sensitive ones.
+	Outputs []string
+	// Key is the key of the HMAC that the placeholders are derived from. Without a key, the placeholders of the
+	// low-entropy values (e.g. short passwords) can be guessed by trying the candidates, so a random key is
+	// recommended, which is kept private and shared by the states to correlate.
+	Key []byte
+}
+
+// Redact returns a copy of the state for sharing (e.g. attaching to a bug report), whose sensitive values (recorded
+// in the SensitiveValues of the resources, the sensitive outputs, or the sensitive attributes of the schemas) and the
+// values chosen by the policy are replaced by placeholders. The state being redacted is not modified.
+//
+// The placeholders preserve the types, so that the redacted state still decodes and can be written by the state
+// writers (e.g. ToJSONState and ToRawState): the strings are "redacted-<hash>", the numbers are non-negative
+// integers and the bools are either true or false, all derived from the HMAC of the original values. The same values
+// have the same placeholders, so that they can still be correlated. The collections are redacted element-wise,
+// keeping their lengths and map keys. The null and unknown values are kept as is.
+func Redact(state *State, policy RedactPolicy) (*State, error) {
+	if state == nil {
+		return nil, nil
+	}
+	ret := &State{TerraformVersion: state.TerraformVersion}
+	if state.Values == nil {
+		return ret, nil
+	}
+	ret.Values = &StateValues{}
+
+	var redactModule func(module *StateModule) (*StateModule, error)
+	redactModule = func(module *StateModule) (*StateModule, error) {
+		if module == nil {
+			return nil, nil
+		}
+		ret := &StateModule{Address: module.Address}
+		for _, res := range module.Resources {
+			res, err := RedactResource(res, policy)
+			if err != nil {
+				return nil, err
+			}
+			ret.Resources = append(ret.Resources, res)
+		}
+		for _, child := range module.ChildModules {
+			child, err := redactModule(child)
+			if err != nil {
+				return nil, err
+			}
+			ret.ChildModules = append(ret.ChildModules, child)
+		}
+		return ret, nil
+	}
+	var err error
+	if ret.Values.RootModule, err = redactModule(state.Values.RootModule); err != nil {
+		return nil, err
+	}
+
+	if state.Values.Outputs != nil {
+		redacted := map[string]bool{}
+		for _, name := range policy.Outputs {
+			redacted[name] = true
+		}
+		ret.Values.Outputs = make(map[string]*StateOutput, len(state.Values.Outputs))
+		for name, output := range state.Values.Outputs {
+			if output != nil {
+				v := *output
+				if v.Sensitive || redacted[name] {
+					v.Value = redactJSON(v.Value, policy.Key)
+				}
+				output = &v
+			}
+			ret.Values.Outputs[name] = output
+		}
+	}
+	return ret, nil
+}
+
+// RedactResource returns a copy of the resource instance, whose sensitive values and the values chosen by the policy
+// are replaced by placeholders. The policy paths also apply to the resource identity. See Redact for details.
+func RedactResource(res *StateResource, policy RedactPolicy) (*StateResource, error) {
+	if res == nil {
+		return nil, nil
+	}
+	ret := copyStateResource(res)
+	if res.Identity != cty.NilVal {
+		r := redactor{paths: policy.Paths, key: policy.Key}
+		ret.Identity = r.value(res.Identity, cty.Path{}, nil)
+	}
+	if res.Value == cty.NilVal {
+		return ret, nil
+	}
+	var sens interface{}
+	if len(res.SensitiveValues) != 0 {
+		if err := json.Unmarshal(res.SensitiveValues, &sens); err != nil {
+			return nil, fmt.Errorf("resource %q: unmarshal sensitive values: %v", res.Address, err)
+		}
+	}
+	var block *tfjson.SchemaBlock
+	if policy.Schemas != nil {
+		if schema, err := LookupResourceSchema(policy.Schemas, res.ProviderName, res.Mode, res.Type); err == nil {
+			block = schema.Block
+		}
+	}
+	r := redactor{block: block, paths: policy.Paths, key: policy.Key}
+	ret.Value = r.value(res.Value, cty.Path{}, sens)
+	return ret, nil
+}
+
+type redactor struct {
+	block *tfjson.SchemaBlock
+	paths []cty.Path
+	key   []byte
+}
+
+// value redacts the value at the path, where the sens is the part of the sensitive values (i.e. the JSON of the value
+// shape whose leaves are true for the sensitive values) of the value.
+func (r redactor) value(val cty.Value, path cty.Path, sens interface{}) cty.Value {
+	if val.IsNull() || !val.IsKnown() {
+		return val
+	}
+	if r.redacted(path, sens) {
+		return placeholder(val, r.key)
+	}
+	ty := val.Type()
+	switch {
+	case ty.IsObjectType(), ty.IsMapType():
+		if val.LengthInt() == 0 {
+			return val
+		}
+		m, _ := sens.(map[string]interface{})
+		vals := map[string]cty.Value{}
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			name := k.AsString()
+			var step cty.PathStep = cty.IndexStep{Key: k}
+			if ty.IsObjectType() {
+				step = cty.GetAttrStep{Name: name}
+			}
+			vals[name] = r.value(v, appendStep(path, step), m[name])
+		}
+		if ty.IsObjectType() {
+			return cty.ObjectVal(vals)
+		}
+		return cty.MapVal(vals)
+	case ty.IsListType(), ty.IsSetType(), ty.IsTupleType():
+		if val.LengthInt() == 0 {
+			return val
+		}
+		l, _ := sens.([]interface{})
+		var vals []cty.Value
+		i := 0
+		for it := val.ElementIterator(); it.Next(); i++ {
+			k, v := it.Element()
+			var esens interface{}
+			if i < len(l) {
+				// The sensitive values of the set elements are in the iteration order.
+				esens = l[i]
+			}
+			vals = append(vals, r.value(v, appendStep(path, cty.IndexStep{Key: k}), esens))
+		}
+		switch {
+		case ty.IsListType():
+			return cty.ListVal(vals)
+		case ty.IsSetType():
+			return cty.SetVal(vals)
+		default:
+			return cty.TupleVal(vals)
+		}
+	default:
+		return val
+	}
+}
+
+// redacted tells whether the value at the path is redacted as a whole.
+func (r redactor) redacted(path cty.Path, sens interface{}) bool {
+	if b, ok := sens.(bool); ok && b {
+		return true
+	}
+	if len(path) != 0 && SchemaSensitive(r.block, path) {
+		return true
+	}
+	for _, expr := range r.paths {
+		if MatchPath(expr, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholder returns the placeholder of the value, which has the same type.
+func placeholder(val cty.Value, key []byte) cty.Value {
+	if val.IsNull() || !val.IsKnown() {
+		return val
+	}
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		return cty.StringVal(placeholderString("s:"+val.AsString(), key))
+	case ty == cty.Number:
+		return cty.NumberUIntVal(placeholderNumber("n:"+val.AsBigFloat().Text('f', -1), key))
+	case ty == cty.Bool:
+		return cty.BoolVal(placeholderBool("b:"+strconv.FormatBool(val.True()), key))
+	default:
+		return mapElements(val, func(v cty.Value) cty.Value {
+			return placeholder(v, key)
+		})
+	}
+}
+
+// redactJSON returns the placeholder of the JSON value (e.g. of an output), which has the same JSON type.
+func redactJSON(v interface{}, key []byte) interface{} {
+	switch v := v.(type) {
+	case string:
+		return placeholderString("s:"+v, key)
+	case float64:
+		return float64(placeholderNumber("n:"+strconv.FormatFloat(v, 'f', -1, 64), key))
+	case json.Number:
+		return json.Number(strconv.FormatUint(placeholderNumber("n:"+v.String(), key), 10))
+	case bool:
+		return placeholderBool("b:"+strconv.FormatBool(v), key)
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ret[k] = redactJSON(e, key)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			ret[i] = redactJSON(e, key)
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+func redactHash(s string, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func placeholderString(s string, key []byte) string {
+	return RedactPlaceholderPrefix + hex.EncodeToString(redactHash(s, key)[:8])
+}
+
+func placeholderNumber(s string, key []byte) uint64 {
+	// The placeholders are within the integers that float64 represents exactly, e.g. for the JSON outputs.
+	return binary.BigEndian.Uint64(redactHash(s, key)[:8]) & (1<<53 - 1)
+}
+
+func placeholderBool(s string, key []byte) bool {
+	return redactHash(s, key)[0]&1 == 1
+}
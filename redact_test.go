@@ -0,0 +1,165 @@
+package tfstate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRedact(t *testing.T) {
+	schemas := loadOpenTofuSchemas(t)
+	state, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), schemas)
+	require.NoError(t, err)
+
+	policy := tfstate.RedactPolicy{
+		Schemas: schemas,
+		Paths: []cty.Path{
+			{tfstate.RecursiveWildcardStep, cty.GetAttrStep{Name: "env"}},
+			cty.GetAttrPath("length"),
+		},
+		Outputs: []string{"pet"},
+		Key:     []byte("test"),
+	}
+	redacted, err := tfstate.Redact(state, policy)
+	require.NoError(t, err)
+
+	resources := stateResources(redacted)
+	require.Len(t, resources, 6)
+
+	// The sensitive values are redacted, with the types preserved.
+	password := resources["random_password.this"].Value
+	for _, name := range []string{"result", "bcrypt_hash"} {
+		v := password.GetAttr(name)
+		require.Equal(t, cty.String, v.Type())
+		require.True(t, strings.HasPrefix(v.AsString(), tfstate.RedactPlaceholderPrefix), v.AsString())
+	}
+	require.Equal(t, cty.StringVal("none"), password.GetAttr("id"))
+	require.True(t, password.GetAttr("keepers").IsNull())
+	require.Equal(t, cty.True, password.GetAttr("special"))
+
+	// The chosen paths are redacted, and the same values have the same placeholders.
+	length := password.GetAttr("length")
+	require.Equal(t, cty.Number, length.Type())
+	require.False(t, length.RawEquals(cty.NumberIntVal(12)))
+	_, acc := length.AsBigFloat().Int64()
+	require.Zero(t, acc)
+	env := resources["random_pet.this"].Value.GetAttr("keepers").Index(cty.StringVal("env"))
+	require.NotEqual(t, cty.StringVal("test"), env)
+	data := resources["data.null_data_source.values"].Value
+	require.Equal(t, env, data.GetAttr("inputs").Index(cty.StringVal("env")))
+	require.Equal(t, env, data.GetAttr("outputs").Index(cty.StringVal("env")))
+	require.Equal(t, cty.StringVal("sunny-toucan"), resources["random_pet.this"].Value.GetAttr("id"))
+
+	// The sensitive outputs and the chosen ones are redacted.
+	for _, name := range []string{"password", "pet"} {
+		v, ok := redacted.Values.Outputs[name].Value.(string)
+		require.True(t, ok)
+		require.True(t, strings.HasPrefix(v, tfstate.RedactPlaceholderPrefix), v)
+	}
+
+	// The state being redacted is not modified.
+	require.Equal(t, cty.StringVal("Xk3#p9!qLm2@"), stateResources(state)["random_password.this"].Value.GetAttr("result"))
+	require.Equal(t, "Xk3#p9!qLm2@", state.Values.Outputs["password"].Value)
+
+	// The redacted state can be written and decoded again.
+	jsonState, err := tfstate.ToJSONState(redacted)
+	require.NoError(t, err)
+	_, err = tfstate.FromJSONState(jsonState, schemas)
+	require.NoError(t, err)
+	b, err := tfstate.ToRawState(redacted, "lineage", 1)
+	require.NoError(t, err)
+	_, err = tfstate.FromRawState(b, schemas)
+	require.NoError(t, err)
+
+	// The placeholders are deterministic per key.
+	again, err := tfstate.Redact(state, policy)
+	require.NoError(t, err)
+	require.Equal(t, password, stateResources(again)["random_password.this"].Value)
+	policy.Key = []byte("other")
+	other, err := tfstate.Redact(state, policy)
+	require.NoError(t, err)
+	require.NotEqual(t, password.GetAttr("result"), stateResources(other)["random_password.this"].Value.GetAttr("result"))
+}
+
+func TestRedactResource(t *testing.T) {
+	ruleType := cty.Object(map[string]cty.Type{"name": cty.String, "token": cty.String})
+	res := &tfstate.StateResource{
+		Address: "demo.this",
+		Type:    "demo",
+		Value: cty.ObjectVal(map[string]cty.Value{
+			"id": cty.StringVal("a"),
+			"rule": cty.SetVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("x"), "token": cty.StringVal("t1")}),
+				cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("y"), "token": cty.NullVal(cty.String)}),
+			}),
+			"secrets": cty.MapVal(map[string]cty.Value{"a": cty.StringVal("1"), "b": cty.StringVal("2")}),
+			"flags":   cty.ListVal([]cty.Value{cty.True, cty.UnknownVal(cty.Bool)}),
+		}),
+		SensitiveValues: []byte(`{"secrets": true, "flags": [true]}`),
+		Identity: cty.ObjectVal(map[string]cty.Value{
+			"account_id": cty.StringVal("123456789012"),
+			"name":       cty.StringVal("this"),
+		}),
+	}
+	got, err := tfstate.RedactResource(res, tfstate.RedactPolicy{
+		Paths: []cty.Path{
+			cty.GetAttrPath("rule").GetAttr("*").GetAttr("token"),
+			{tfstate.RecursiveWildcardStep, cty.GetAttrStep{Name: "account_id"}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, got.Value.Type().Equals(res.Value.Type()))
+	require.Equal(t, cty.StringVal("a"), got.Value.GetAttr("id"))
+
+	rules := got.Value.GetAttr("rule")
+	require.Equal(t, 2, rules.LengthInt())
+	for it := rules.ElementIterator(); it.Next(); {
+		_, rule := it.Element()
+		require.True(t, rule.Type().Equals(ruleType))
+		// The null values are kept.
+		if token := rule.GetAttr("token"); !token.IsNull() {
+			require.True(t, strings.HasPrefix(token.AsString(), tfstate.RedactPlaceholderPrefix))
+		}
+	}
+
+	// The map keys are kept.
+	secrets := got.Value.GetAttr("secrets")
+	require.True(t, secrets.HasIndex(cty.StringVal("a")).True())
+	require.NotEqual(t, cty.StringVal("1"), secrets.Index(cty.StringVal("a")))
+
+	// The unknown values are kept.
+	flags := got.Value.GetAttr("flags")
+	require.True(t, flags.Index(cty.NumberIntVal(0)).IsKnown())
+	require.False(t, flags.Index(cty.NumberIntVal(1)).IsKnown())
+
+	// The paths also apply to the identity.
+	accountID := got.Identity.GetAttr("account_id").AsString()
+	require.True(t, strings.HasPrefix(accountID, tfstate.RedactPlaceholderPrefix), accountID)
+	require.Equal(t, cty.StringVal("this"), got.Identity.GetAttr("name"))
+	require.Equal(t, cty.StringVal("123456789012"), res.Identity.GetAttr("account_id"))
+}
+
+func TestRedactNumbers(t *testing.T) {
+	var nums []cty.Value
+	for i := 0; i < 2000; i++ {
+		nums = append(nums, cty.NumberIntVal(int64(i)))
+	}
+	res := &tfstate.StateResource{
+		Address: "demo.this",
+		Type:    "demo",
+		Value:   cty.ObjectVal(map[string]cty.Value{"nums": cty.ListVal(nums)}),
+	}
+	got, err := tfstate.RedactResource(res, tfstate.RedactPolicy{Paths: []cty.Path{cty.GetAttrPath("nums")}})
+	require.NoError(t, err)
+
+	// The distinct numbers have distinct placeholders.
+	seen := map[string]bool{}
+	for it := got.Value.GetAttr("nums").ElementIterator(); it.Next(); {
+		_, v := it.Element()
+		seen[v.AsBigFloat().Text('f', -1)] = true
+	}
+	require.Len(t, seen, len(nums))
+}
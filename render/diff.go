@@ -0,0 +1,645 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+type action string
+
+const (
+	actionNoOp   action = " "
+	actionCreate action = "+"
+	actionDelete action = "-"
+	actionUpdate action = "~"
+)
+
+// Diff renders the difference between two values of the same type in the style of the Terraform plan, e.g.
+// `~ attr = "a" -> "b"`. The schema block is used to tell the nested blocks from the attributes, and the sensitive
+// attributes, whose values are redacted. The unchanged attributes, elements and blocks are hidden.
+// It returns an empty string if the values are the same.
+func Diff(old, new cty.Value, block *tfjson.SchemaBlock, opts Options) string {
+	if opts.Normalize && block != nil {
+		old, new = tfstate.Normalize(old, block), tfstate.Normalize(new, block)
+	}
+	if old.RawEquals(new) {
+		return ""
+	}
+	var buf strings.Builder
+	d := differ{r: valueRenderer{width: opts.Width}, color: opts.Color}
+	d.blockBody(&buf, 0, old, new, block, sensitivity{}, sensitivity{})
+	return buf.String()
+}
+
+// ResourceDiff renders the difference between two objects of a resource instance, e.g. two snapshots of a resource
+// taken at different time. Either of them can be nil, which means the resource is created or deleted.
+// The schema of the resource is looked up from the Schemas of the options. Without it, all the values are rendered
+// as attributes. It returns an empty string if there is no difference.
+func ResourceDiff(old, new *tfstate.StateResource, opts Options) (string, error) {
+	res := new
+	if res == nil {
+		res = old
+	}
+	if res == nil {
+		return "", nil
+	}
+
+	var (
+		oldVal, newVal   = cty.NilVal, cty.NilVal
+		oldSens, newSens sensitivity
+		err              error
+	)
+	if old, err = opts.Ignore.Resource(old); err != nil {
+		return "", err
+	}
+	if new, err = opts.Ignore.Resource(new); err != nil {
+		return "", err
+	}
+	if old != nil {
+		oldVal = old.Value
+		if oldSens, err = newSensitivity(old.SensitiveValues); err != nil {
+			return "", fmt.Errorf("resource %q: %v", old.Address, err)
+		}
+	}
+	if new != nil {
+		newVal = new.Value
+		if newSens, err = newSensitivity(new.SensitiveValues); err != nil {
+			return "", fmt.Errorf("resource %q: %v", new.Address, err)
+		}
+	}
+	if opts.ShowSensitive {
+		oldSens, newSens = sensitivity{}, sensitivity{}
+	}
+	var block *tfjson.SchemaBlock
+	if opts.Schemas != nil {
+		if schema, err := tfstate.LookupResourceSchema(opts.Schemas, res.ProviderName, res.Mode, res.Type); err == nil {
+			block = schema.Block
+		}
+	}
+	if opts.Normalize && block != nil {
+		oldVal, newVal = tfstate.Normalize(oldVal, block), tfstate.Normalize(newVal, block)
+	}
+
+	if oldVal == cty.NilVal {
+		oldVal = cty.NullVal(newVal.Type())
+	}
+	if newVal == cty.NilVal {
+		newVal = cty.NullVal(oldVal.Type())
+	}
+	if oldVal.RawEquals(newVal) {
+		return "", nil
+	}
+
+	d := differ{r: valueRenderer{width: opts.Width}, color: opts.Color}
+	act := valueAction(oldVal, newVal)
+	var buf strings.Builder
+	switch act {
+	case actionCreate:
+		buf.WriteString(colorize(opts.Color, colorBold, "# "+res.Address+" has been created") + "\n")
+	case actionDelete:
+		buf.WriteString(colorize(opts.Color, colorBold, "# "+res.Address+" has been deleted") + "\n")
+	default:
+		buf.WriteString(colorize(opts.Color, colorBold, "# "+res.Address+" has changed") + "\n")
+	}
+	keyword := "resource"
+	if res.Mode == tfjson.DataResourceMode {
+		keyword = "data"
+	}
+	d.line(&buf, 0, act, fmt.Sprintf("%s %s %s {", keyword, quoteString(res.Type), quoteString(res.Name)))
+	d.blockBody(&buf, 1, oldVal, newVal, block, oldSens, newSens)
+	buf.WriteString(indentOf(0) + "    }\n")
+	return buf.String(), nil
+}
+
+type differ struct {
+	r     valueRenderer
+	color bool
+}
+
+// line writes a line with the action symbol, where the symbol is placed right before the text of the indent level.
+func (d differ) line(buf *strings.Builder, indent int, act action, text string) {
+	sym := string(act)
+	switch act {
+	case actionCreate:
+		sym = colorize(d.color, colorGreen, sym)
+	case actionDelete:
+		sym = colorize(d.color, colorRed, sym)
+	case actionUpdate:
+		sym = colorize(d.color, colorYellow, sym)
+	}
+	buf.WriteString(indentOf(indent) + "  " + sym + " " + text + "\n")
+}
+
+func (d differ) hidden(buf *strings.Builder, indent, n int, kind string) {
+	if n == 0 {
+		return
+	}
+	if n > 1 {
+		kind += "s"
+	}
+	d.line(buf, indent, actionNoOp, fmt.Sprintf("# (%d unchanged %s hidden)", n, kind))
+}
+
+func valueAction(old, new cty.Value) action {
+	switch {
+	case old.IsNull() && new.IsNull():
+		return actionNoOp
+	case old.IsNull():
+		return actionCreate
+	case new.IsNull():
+		return actionDelete
+	default:
+		return actionUpdate
+	}
+}
+
+// blockBody writes the difference of the attributes, followed by the nested blocks, of two object values of the
+// block. Either of the values can be null.
+func (d differ) blockBody(buf *strings.Builder, indent int, old, new cty.Value, block *tfjson.SchemaBlock, oldSens, newSens sensitivity) {
+	names := map[string]bool{}
+	for _, v := range []cty.Value{old, new} {
+		if v.Type().IsObjectType() {
+			for name := range v.Type().AttributeTypes() {
+				names[name] = true
+			}
+		}
+	}
+
+	type entry struct {
+		key              string
+		old, new         cty.Value
+		oldSens, newSens sensitivity
+	}
+	var (
+		attrs      []entry
+		blockNames []string
+		unchanged  int
+	)
+	for name := range names {
+		if block != nil {
+			if _, ok := block.NestedBlocks[name]; ok {
+				blockNames = append(blockNames, name)
+				continue
+			}
+		}
+		o, n := objectAttr(old, name), objectAttr(new, name)
+		if o.RawEquals(n) || (o.IsNull() && n.IsNull()) {
+			if !o.IsNull() {
+				unchanged++
+			}
+			continue
+		}
+		os, ns := oldSens.Attr(name), newSens.Attr(name)
+		if block != nil {
+			if attr, ok := block.Attributes[name]; ok && attr.Sensitive {
+				os, ns = sensitivity{v: true}, sensitivity{v: true}
+			}
+		}
+		attrs = append(attrs, entry{key: attrKey(name), old: o, new: n, oldSens: os, newSens: ns})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].key < attrs[j].key })
+	sort.Strings(blockNames)
+
+	var keys []string
+	for _, attr := range attrs {
+		keys = append(keys, attr.key)
+	}
+	pad := maxLen(keys)
+	for _, attr := range attrs {
+		d.value(buf, indent, fmt.Sprintf("%-*s = ", pad, attr.key), attr.old, attr.new, attr.oldSens, attr.newSens, "")
+	}
+	d.hidden(buf, indent, unchanged, "attribute")
+
+	var unchangedBlocks int
+	for _, name := range blockNames {
+		unchangedBlocks += d.nestedBlock(buf, indent, name, objectAttr(old, name), objectAttr(new, name), block.NestedBlocks[name], oldSens.Attr(name), newSens.Attr(name))
+	}
+	if unchangedBlocks != 0 {
+		buf.WriteString("\n")
+		d.hidden(buf, indent, unchangedBlocks, "block")
+	}
+}
+
+// nestedBlock writes the difference of the nested blocks of a block type, and returns the count of unchanged blocks.
+func (d differ) nestedBlock(buf *strings.Builder, indent int, name string, old, new cty.Value, nb *tfjson.SchemaBlockType, oldSens, newSens sensitivity) int {
+	var unchanged int
+	write := func(label string, o, n cty.Value, os, ns sensitivity) {
+		if o.RawEquals(n) || (o.IsNull() && n.IsNull()) {
+			if !o.IsNull() {
+				unchanged++
+			}
+			return
+		}
+		header := name
+		if label != "" {
+			header += " " + quoteString(label)
+		}
+		act := valueAction(o, n)
+		buf.WriteString("\n")
+		if os.IsSensitive() || ns.IsSensitive() {
+			d.line(buf, indent, act, header+" {")
+			d.line(buf, indent+1, actionNoOp, "# At least one attribute in this block is (or was) sensitive,")
+			d.line(buf, indent+1, actionNoOp, "# so its contents will not be displayed.")
+			buf.WriteString(indentOf(indent) + "    }\n")
+			return
+		}
+		d.line(buf, indent, act, header+" {")
+		d.blockBody(buf, indent+1, o, n, nb.Block, os, ns)
+		buf.WriteString(indentOf(indent) + "    }\n")
+	}
+
+	switch nb.NestingMode {
+	case tfjson.SchemaNestingModeList:
+		olds, news := elements(old), elements(new)
+		for i := 0; i < len(olds) || i < len(news); i++ {
+			o, n := cty.NullVal(blockType(old, new)), cty.NullVal(blockType(old, new))
+			if i < len(olds) {
+				o = olds[i]
+			}
+			if i < len(news) {
+				n = news[i]
+			}
+			write("", o, n, oldSens.Index(i), newSens.Index(i))
+		}
+	case tfjson.SchemaNestingModeSet:
+		ety := blockType(old, new)
+		for _, p := range matchSetElements(elements(old), elements(new)) {
+			o, n := cty.NullVal(ety), cty.NullVal(ety)
+			os, ns := sensitivity{}, sensitivity{}
+			if p.old >= 0 {
+				o, os = elements(old)[p.old], oldSens.Index(p.old)
+			}
+			if p.new >= 0 {
+				n, ns = elements(new)[p.new], newSens.Index(p.new)
+			}
+			write("", o, n, os, ns)
+		}
+	case tfjson.SchemaNestingModeMap:
+		ety := blockType(old, new)
+		for _, key := range mapKeys(old, new) {
+			o, n := cty.NullVal(ety), cty.NullVal(ety)
+			if v, ok := mapElement(old, key); ok {
+				o = v
+			}
+			if v, ok := mapElement(new, key); ok {
+				n = v
+			}
+			write(key, o, n, oldSens.Attr(key), newSens.Attr(key))
+		}
+	default:
+		write("", old, new, oldSens, newSens)
+	}
+	return unchanged
+}
+
+// value writes the difference of two values, with the prefix (e.g. the attribute name) and the suffix (e.g. the comma
+// of the list elements) of the first and the last line. It returns false if the values are the same.
+func (d differ) value(buf *strings.Builder, indent int, prefix string, old, new cty.Value, oldSens, newSens sensitivity, suffix string) bool {
+	if old.RawEquals(new) || (old.IsNull() && new.IsNull()) {
+		return false
+	}
+	act := valueAction(old, new)
+	// The deleted elements of lists and sets (i.e. without prefix) are not followed by "-> null".
+	nullSuffix := ""
+	if act == actionDelete && prefix != "" {
+		nullSuffix = " -> null"
+	}
+
+	if oldSens.IsSensitive() || newSens.IsSensitive() {
+		text := prefix + sensitiveValue + nullSuffix
+		d.line(buf, indent, act, text+suffix)
+		return true
+	}
+
+	ty := new.Type()
+	if new.IsNull() {
+		ty = old.Type()
+	}
+	isCollection := ty.IsListType() || ty.IsSetType() || ty.IsTupleType() || ty.IsMapType() || ty.IsObjectType()
+	if !isCollection || !old.IsKnown() || !new.IsKnown() || (act == actionUpdate && !old.Type().Equals(new.Type())) {
+		switch act {
+		case actionCreate:
+			d.line(buf, indent, act, prefix+d.r.value(new, sensitivity{}, indent+1)+suffix)
+		case actionDelete:
+			d.line(buf, indent, act, prefix+d.r.value(old, sensitivity{}, indent+1)+nullSuffix+suffix)
+		default:
+			if isKnownString(old) && isKnownString(new) && (strings.Contains(old.AsString(), "\n") || strings.Contains(new.AsString(), "\n")) {
+				d.heredoc(buf, indent, prefix, old.AsString(), new.AsString(), suffix)
+				return true
+			}
+			d.line(buf, indent, act, prefix+d.r.value(old, sensitivity{}, indent+1)+" -> "+d.r.value(new, sensitivity{}, indent+1)+suffix)
+		}
+		return true
+	}
+
+	open, close := "{", "}"
+	if ty.IsListType() || ty.IsSetType() || ty.IsTupleType() {
+		open, close = "[", "]"
+	}
+	if (old.IsNull() || old.LengthInt() == 0) && (new.IsNull() || new.LengthInt() == 0) {
+		switch act {
+		case actionCreate, actionDelete:
+			d.line(buf, indent, act, prefix+open+close+nullSuffix+suffix)
+		default:
+			// The null and empty collections are regarded as different values
+			d.line(buf, indent, act, prefix+d.r.value(old, sensitivity{}, indent+1)+" -> "+d.r.value(new, sensitivity{}, indent+1)+suffix)
+		}
+		return true
+	}
+
+	d.line(buf, indent, act, prefix+open)
+	switch {
+	case ty.IsMapType(), ty.IsObjectType():
+		d.mapElements(buf, indent+1, old, new, ty.IsObjectType(), oldSens, newSens)
+	case ty.IsSetType():
+		d.setElements(buf, indent+1, old, new, oldSens, newSens)
+	default:
+		d.listElements(buf, indent+1, old, new, oldSens, newSens)
+	}
+	buf.WriteString(indentOf(indent) + "    " + close + nullSuffix + suffix + "\n")
+	return true
+}
+
+// isKnownString tells whether the value is a known and non-null string.
+func isKnownString(v cty.Value) bool {
+	return v.IsKnown() && !v.IsNull() && v.Type() == cty.String
+}
+
+func (d differ) mapElements(buf *strings.Builder, indent int, old, new cty.Value, isObject bool, oldSens, newSens sensitivity) {
+	keys := mapKeys(old, new)
+	type entry struct {
+		key, label string
+		old, new   cty.Value
+	}
+	var (
+		entries   []entry
+		unchanged int
+	)
+	for _, key := range keys {
+		o, ook := mapElement(old, key)
+		n, nok := mapElement(new, key)
+		switch {
+		case !ook:
+			o = cty.NullVal(n.Type())
+		case !nok:
+			n = cty.NullVal(o.Type())
+		}
+		if o.RawEquals(n) {
+			if !(isObject && o.IsNull()) {
+				unchanged++
+			}
+			continue
+		}
+		label := quoteString(key)
+		if isObject {
+			label = attrKey(key)
+		}
+		entries = append(entries, entry{key: key, label: label, old: o, new: n})
+	}
+	var labels []string
+	for _, e := range entries {
+		labels = append(labels, e.label)
+	}
+	pad := maxLen(labels)
+	for _, e := range entries {
+		d.value(buf, indent, fmt.Sprintf("%-*s = ", pad, e.label), e.old, e.new, oldSens.Attr(e.key), newSens.Attr(e.key), "")
+	}
+	kind := "element"
+	if isObject {
+		kind = "attribute"
+	}
+	d.hidden(buf, indent, unchanged, kind)
+}
+
+func (d differ) listElements(buf *strings.Builder, indent int, old, new cty.Value, oldSens, newSens sensitivity) {
+	olds, news := elements(old), elements(new)
+	var unchanged int
+	for _, op := range lcs(len(olds), len(news), func(i, j int) bool { return olds[i].RawEquals(news[j]) }) {
+		switch op.kind {
+		case actionNoOp:
+			unchanged++
+		case actionDelete:
+			d.value(buf, indent, "", olds[op.old], cty.NullVal(olds[op.old].Type()), oldSens.Index(op.old), sensitivity{}, ",")
+		case actionCreate:
+			d.value(buf, indent, "", cty.NullVal(news[op.new].Type()), news[op.new], sensitivity{}, newSens.Index(op.new), ",")
+		}
+	}
+	d.hidden(buf, indent, unchanged, "element")
+}
+
+func (d differ) setElements(buf *strings.Builder, indent int, old, new cty.Value, oldSens, newSens sensitivity) {
+	olds, news := elements(old), elements(new)
+	var unchanged int
+	for _, p := range matchSetElements(olds, news) {
+		switch {
+		case p.old >= 0 && p.new >= 0 && olds[p.old].RawEquals(news[p.new]):
+			unchanged++
+		case p.old >= 0 && p.new >= 0:
+			d.value(buf, indent, "", olds[p.old], news[p.new], oldSens.Index(p.old), newSens.Index(p.new), ",")
+		case p.old >= 0:
+			d.value(buf, indent, "", olds[p.old], cty.NullVal(olds[p.old].Type()), oldSens.Index(p.old), sensitivity{}, ",")
+		default:
+			d.value(buf, indent, "", cty.NullVal(news[p.new].Type()), news[p.new], sensitivity{}, newSens.Index(p.new), ",")
+		}
+	}
+	d.hidden(buf, indent, unchanged, "element")
+}
+
+// heredoc writes the line by line difference of two multi-line strings.
+func (d differ) heredoc(buf *strings.Builder, indent int, prefix, old, new, suffix string) {
+	olds := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	news := strings.Split(strings.TrimSuffix(new, "\n"), "\n")
+	d.line(buf, indent, actionUpdate, prefix+"<<-EOT")
+	for _, op := range lcs(len(olds), len(news), func(i, j int) bool { return olds[i] == news[j] }) {
+		switch op.kind {
+		case actionNoOp:
+			d.line(buf, indent+1, actionNoOp, templateEscaper.Replace(olds[op.old]))
+		case actionDelete:
+			d.line(buf, indent+1, actionDelete, templateEscaper.Replace(olds[op.old]))
+		case actionCreate:
+			d.line(buf, indent+1, actionCreate, templateEscaper.Replace(news[op.new]))
+		}
+	}
+	buf.WriteString(indentOf(indent+1) + "EOT" + suffix + "\n")
+}
+
+type lcsOp struct {
+	kind     action
+	old, new int
+}
+
+// lcs returns the edit operations from a sequence of length n to another of length m, based on their longest common
+// subsequence. The deletions come before the creations between two unchanged elements.
+func lcs(n, m int, equal func(i, j int) bool) []lcsOp {
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] >= table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+	var ops []lcsOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && equal(i, j):
+			ops = append(ops, lcsOp{kind: actionNoOp, old: i, new: j})
+			i++
+			j++
+		case j >= m || (i < n && table[i+1][j] >= table[i][j+1]):
+			ops = append(ops, lcsOp{kind: actionDelete, old: i, new: -1})
+			i++
+		default:
+			ops = append(ops, lcsOp{kind: actionCreate, old: -1, new: j})
+			j++
+		}
+	}
+	return ops
+}
+
+type setPair struct {
+	old, new int
+}
+
+// matchSetElements pairs the elements of the old and new sets, where -1 means no counterpart. The equal elements are
+// paired first. Then each remaining old object element is paired with the remaining new object element sharing
+// the most attribute values (at least one), so that an updated element is rendered as an update, rather than
+// a deletion plus a creation. The pairs follow the order of the old elements, followed by the new elements only.
+func matchSetElements(olds, news []cty.Value) []setPair {
+	oldPair := make([]int, len(olds))
+	newPaired := make([]bool, len(news))
+	for i := range oldPair {
+		oldPair[i] = -1
+	}
+	for i, o := range olds {
+		for j, n := range news {
+			if !newPaired[j] && o.RawEquals(n) {
+				oldPair[i] = j
+				newPaired[j] = true
+				break
+			}
+		}
+	}
+	for i, o := range olds {
+		if oldPair[i] != -1 || !o.Type().IsObjectType() || o.IsNull() || !o.IsKnown() {
+			continue
+		}
+		best, bestScore := -1, 0
+		for j, n := range news {
+			if newPaired[j] || !n.Type().Equals(o.Type()) || n.IsNull() || !n.IsKnown() {
+				continue
+			}
+			var score int
+			for name := range o.Type().AttributeTypes() {
+				if ov := o.GetAttr(name); !ov.IsNull() && ov.RawEquals(n.GetAttr(name)) {
+					score++
+				}
+			}
+			if score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best != -1 {
+			oldPair[i] = best
+			newPaired[best] = true
+		}
+	}
+
+	var ret []setPair
+	for i, j := range oldPair {
+		ret = append(ret, setPair{old: i, new: j})
+	}
+	for j, paired := range newPaired {
+		if !paired {
+			ret = append(ret, setPair{old: -1, new: j})
+		}
+	}
+	return ret
+}
+
+func objectAttr(v cty.Value, name string) cty.Value {
+	if !v.Type().IsObjectType() || !v.Type().HasAttribute(name) {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	if v.IsNull() {
+		return cty.NullVal(v.Type().AttributeType(name))
+	}
+	return v.GetAttr(name)
+}
+
+func elements(v cty.Value) []cty.Value {
+	if v.IsNull() || !v.IsKnown() || !v.CanIterateElements() {
+		return nil
+	}
+	var ret []cty.Value
+	for it := v.ElementIterator(); it.Next(); {
+		_, e := it.Element()
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+func mapKeys(old, new cty.Value) []string {
+	keys := map[string]bool{}
+	for _, v := range []cty.Value{old, new} {
+		if v.IsNull() || !v.IsKnown() || !v.CanIterateElements() {
+			continue
+		}
+		for it := v.ElementIterator(); it.Next(); {
+			k, _ := it.Element()
+			keys[k.AsString()] = true
+		}
+	}
+	ret := make([]string, 0, len(keys))
+	for k := range keys {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func mapElement(v cty.Value, key string) (cty.Value, bool) {
+	if v.IsNull() || !v.IsKnown() {
+		return cty.NilVal, false
+	}
+	if v.Type().IsObjectType() {
+		if !v.Type().HasAttribute(key) {
+			return cty.NilVal, false
+		}
+		return v.GetAttr(key), true
+	}
+	k := cty.StringVal(key)
+	if !v.HasIndex(k).True() {
+		return cty.NilVal, false
+	}
+	return v.Index(k), true
+}
+
+// blockType returns the element type of the nested block collections.
+func blockType(old, new cty.Value) cty.Type {
+	for _, v := range []cty.Value{new, old} {
+		ty := v.Type()
+		if ty.IsListType() || ty.IsSetType() || ty.IsMapType() {
+			return ty.ElementType()
+		}
+	}
+	return cty.DynamicPseudoType
+}
@@ -0,0 +1,200 @@
+package render_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate/render"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDiff(t *testing.T) {
+	block := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name":      {AttributeType: cty.String},
+			"password":  {AttributeType: cty.String, Sensitive: true},
+			"tags":      {AttributeType: cty.Map(cty.String)},
+			"ports":     {AttributeType: cty.List(cty.Number)},
+			"user_data": {AttributeType: cty.String},
+			"note":      {AttributeType: cty.String},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"rule": {
+				NestingMode: tfjson.SchemaNestingModeSet,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"name": {AttributeType: cty.String},
+						"port": {AttributeType: cty.Number},
+					},
+				},
+			},
+			"disk": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"size": {AttributeType: cty.Number},
+					},
+				},
+			},
+		},
+	}
+	rule := func(name string, port int64) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal(name), "port": cty.NumberIntVal(port)})
+	}
+	disk := func(size int64) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(size)})
+	}
+	old := cty.ObjectVal(map[string]cty.Value{
+		"name":      cty.StringVal("web"),
+		"password":  cty.StringVal("a"),
+		"tags":      cty.MapVal(map[string]cty.Value{"env": cty.StringVal("dev"), "team": cty.StringVal("infra"), "old": cty.StringVal("x")}),
+		"ports":     cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+		"user_data": cty.StringVal("line1\nline2\nline3\n"),
+		"note":      cty.NullVal(cty.String),
+		"rule":      cty.SetVal([]cty.Value{rule("http", 80), rule("https", 443), rule("ssh", 22)}),
+		"disk":      cty.ListVal([]cty.Value{disk(10), disk(20)}),
+	})
+	new := cty.ObjectVal(map[string]cty.Value{
+		"name":      cty.StringVal("web"),
+		"password":  cty.StringVal("b"),
+		"tags":      cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod"), "team": cty.StringVal("infra"), "new": cty.StringVal("y")}),
+		"ports":     cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(8080)}),
+		"user_data": cty.StringVal("line1\nline2 changed\nline3\n"),
+		"note":      cty.StringVal("hello"),
+		"rule":      cty.SetVal([]cty.Value{rule("http", 80), rule("https", 8443), rule("rdp", 3389)}),
+		"disk":      cty.ListVal([]cty.Value{disk(10)}),
+	})
+
+	expect := `  + note      = "hello"
+  ~ password  = (sensitive value)
+  ~ ports     = [
+      - 443,
+      + 8080,
+        # (1 unchanged element hidden)
+    ]
+  ~ tags      = {
+      ~ "env" = "dev" -> "prod"
+      + "new" = "y"
+      - "old" = "x" -> null
+        # (1 unchanged element hidden)
+    }
+  ~ user_data = <<-EOT
+        line1
+      - line2
+      + line2 changed
+        line3
+    EOT
+    # (1 unchanged attribute hidden)
+
+  - disk {
+      - size = 20 -> null
+    }
+
+  ~ rule {
+      ~ port = 443 -> 8443
+        # (1 unchanged attribute hidden)
+    }
+
+  - rule {
+      - name = "ssh" -> null
+      - port = 22 -> null
+    }
+
+  + rule {
+      + name = "rdp"
+      + port = 3389
+    }
+
+    # (2 unchanged blocks hidden)
+`
+	require.Equal(t, expect, render.Diff(old, new, block, render.Options{}))
+	require.Equal(t, "", render.Diff(old, old, block, render.Options{}))
+
+	// The null and empty collections are the same after normalization.
+	block = &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"tags": {AttributeType: cty.Map(cty.String), Optional: true},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"disk": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"size": {AttributeType: cty.Number, Optional: true},
+					},
+				},
+			},
+		},
+	}
+	diskType := cty.Object(map[string]cty.Type{"size": cty.Number})
+	old = cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.NullVal(cty.Map(cty.String)),
+		"disk": cty.ListValEmpty(diskType),
+	})
+	new = cty.ObjectVal(map[string]cty.Value{
+		"tags": cty.MapValEmpty(cty.String),
+		"disk": cty.NullVal(cty.List(diskType)),
+	})
+	require.NotEqual(t, "", render.Diff(old, new, block, render.Options{}))
+	require.Equal(t, "", render.Diff(old, new, block, render.Options{Normalize: true}))
+}
+
+func TestDiffUnknownAndTypeChange(t *testing.T) {
+	block := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"id":        {AttributeType: cty.String, Computed: true},
+			"user_data": {AttributeType: cty.String},
+			"any":       {AttributeType: cty.DynamicPseudoType},
+		},
+	}
+	old := cty.ObjectVal(map[string]cty.Value{
+		"id":        cty.StringVal("a"),
+		"user_data": cty.StringVal("line1\nline2\n"),
+		"any":       cty.NumberIntVal(1),
+	})
+	new := cty.ObjectVal(map[string]cty.Value{
+		"id":        cty.UnknownVal(cty.String),
+		"user_data": cty.UnknownVal(cty.String),
+		"any":       cty.StringVal("x\ny"),
+	})
+	// The unknown values and the values changing type are not rendered as heredoc diffs.
+	expect := `  ~ any       = 1 -> <<-EOT
+        x
+        y
+    EOT
+  ~ id        = "a" -> (known after apply)
+  ~ user_data = <<-EOT
+        line1
+        line2
+    EOT -> (known after apply)
+`
+	require.Equal(t, expect, render.Diff(old, new, block, render.Options{}))
+}
+
+func TestResourceDiff(t *testing.T) {
+	state, schemas := loadState(t)
+	res := state.Values.RootModule.Resources[0]
+
+	newRes := *res
+	newRes.Value = cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("ami-654321")})
+	actual, err := render.ResourceDiff(res, &newRes, render.Options{Schemas: schemas})
+	require.NoError(t, err)
+	require.Equal(t, `# data.test_image.ubuntu has changed
+  ~ data "test_image" "ubuntu" {
+      ~ id = "ami-123456" -> "ami-654321"
+    }
+`, actual)
+
+	actual, err = render.ResourceDiff(res, nil, render.Options{Schemas: schemas})
+	require.NoError(t, err)
+	require.Equal(t, `# data.test_image.ubuntu has been deleted
+  - data "test_image" "ubuntu" {
+      - id = "ami-123456" -> null
+    }
+`, actual)
+
+	actual, err = render.ResourceDiff(res, res, render.Options{Schemas: schemas})
+	require.NoError(t, err)
+	require.Empty(t, actual)
+}
@@ -0,0 +1,226 @@
+// Package render renders the state in the human readable, HCL-like format that `terraform show` uses, with the
+// sensitive values redacted.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/ignore"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+)
+
+type Options struct {
+	// Schemas are the provider schemas, which are used to render the nested blocks of the resources as blocks.
+	// Without the schema of a resource, all its values are rendered as attributes.
+	Schemas *tfjson.ProviderSchemas
+
+	// Width is the maximum width of a line, within which the collections of primitive values are rendered inline.
+	// The collections are always rendered across multiple lines if it is zero, as `terraform show` does.
+	Width int
+
+	// Color enables the ANSI color codes in the output.
+	Color bool
+
+	// Filter selects the resources to render, all resources are rendered if it is nil.
+	Filter func(res *tfstate.StateResource) bool
+
+	// NoOutputs omits the outputs.
+	NoOutputs bool
+
+	// ShowSensitive renders the sensitive values as is, instead of redacting them.
+	ShowSensitive bool
+
+	// Normalize normalizes the values via tfstate.Normalize before diffing, so that the null and empty collections
+	// are not reported as differences. It only applies to the values with the schema.
+	Normalize bool
+
+	// Ignore is the rule set of the attributes to ignore, which are neither rendered nor diffed.
+	Ignore *ignore.Rules
+}
+
+// State renders the resources (in the order of the state) and the outputs (sorted by name) of the state.
+func State(state *tfstate.State, opts Options) (string, error) {
+	if state == nil || state.Values == nil {
+		return "", nil
+	}
+
+	var blocks []string
+	var f func(*tfstate.StateModule) error
+	f = func(module *tfstate.StateModule) error {
+		if module == nil {
+			return nil
+		}
+		for _, res := range module.Resources {
+			if opts.Filter != nil && !opts.Filter(res) {
+				continue
+			}
+			out, err := Resource(res, opts)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, out)
+		}
+		for _, module := range module.ChildModules {
+			if err := f(module); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := f(state.Values.RootModule); err != nil {
+		return "", err
+	}
+
+	if !opts.NoOutputs && len(state.Values.Outputs) != 0 {
+		out, err := outputs(state.Values.Outputs, opts)
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, out)
+	}
+	return strings.Join(blocks, "\n"), nil
+}
+
+// Resource renders a resource instance object.
+func Resource(res *tfstate.StateResource, opts Options) (string, error) {
+	res, err := opts.Ignore.Resource(res)
+	if err != nil {
+		return "", err
+	}
+	sens, err := newSensitivity(res.SensitiveValues)
+	if err != nil {
+		return "", fmt.Errorf("resource %q: %v", res.Address, err)
+	}
+	if opts.ShowSensitive {
+		sens = sensitivity{}
+	}
+	var block *tfjson.SchemaBlock
+	if opts.Schemas != nil {
+		if schema, err := tfstate.LookupResourceSchema(opts.Schemas, res.ProviderName, res.Mode, res.Type); err == nil {
+			block = schema.Block
+		}
+	}
+
+	var buf strings.Builder
+	header := "# " + res.Address + ":"
+	buf.WriteString(colorize(opts.Color, colorBold, header))
+	switch {
+	case res.DeposedKey != "":
+		buf.WriteString(" " + colorize(opts.Color, colorRed, fmt.Sprintf("(deposed object %s)", res.DeposedKey)))
+	case res.Tainted:
+		buf.WriteString(" " + colorize(opts.Color, colorRed, "(tainted)"))
+	}
+	buf.WriteString("\n")
+
+	keyword := "resource"
+	if res.Mode == tfjson.DataResourceMode {
+		keyword = "data"
+	}
+	fmt.Fprintf(&buf, "%s %s %s {\n", keyword, quoteString(res.Type), quoteString(res.Name))
+	if res.Value != cty.NilVal {
+		valueRenderer{width: opts.Width}.blockBody(&buf, res.Value, block, sens, 1)
+	}
+	buf.WriteString("}\n")
+	return buf.String(), nil
+}
+
+func outputs(outputs map[string]*tfstate.StateOutput, opts Options) (string, error) {
+	var names []string
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	buf.WriteString(colorize(opts.Color, colorBold, "Outputs:") + "\n\n")
+	for _, name := range names {
+		output := outputs[name]
+		if output == nil {
+			continue
+		}
+		var sens sensitivity
+		if output.Sensitive && !opts.ShowSensitive {
+			sens.v = true
+		}
+		val, err := outputValue(output.Value)
+		if err != nil {
+			return "", fmt.Errorf("output %q: %v", name, err)
+		}
+		fmt.Fprintf(&buf, "%s = %s\n", attrKey(name), valueRenderer{width: opts.Width}.value(val, sens, 0))
+	}
+	return buf.String(), nil
+}
+
+// Value renders a single value in the HCL-like format, e.g. an attribute of a resource. No value is redacted.
+func Value(val cty.Value, opts Options) string {
+	return valueRenderer{width: opts.Width}.value(val, sensitivity{}, 0)
+}
+
+// outputValue converts the JSON decoded value of an output to a cty value, with the implied type.
+func outputValue(v interface{}) (cty.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("marshal value: %v", err)
+	}
+	ty, err := ctyjson.ImpliedType(b)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("implying type: %v", err)
+	}
+	return ctyjson.Unmarshal(b, ty)
+}
+
+// FilterAddresses returns a filter that selects the resources matching any of the addresses, which can be of a
+// module instance (matching all resources in it and its descendants), a resource (matching all its instances)
+// or a resource instance.
+func FilterAddresses(addresses ...string) (func(res *tfstate.StateResource) bool, error) {
+	var addrs []tfstate.Address
+	for _, address := range addresses {
+		addr, err := tfstate.ParseAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return func(res *tfstate.StateResource) bool {
+		resAddr, err := tfstate.ParseAddress(res.Address)
+		if err != nil {
+			return false
+		}
+		for _, addr := range addrs {
+			switch {
+			case addr.IsModule():
+				if resAddr.ModuleContains(addr.Module) {
+					return true
+				}
+			case addr.Key == nil:
+				if resAddr.ResourceAddress().Equal(addr) {
+					return true
+				}
+			default:
+				if resAddr.Equal(addr) {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+func colorize(enabled bool, color, s string) string {
+	if !enabled {
+		return s
+	}
+	return color + s + colorReset
+}
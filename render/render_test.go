@@ -0,0 +1,230 @@
+package render_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/render"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchemas = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/test": {
+      "resource_schemas": {
+        "test_server": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "id": {"type": "string", "computed": true},
+              "name": {"type": "string", "required": true},
+              "password": {"type": "string", "optional": true, "sensitive": true},
+              "user_data": {"type": "string", "optional": true},
+              "tags": {"type": ["map", "string"], "optional": true},
+              "ports": {"type": ["set", "number"], "optional": true},
+              "description": {"type": "string", "optional": true}
+            },
+            "block_types": {
+              "disk": {
+                "nesting_mode": "list",
+                "block": {
+                  "attributes": {
+                    "size": {"type": "number", "required": true},
+                    "encrypted": {"type": "bool", "optional": true}
+                  }
+                }
+              },
+              "timeouts": {
+                "nesting_mode": "single",
+                "block": {
+                  "attributes": {
+                    "create": {"type": "string", "optional": true}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "data_source_schemas": {
+        "test_image": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "id": {"type": "string", "computed": true}
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const testState = `{
+  "format_version": "1.0",
+  "values": {
+    "outputs": {
+      "name": {"sensitive": false, "value": "web", "type": "string"},
+      "secret": {"sensitive": true, "value": "s3cr3t", "type": "string"},
+      "ports": {"sensitive": false, "value": [80, 443], "type": ["list", "number"]}
+    },
+    "root_module": {
+      "resources": [
+        {
+          "address": "data.test_image.ubuntu",
+          "mode": "data",
+          "type": "test_image",
+          "name": "ubuntu",
+          "provider_name": "registry.terraform.io/hashicorp/test",
+          "values": {"id": "ami-123456"},
+          "sensitive_values": {}
+        },
+        {
+          "address": "test_server.web",
+          "mode": "managed",
+          "type": "test_server",
+          "name": "web",
+          "provider_name": "registry.terraform.io/hashicorp/test",
+          "values": {
+            "id": "srv-1",
+            "name": "web",
+            "password": "hunter2",
+            "user_data": "#!/bin/sh\necho ${HOME}\n",
+            "tags": {"env": "prod", "team name": "infra"},
+            "ports": [80, 443],
+            "description": null,
+            "disk": [{"size": 10, "encrypted": true}, {"size": 20, "encrypted": null}],
+            "timeouts": null
+          },
+          "sensitive_values": {"password": true, "disk": [{}, {}]},
+          "tainted": true
+        }
+      ]
+    }
+  }
+}`
+
+func loadState(t *testing.T) (*tfstate.State, *tfjson.ProviderSchemas) {
+	var schemas tfjson.ProviderSchemas
+	require.NoError(t, json.Unmarshal([]byte(testSchemas), &schemas))
+	var rawState tfjson.State
+	require.NoError(t, json.Unmarshal([]byte(testState), &rawState))
+	state, err := tfstate.FromJSONState(&rawState, &schemas)
+	require.NoError(t, err)
+	return state, &schemas
+}
+
+func TestState(t *testing.T) {
+	state, schemas := loadState(t)
+
+	cases := []struct {
+		name   string
+		opts   render.Options
+		expect string
+	}{
+		{
+			name: "with schema",
+			opts: render.Options{Schemas: schemas},
+			expect: `# data.test_image.ubuntu:
+data "test_image" "ubuntu" {
+    id = "ami-123456"
+}
+
+# test_server.web: (tainted)
+resource "test_server" "web" {
+    id        = "srv-1"
+    name      = "web"
+    password  = (sensitive value)
+    ports     = [
+        80,
+        443,
+    ]
+    tags      = {
+        "env"       = "prod"
+        "team name" = "infra"
+    }
+    user_data = <<-EOT
+        #!/bin/sh
+        echo $${HOME}
+    EOT
+
+    disk {
+        encrypted = true
+        size      = 10
+    }
+
+    disk {
+        size = 20
+    }
+}
+
+Outputs:
+
+name = "web"
+ports = [
+    80,
+    443,
+]
+secret = (sensitive value)
+`,
+		},
+		{
+			name: "without schema",
+			opts: render.Options{NoOutputs: true, Width: 80},
+			expect: `# data.test_image.ubuntu:
+data "test_image" "ubuntu" {
+    id = "ami-123456"
+}
+
+# test_server.web: (tainted)
+resource "test_server" "web" {
+    disk      = [{ encrypted = true, size = 10 }, { size = 20 }]
+    id        = "srv-1"
+    name      = "web"
+    password  = (sensitive value)
+    ports     = [80, 443]
+    tags      = { "env" = "prod", "team name" = "infra" }
+    user_data = <<-EOT
+        #!/bin/sh
+        echo $${HOME}
+    EOT
+}
+`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := render.State(state, tt.opts)
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, actual)
+		})
+	}
+}
+
+func TestStateFilterAndColor(t *testing.T) {
+	state, schemas := loadState(t)
+	filter, err := render.FilterAddresses("data.test_image.ubuntu")
+	require.NoError(t, err)
+	actual, err := render.State(state, render.Options{Schemas: schemas, Filter: filter, NoOutputs: true, Color: true})
+	require.NoError(t, err)
+	require.Equal(t, "\x1b[1m# data.test_image.ubuntu:\x1b[0m\ndata \"test_image\" \"ubuntu\" {\n    id = \"ami-123456\"\n}\n", actual)
+
+	_, err = render.FilterAddresses("not a valid address")
+	require.Error(t, err)
+}
+
+func TestStateShowSensitive(t *testing.T) {
+	state, schemas := loadState(t)
+	filter, err := render.FilterAddresses("test_server.web")
+	require.NoError(t, err)
+	actual, err := render.State(state, render.Options{Schemas: schemas, Filter: filter, ShowSensitive: true})
+	require.NoError(t, err)
+	require.Contains(t, actual, `password  = "hunter2"`)
+	require.Contains(t, actual, `secret = "s3cr3t"`)
+
+	res := state.Values.RootModule.Resources[1]
+	require.Equal(t, `{ "env" = "prod", "team name" = "infra" }`, render.Value(res.Value.GetAttr("tags"), render.Options{Width: 80}))
+}
@@ -0,0 +1,299 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	indentUnit     = "    "
+	sensitiveValue = "(sensitive value)"
+	unknownValue   = "(known after apply)"
+)
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// templateEscaper escapes the template sequences in the HCL strings.
+var templateEscaper = strings.NewReplacer("${", "$${", "%{", "%%{")
+
+// sensitivity is the decoded "sensitive_values" of a resource, which mirrors the structure of the value, where
+// the sensitive values are true.
+type sensitivity struct {
+	v interface{}
+}
+
+func newSensitivity(b json.RawMessage) (sensitivity, error) {
+	var s sensitivity
+	if len(b) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(b, &s.v); err != nil {
+		return s, fmt.Errorf("unmarshal sensitive values: %v", err)
+	}
+	return s, nil
+}
+
+func (s sensitivity) IsSensitive() bool {
+	b, ok := s.v.(bool)
+	return ok && b
+}
+
+func (s sensitivity) Attr(name string) sensitivity {
+	if s.IsSensitive() {
+		return s
+	}
+	m, _ := s.v.(map[string]interface{})
+	return sensitivity{v: m[name]}
+}
+
+func (s sensitivity) Index(i int) sensitivity {
+	if s.IsSensitive() {
+		return s
+	}
+	l, _ := s.v.([]interface{})
+	if i >= len(l) {
+		return sensitivity{}
+	}
+	return sensitivity{v: l[i]}
+}
+
+// valueRenderer renders the cty values in the HCL-like format that `terraform show` uses.
+type valueRenderer struct {
+	// width is the maximum width of a line, within which the collections of primitive values are rendered inline.
+	// The collections are always rendered across multiple lines if it is zero.
+	width int
+}
+
+// blockBody writes the body of a block with the given indent level, where the attributes come first (aligned by
+// their names), followed by the nested blocks. The null attributes are omitted.
+// Without the schema block, all the attributes of the value are rendered as attributes.
+func (r valueRenderer) blockBody(buf *strings.Builder, val cty.Value, block *tfjson.SchemaBlock, sens sensitivity, indent int) {
+	if val.IsNull() || !val.IsKnown() || !val.Type().IsObjectType() {
+		return
+	}
+	var attrs, blocks []string
+	for name := range val.Type().AttributeTypes() {
+		if block != nil {
+			if _, ok := block.NestedBlocks[name]; ok {
+				blocks = append(blocks, name)
+				continue
+			}
+		}
+		if val.GetAttr(name).IsNull() {
+			continue
+		}
+		attrs = append(attrs, name)
+	}
+	sort.Strings(attrs)
+	sort.Strings(blocks)
+
+	var keys []string
+	for _, name := range attrs {
+		keys = append(keys, attrKey(name))
+	}
+	pad := maxLen(keys)
+	for i, name := range attrs {
+		fmt.Fprintf(buf, "%s%-*s = %s\n", indentOf(indent), pad, keys[i], r.value(val.GetAttr(name), sens.Attr(name), indent))
+	}
+
+	for _, name := range blocks {
+		r.nestedBlock(buf, name, val.GetAttr(name), block.NestedBlocks[name], sens.Attr(name), indent)
+	}
+}
+
+func (r valueRenderer) nestedBlock(buf *strings.Builder, name string, val cty.Value, nb *tfjson.SchemaBlockType, sens sensitivity, indent int) {
+	if val.IsNull() {
+		return
+	}
+	if sens.IsSensitive() {
+		fmt.Fprintf(buf, "\n%s# At least one attribute in this block is (or was) sensitive,\n", indentOf(indent))
+		fmt.Fprintf(buf, "%s# so its contents will not be displayed.\n", indentOf(indent))
+		return
+	}
+	if !val.IsKnown() {
+		fmt.Fprintf(buf, "\n%s%s {\n%s%s\n%s}\n", indentOf(indent), name, indentOf(indent+1), unknownValue, indentOf(indent))
+		return
+	}
+	write := func(label string, v cty.Value, sens sensitivity) {
+		buf.WriteString("\n")
+		buf.WriteString(indentOf(indent))
+		buf.WriteString(name)
+		if label != "" {
+			buf.WriteString(" " + quoteString(label))
+		}
+		var body strings.Builder
+		r.blockBody(&body, v, nb.Block, sens, indent+1)
+		if body.Len() == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString(" {\n")
+		buf.WriteString(body.String())
+		buf.WriteString(indentOf(indent) + "}\n")
+	}
+	switch nb.NestingMode {
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+		i := 0
+		for it := val.ElementIterator(); it.Next(); i++ {
+			_, v := it.Element()
+			write("", v, sens.Index(i))
+		}
+	case tfjson.SchemaNestingModeMap:
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			write(k.AsString(), v, sens.Attr(k.AsString()))
+		}
+	default:
+		write("", val, sens)
+	}
+}
+
+// value returns the rendered value, where the lines after the first one are indented with the given indent level.
+func (r valueRenderer) value(val cty.Value, sens sensitivity, indent int) string {
+	switch {
+	case sens.IsSensitive():
+		return sensitiveValue
+	case !val.IsKnown():
+		return unknownValue
+	case val.IsNull():
+		return "null"
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		s := val.AsString()
+		if strings.Contains(s, "\n") {
+			return heredoc(s, indent)
+		}
+		return quoteString(s)
+	case ty == cty.Number:
+		return val.AsBigFloat().Text('f', -1)
+	case ty == cty.Bool:
+		if val.True() {
+			return "true"
+		}
+		return "false"
+	case ty.IsListType(), ty.IsSetType(), ty.IsTupleType():
+		if val.LengthInt() == 0 {
+			return "[]"
+		}
+		var elems []string
+		i := 0
+		for it := val.ElementIterator(); it.Next(); i++ {
+			_, v := it.Element()
+			elems = append(elems, r.value(v, sens.Index(i), indent+1))
+		}
+		if inline := "[" + strings.Join(elems, ", ") + "]"; r.fitsInline(inline, elems, indent) {
+			return inline
+		}
+		var buf strings.Builder
+		buf.WriteString("[\n")
+		for _, elem := range elems {
+			buf.WriteString(indentOf(indent+1) + elem + ",\n")
+		}
+		buf.WriteString(indentOf(indent) + "]")
+		return buf.String()
+	case ty.IsMapType(), ty.IsObjectType():
+		var keys, elems []string
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			name := k.AsString()
+			if ty.IsObjectType() && v.IsNull() {
+				continue
+			}
+			if ty.IsObjectType() {
+				keys = append(keys, attrKey(name))
+			} else {
+				keys = append(keys, quoteString(name))
+			}
+			elems = append(elems, r.value(v, sens.Attr(name), indent+1))
+		}
+		if len(elems) == 0 {
+			return "{}"
+		}
+		var pairs []string
+		for i := range keys {
+			pairs = append(pairs, keys[i]+" = "+elems[i])
+		}
+		if inline := "{ " + strings.Join(pairs, ", ") + " }"; r.fitsInline(inline, elems, indent) {
+			return inline
+		}
+		pad := maxLen(keys)
+		var buf strings.Builder
+		buf.WriteString("{\n")
+		for i := range keys {
+			fmt.Fprintf(&buf, "%s%-*s = %s\n", indentOf(indent+1), pad, keys[i], elems[i])
+		}
+		buf.WriteString(indentOf(indent) + "}")
+		return buf.String()
+	default:
+		return fmt.Sprintf("%#v", val)
+	}
+}
+
+// fitsInline tells whether the inline rendered collection fits into the width, which requires all its elements
+// being single line.
+func (r valueRenderer) fitsInline(inline string, elems []string, indent int) bool {
+	if r.width <= 0 {
+		return false
+	}
+	for _, elem := range elems {
+		if strings.Contains(elem, "\n") {
+			return false
+		}
+	}
+	// The indent and the attribute name are roughly counted as the same width of one more indent level.
+	return len(indentOf(indent+1))+len(inline) <= r.width
+}
+
+func heredoc(s string, indent int) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	var buf strings.Builder
+	buf.WriteString("<<-EOT\n")
+	for _, line := range lines {
+		if line != "" {
+			buf.WriteString(indentOf(indent + 1))
+		}
+		buf.WriteString(templateEscaper.Replace(line) + "\n")
+	}
+	buf.WriteString(indentOf(indent) + "EOT")
+	return buf.String()
+}
+
+// quoteString returns the HCL quoted string.
+func quoteString(s string) string {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	q := strings.TrimSuffix(buf.String(), "\n")
+	return templateEscaper.Replace(q)
+}
+
+func attrKey(name string) string {
+	if identifierRegexp.MatchString(name) {
+		return name
+	}
+	return quoteString(name)
+}
+
+func indentOf(level int) string {
+	return strings.Repeat(indentUnit, level)
+}
+
+func maxLen(l []string) int {
+	var n int
+	for _, s := range l {
+		if len(s) > n {
+			n = len(s)
+		}
+	}
+	return n
+}
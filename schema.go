@@ -0,0 +1,66 @@
+package tfstate
+
+import (
+	"fmt"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// lookupProviderSchema looks up the provider schema by the provider source address. As Terraform and OpenTofu
+// host the same providers in their own registries, the provider is also looked up in the other registry if not found,
+// so that the state can be decoded with the schemas retrieved by the other tool.
+func lookupProviderSchema(schemas *tfjson.ProviderSchemas, providerName string) (*tfjson.ProviderSchema, bool) {
+	if schema, ok := schemas.Schemas[providerName]; ok {
+		return schema, true
+	}
+	var alt string
+	switch {
+	case strings.HasPrefix(providerName, TerraformRegistryHost+"/"):
+		alt = OpenTofuRegistryHost + strings.TrimPrefix(providerName, TerraformRegistryHost)
+	case strings.HasPrefix(providerName, OpenTofuRegistryHost+"/"):
+		alt = TerraformRegistryHost + strings.TrimPrefix(providerName, OpenTofuRegistryHost)
+	default:
+		return nil, false
+	}
+	schema, ok := schemas.Schemas[alt]
+	return schema, ok
+}
+
+// LookupResourceSchema looks up the schema of a resource (or data source) by its provider source address, mode and
+// type from the provider schemas. The provider is looked up in the same way as decoding the state.
+func LookupResourceSchema(schemas *tfjson.ProviderSchemas, providerName string, mode tfjson.ResourceMode, typ string) (*tfjson.Schema, error) {
+	_, schema, err := lookupResourceSchema(schemas, providerName, mode, typ, "")
+	return schema, err
+}
+
+// lookupResourceSchema is LookupResourceSchema that also returns the provider schema. The address of the resource,
+// if not empty, is reported by the errors of unknown modes.
+func lookupResourceSchema(schemas *tfjson.ProviderSchemas, providerName string, mode tfjson.ResourceMode, typ, addr string) (*tfjson.ProviderSchema, *tfjson.Schema, error) {
+	if schemas == nil {
+		return nil, nil, fmt.Errorf("provider schemas is nil")
+	}
+	if schemas.Schemas == nil {
+		return nil, nil, fmt.Errorf("provider schemas' Schemas is nil")
+	}
+	providerSchema, ok := lookupProviderSchema(schemas, providerName)
+	if !ok {
+		return nil, nil, fmt.Errorf("No provider type %q found in the provider schemas", providerName)
+	}
+	var schema *tfjson.Schema
+	switch mode {
+	case tfjson.DataResourceMode:
+		schema, ok = providerSchema.DataSourceSchemas[typ]
+	case tfjson.ManagedResourceMode:
+		schema, ok = providerSchema.ResourceSchemas[typ]
+	default:
+		if addr != "" {
+			return nil, nil, fmt.Errorf("Unknown resource mode %q for resource %q", mode, addr)
+		}
+		return nil, nil, fmt.Errorf("Unknown resource mode %q", mode)
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("No resource type %q found in the provider schema", typ)
+	}
+	return providerSchema, schema, nil
+}
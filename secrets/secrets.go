@@ -0,0 +1,348 @@
+// Package secrets scans the state for the secrets held in the attributes that are not marked sensitive, e.g. a private
+// key or an access key in a free-form attribute, which the redaction of the sensitive values (e.g. by the render
+// package) doesn't cover.
+//
+// The values are matched against the detectors, which are regular expressions optionally restricted to the attribute
+// names and a minimum entropy. The default detectors (private keys, cloud access keys, tokens, JWTs and high-entropy
+// strings) are embedded in the package, so the scanning runs offline. A rule set can also be loaded from YAML (or
+// JSON), e.g.
+//
+//	rules:
+//	  - name: internal-token
+//	    description: Internal service token
+//	    pattern: '\bitk_[0-9a-f]{32}\b'
+//	  - name: password
+//	    pattern: '.{8,}'
+//	    attribute: '(?i)password'
+package secrets
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed rules.yaml
+var defaultRulesYAML []byte
+
+var defaultRules = func() *Rules {
+	rules, err := Parse(defaultRulesYAML)
+	if err != nil {
+		panic(fmt.Sprintf("parse the default rules: %v", err))
+	}
+	return rules
+}()
+
+// Rule is a detector of secrets.
+type Rule struct {
+	// Name is the name of the detector, which is reported by the findings.
+	Name string `json:"name" yaml:"name"`
+	// Description describes the secret that the detector finds.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Pattern is the regular expression matched against the string values.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Attribute is the regular expression that the name of the innermost attribute (or map key) of the value must
+	// match, which matches all names if empty.
+	Attribute string `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	// MinEntropy is the minimum Shannon entropy, in bits per character, of the matched string.
+	MinEntropy float64 `json:"min_entropy,omitempty" yaml:"min_entropy,omitempty"`
+}
+
+// Rules is a set of detectors.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	Rule
+	pattern   *regexp.Regexp
+	attribute *regexp.Regexp
+}
+
+// Default returns the default detectors embedded in the package.
+func Default() *Rules {
+	return defaultRules
+}
+
+// New compiles the rules.
+func New(rules []Rule) (*Rules, error) {
+	ret := &Rules{}
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d: empty name", i)
+		}
+		cr := rule{Rule: r}
+		var err error
+		if cr.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %v", r.Name, err)
+		}
+		if r.Attribute != "" {
+			if cr.attribute, err = regexp.Compile(r.Attribute); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid attribute: %v", r.Name, err)
+			}
+		}
+		ret.rules = append(ret.rules, cr)
+	}
+	return ret, nil
+}
+
+// Parse parses the rule set in YAML (or JSON), which has the rules under the "rules" key.
+func Parse(b []byte) (*Rules, error) {
+	var doc struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return New(doc.Rules)
+}
+
+// Load reads and parses the rule set file.
+func Load(path string) (*Rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse secret rules %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// Detect returns the names of the detectors that the string value matches, where the name is the one of the innermost
+// attribute (or map key) of the value.
+func (rs *Rules) Detect(name, s string) []string {
+	var ret []string
+	for _, r := range rs.rules {
+		if r.attribute != nil && !r.attribute.MatchString(name) {
+			continue
+		}
+		for _, m := range r.pattern.FindAllString(s, -1) {
+			if m != "" && entropy(m) >= r.MinEntropy {
+				ret = append(ret, r.Name)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// entropy returns the Shannon entropy of the string, in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	var ret float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		ret -= p * math.Log2(p)
+	}
+	return ret
+}
+
+// Finding is a secret found in the state.
+type Finding struct {
+	// Address is the address of the resource instance, or "output.<name>" for an output.
+	Address string
+	// DeposedKey is the deposed key of the resource instance, if it is a deposed object.
+	DeposedKey string
+	// Path is the path of the value in the resource value (or the output value). The elements of sets are indexed by
+	// their positions in the iteration order, rather than by themselves as tfstate.EvalPath does, so that the path
+	// never contains the values being reported. Such an index step is therefore not an element of the set for
+	// tfstate.ParsePath and tfstate.EvalPath.
+	Path cty.Path
+	// Detector is the name of the detector.
+	Detector string
+}
+
+func (f Finding) String() string {
+	addr := f.Address
+	if f.DeposedKey != "" {
+		addr += " (deposed " + f.DeposedKey + ")"
+	}
+	if len(f.Path) == 0 {
+		return fmt.Sprintf("%s: %s", addr, f.Detector)
+	}
+	return fmt.Sprintf("%s: %s: %s", addr, tfstate.FormatPath(f.Path), f.Detector)
+}
+
+// Options are the options of Scan.
+type Options struct {
+	// Schemas are the provider schemas, whose sensitive attributes are not scanned. Only the sensitive values
+	// recorded in the state are skipped if nil.
+	Schemas *tfjson.ProviderSchemas
+	// Rules are the detectors, which are the default ones if nil.
+	Rules *Rules
+}
+
+// Scan scans the values of the resource instances and outputs for the secrets, except the ones marked sensitive,
+// i.e. recorded in the SensitiveValues of the resources, the sensitive outputs, or the sensitive attributes of the
+// schemas.
+func Scan(state *tfstate.State, opts Options) ([]Finding, error) {
+	rules := opts.Rules
+	if rules == nil {
+		rules = Default()
+	}
+	if state == nil || state.Values == nil {
+		return nil, nil
+	}
+	var findings []Finding
+	var walkModule func(module *tfstate.StateModule) error
+	walkModule = func(module *tfstate.StateModule) error {
+		if module == nil {
+			return nil
+		}
+		for _, res := range module.Resources {
+			fs, err := ScanResource(res, rules, opts.Schemas)
+			if err != nil {
+				return err
+			}
+			findings = append(findings, fs...)
+		}
+		for _, module := range module.ChildModules {
+			if err := walkModule(module); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walkModule(state.Values.RootModule); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range state.Values.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output := state.Values.Outputs[name]
+		if output == nil || output.Sensitive {
+			continue
+		}
+		walkJSON(output.Value, nil, "", func(path cty.Path, attr, s string) {
+			for _, detector := range rules.Detect(attr, s) {
+				findings = append(findings, Finding{Address: "output." + name, Path: path, Detector: detector})
+			}
+		})
+	}
+	return findings, nil
+}
+
+// ScanResource scans the value of the resource instance for the secrets, except the ones marked sensitive. The
+// schemas are optional, and the rules are the default ones if nil.
+func ScanResource(res *tfstate.StateResource, rules *Rules, schemas *tfjson.ProviderSchemas) ([]Finding, error) {
+	if res == nil || res.Value == cty.NilVal {
+		return nil, nil
+	}
+	if rules == nil {
+		rules = Default()
+	}
+	var sens interface{}
+	if len(res.SensitiveValues) != 0 {
+		if err := json.Unmarshal(res.SensitiveValues, &sens); err != nil {
+			return nil, fmt.Errorf("resource %q: unmarshal sensitive values: %v", res.Address, err)
+		}
+	}
+	var block *tfjson.SchemaBlock
+	if schemas != nil {
+		if schema, err := tfstate.LookupResourceSchema(schemas, res.ProviderName, res.Mode, res.Type); err == nil {
+			block = schema.Block
+		}
+	}
+	var findings []Finding
+	walkValue(res.Value, nil, "", sens, func(path cty.Path, attr, s string) {
+		if tfstate.SchemaSensitive(block, path) {
+			return
+		}
+		for _, detector := range rules.Detect(attr, s) {
+			findings = append(findings, Finding{Address: res.Address, DeposedKey: res.DeposedKey, Path: path, Detector: detector})
+		}
+	})
+	return findings, nil
+}
+
+// walkValue calls the function with every known string in the value, except the ones marked sensitive in the
+// sensitive values, i.e. the JSON of the value shape whose leaves are true for the sensitive values. The attr is the
+// name of the innermost attribute (or map key).
+func walkValue(val cty.Value, path cty.Path, attr string, sens interface{}, fn func(path cty.Path, attr, s string)) {
+	if b, ok := sens.(bool); ok && b {
+		return
+	}
+	if val.IsNull() || !val.IsKnown() {
+		return
+	}
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		fn(path, attr, val.AsString())
+	case ty.IsObjectType(), ty.IsMapType():
+		m, _ := sens.(map[string]interface{})
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			name := k.AsString()
+			var step cty.PathStep = cty.IndexStep{Key: k}
+			if ty.IsObjectType() {
+				step = cty.GetAttrStep{Name: name}
+			}
+			walkValue(v, appendStep(path, step), name, m[name], fn)
+		}
+	case ty.IsListType(), ty.IsSetType(), ty.IsTupleType():
+		l, _ := sens.([]interface{})
+		i := 0
+		for it := val.ElementIterator(); it.Next(); i++ {
+			_, v := it.Element()
+			var esens interface{}
+			if i < len(l) {
+				esens = l[i]
+			}
+			// The set elements are indexed by the positions, which doesn't leak the elements.
+			walkValue(v, appendStep(path, cty.IndexStep{Key: cty.NumberIntVal(int64(i))}), attr, esens, fn)
+		}
+	}
+}
+
+// walkJSON is walkValue for the JSON values (e.g. of the outputs), where the object keys are attribute steps.
+func walkJSON(v interface{}, path cty.Path, attr string, fn func(path cty.Path, attr, s string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, attr, v)
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkJSON(v[k], appendStep(path, cty.GetAttrStep{Name: k}), k, fn)
+		}
+	case []interface{}:
+		for i, e := range v {
+			walkJSON(e, appendStep(path, cty.IndexStep{Key: cty.NumberIntVal(int64(i))}), attr, fn)
+		}
+	}
+}
+
+func appendStep(path cty.Path, step cty.PathStep) cty.Path {
+	ret := make(cty.Path, len(path), len(path)+1)
+	copy(ret, path)
+	return append(ret, step)
+}
@@ -0,0 +1,58 @@
+package tfstate
+
+import (
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SchemaSensitive tells whether the path of a value of the schema block is (or is nested in) a sensitive attribute.
+// The steps of the elements of the nested blocks and nested attributes (other than the single nesting mode) can be
+// of any kind, e.g. the positions or the values of the set elements. It returns false for a nil block.
+func SchemaSensitive(block *tfjson.SchemaBlock, path cty.Path) bool {
+	for block != nil && len(path) != 0 {
+		step, ok := path[0].(cty.GetAttrStep)
+		if !ok {
+			return false
+		}
+		path = path[1:]
+		if attr, ok := block.Attributes[step.Name]; ok {
+			return attributeSensitive(attr, path)
+		}
+		blockType, ok := block.NestedBlocks[step.Name]
+		if !ok {
+			return false
+		}
+		if blockType.NestingMode != tfjson.SchemaNestingModeSingle && blockType.NestingMode != tfjson.SchemaNestingModeGroup {
+			if len(path) == 0 {
+				return false
+			}
+			path = path[1:]
+		}
+		block = blockType.Block
+	}
+	return false
+}
+
+func attributeSensitive(attr *tfjson.SchemaAttribute, path cty.Path) bool {
+	if attr == nil {
+		return false
+	}
+	if attr.Sensitive {
+		return true
+	}
+	nested := attr.AttributeNestedType
+	if nested == nil || len(path) == 0 {
+		return false
+	}
+	if nested.NestingMode != tfjson.SchemaNestingModeSingle {
+		path = path[1:]
+		if len(path) == 0 {
+			return false
+		}
+	}
+	step, ok := path[0].(cty.GetAttrStep)
+	if !ok {
+		return false
+	}
+	return attributeSensitive(nested.Attributes[step.Name], path[1:])
+}
@@ -0,0 +1,506 @@
+// Package sqlite loads the state into a SQLite database, for the ad-hoc SQL queries over (many) states.
+//
+// The database has the following tables, where the rows of multiple states can be loaded, distinguished by the
+// workspace name:
+//
+//   - modules: The module instances, with their parent module instances.
+//   - resources: The resource instance objects, with their whole values as JSON.
+//   - outputs: The outputs, with their values as JSON.
+//
+// Besides, there is a table per resource type, named by the type (prefixed by "data_" for the data sources), whose
+// columns are the attributes of the resource type (derived from the schema's implied type), keyed by the
+// "_resource_id" referring to the "id" of the resources table. The primitive attributes are stored as the
+// corresponding SQL types (the bools as 0 or 1), while the others as JSON, which can be queried by the JSON functions
+// of SQLite. The nested blocks are stored in the child tables, named by the parent table and the block type name
+// joined by "__" (e.g. "aws_instance__ebs_block_device"), whose rows have an "_id", the "_parent_id" referring to the
+// "_id" of the parent nested block (or the "_resource_id" for the top level ones), and the "_key" being the index
+// (or the key) of the block in the parent.
+//
+// The columns are added as needed when loading a resource type with more attributes (e.g. of a newer provider),
+// so that the states of different provider versions can be loaded into the same database.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	// The pure-Go SQLite driver, registered as "sqlite".
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the name of the SQLite driver used by ExportFile.
+const DriverName = "sqlite"
+
+// The columns of the per resource type tables (and their child tables) that are not attributes.
+const (
+	columnResourceID = "_resource_id"
+	columnID         = "_id"
+	columnParentID   = "_parent_id"
+	columnKey        = "_key"
+)
+
+const baseSchema = `
+CREATE TABLE IF NOT EXISTS modules (
+	workspace TEXT NOT NULL,
+	address TEXT NOT NULL,
+	parent TEXT,
+	PRIMARY KEY (workspace, address)
+);
+CREATE TABLE IF NOT EXISTS resources (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	workspace TEXT NOT NULL,
+	address TEXT NOT NULL,
+	module TEXT NOT NULL,
+	mode TEXT NOT NULL,
+	type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	index_key TEXT,
+	provider TEXT NOT NULL,
+	schema_version INTEGER NOT NULL,
+	tainted BOOLEAN NOT NULL,
+	deposed_key TEXT,
+	depends_on TEXT,
+	sensitive_values TEXT,
+	"values" TEXT
+);
+CREATE INDEX IF NOT EXISTS resources_workspace ON resources (workspace);
+CREATE INDEX IF NOT EXISTS resources_type ON resources (type);
+CREATE TABLE IF NOT EXISTS outputs (
+	workspace TEXT NOT NULL,
+	name TEXT NOT NULL,
+	sensitive BOOLEAN NOT NULL,
+	value TEXT,
+	PRIMARY KEY (workspace, name)
+);
+CREATE TABLE IF NOT EXISTS resource_tables (
+	name TEXT PRIMARY KEY
+);
+`
+
+type Options struct {
+	// Schemas are the provider schemas, which are required to derive the per resource type tables.
+	Schemas *tfjson.ProviderSchemas
+
+	// Workspace is the name of the state being loaded, which is recorded in the base tables. The existing rows of the
+	// same workspace are replaced.
+	Workspace string
+}
+
+// ExportFile loads the state into the SQLite database file, which is created if not exists.
+func ExportFile(ctx context.Context, path string, state *tfstate.State, opts Options) error {
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		return fmt.Errorf("open database %s: %v", path, err)
+	}
+	if err := Export(ctx, db, state, opts); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// Export loads the state into the SQLite database, in a single transaction.
+func Export(ctx context.Context, db *sql.DB, state *tfstate.State, opts Options) error {
+	if opts.Schemas == nil {
+		return fmt.Errorf("no provider schemas")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	e := &exporter{
+		tx:        tx,
+		opts:      opts,
+		tables:    map[string]map[string]bool{},
+		statement: map[string]*sql.Stmt{},
+	}
+	if err := e.export(ctx, state); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type exporter struct {
+	tx   *sql.Tx
+	opts Options
+	// tables are the existing columns of the per resource type tables (and their child tables) that are ensured.
+	tables map[string]map[string]bool
+	// statement are the prepared insert statements, keyed by the query.
+	statement map[string]*sql.Stmt
+}
+
+func (e *exporter) export(ctx context.Context, state *tfstate.State) error {
+	if _, err := e.tx.ExecContext(ctx, baseSchema); err != nil {
+		return fmt.Errorf("create tables: %v", err)
+	}
+	if err := e.clean(ctx); err != nil {
+		return err
+	}
+	if state == nil || state.Values == nil {
+		return nil
+	}
+
+	var walk func(module *tfstate.StateModule, parent *string) error
+	walk = func(module *tfstate.StateModule, parent *string) error {
+		if module == nil {
+			return nil
+		}
+		address := module.Address
+		if parent == nil {
+			// The address of the root module is empty in the state file, but "root" (or empty) in the JSON state.
+			address = ""
+		}
+		if _, err := e.tx.ExecContext(ctx, `INSERT INTO modules (workspace, address, parent) VALUES (?, ?, ?)`, e.opts.Workspace, address, parent); err != nil {
+			return fmt.Errorf("insert module %q: %v", address, err)
+		}
+		for _, res := range module.Resources {
+			if err := e.resource(ctx, res); err != nil {
+				return fmt.Errorf("resource %q: %v", res.Address, err)
+			}
+		}
+		for _, child := range module.ChildModules {
+			if err := walk(child, &address); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(state.Values.RootModule, nil); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range state.Values.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output := state.Values.Outputs[name]
+		if output == nil {
+			continue
+		}
+		b, err := json.Marshal(output.Value)
+		if err != nil {
+			return fmt.Errorf("output %q: marshal value: %v", name, err)
+		}
+		if _, err := e.tx.ExecContext(ctx, `INSERT INTO outputs (workspace, name, sensitive, value) VALUES (?, ?, ?, ?)`, e.opts.Workspace, name, output.Sensitive, string(b)); err != nil {
+			return fmt.Errorf("insert output %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// clean deletes the existing rows of the workspace.
+func (e *exporter) clean(ctx context.Context) error {
+	rows, err := e.tx.QueryContext(ctx, `SELECT name FROM resource_tables`)
+	if err != nil {
+		return fmt.Errorf("list resource tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE %s IN (SELECT id FROM resources WHERE workspace = ?)`, quote(table), quote(columnResourceID))
+		if _, err := e.tx.ExecContext(ctx, query, e.opts.Workspace); err != nil {
+			return fmt.Errorf("clean table %s: %v", table, err)
+		}
+	}
+	for _, table := range []string{"resources", "modules", "outputs"} {
+		if _, err := e.tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE workspace = ?`, table), e.opts.Workspace); err != nil {
+			return fmt.Errorf("clean table %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+func (e *exporter) resource(ctx context.Context, res *tfstate.StateResource) error {
+	addr, err := tfstate.ParseAddress(res.Address)
+	if err != nil {
+		return err
+	}
+	var index interface{}
+	if addr.Key != nil {
+		index = fmt.Sprint(addr.Key)
+	}
+	var dependsOn interface{}
+	if len(res.DependsOn) != 0 {
+		b, err := json.Marshal(res.DependsOn)
+		if err != nil {
+			return err
+		}
+		dependsOn = string(b)
+	}
+	var sensitiveValues interface{}
+	if len(res.SensitiveValues) != 0 {
+		sensitiveValues = string(res.SensitiveValues)
+	}
+	var deposedKey interface{}
+	if res.DeposedKey != "" {
+		deposedKey = res.DeposedKey
+	}
+	values, err := sqlValue(res.Value, true)
+	if err != nil {
+		return err
+	}
+	result, err := e.tx.ExecContext(ctx, `INSERT INTO resources (workspace, address, module, mode, type, name, index_key, provider, schema_version, tainted, deposed_key, depends_on, sensitive_values, "values") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.opts.Workspace, res.Address, addr.ModuleAddress(), string(res.Mode), res.Type, res.Name, index, res.ProviderName, int64(res.SchemaVersion), res.Tainted, deposedKey, dependsOn, sensitiveValues, values)
+	if err != nil {
+		return fmt.Errorf("insert: %v", err)
+	}
+	resourceID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	schema, err := tfstate.LookupResourceSchema(e.opts.Schemas, res.ProviderName, res.Mode, res.Type)
+	if err != nil {
+		return err
+	}
+	table := res.Type
+	if res.Mode == tfjson.DataResourceMode {
+		table = "data_" + table
+	}
+	if res.Value == cty.NilVal || res.Value.IsNull() || !res.Value.IsKnown() {
+		return nil
+	}
+	return e.block(ctx, table, jsonschema.SchemaBlockWithoutWriteOnly(schema.Block), res.Value, resourceID, nil, nil)
+}
+
+// block inserts the value of a (nested) block into the table, and its nested blocks into the child tables.
+// The parentID and key are nil for the top level block.
+func (e *exporter) block(ctx context.Context, table string, b *tfjson.SchemaBlock, val cty.Value, resourceID int64, parentID *int64, key interface{}) error {
+	topLevel := parentID == nil
+	if err := e.ensureTable(ctx, table, b, topLevel); err != nil {
+		return err
+	}
+
+	attrs := sortedKeys(b.Attributes)
+	columns := []string{quote(columnResourceID)}
+	args := []interface{}{resourceID}
+	if !topLevel {
+		columns = append(columns, quote(columnParentID), quote(columnKey))
+		args = append(args, *parentID, key)
+	}
+	for _, name := range attrs {
+		if !val.Type().HasAttribute(name) {
+			continue
+		}
+		v, err := sqlValue(val.GetAttr(name), false)
+		if err != nil {
+			return fmt.Errorf("attribute %q: %v", name, err)
+		}
+		columns = append(columns, quote(name))
+		args = append(args, v)
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, quote(table), strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	stmt, err := e.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("insert into %s: %v", table, err)
+	}
+	id := resourceID
+	if !topLevel {
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range sortedKeys(b.NestedBlocks) {
+		nb := b.NestedBlocks[name]
+		if nb.Block == nil || !val.Type().HasAttribute(name) {
+			continue
+		}
+		child := table + "__" + name
+		v := val.GetAttr(name)
+		if v.IsNull() || !v.IsKnown() {
+			continue
+		}
+		switch nb.NestingMode {
+		case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+			i := 0
+			for it := v.ElementIterator(); it.Next(); i++ {
+				_, ev := it.Element()
+				if ev.IsNull() || !ev.IsKnown() {
+					continue
+				}
+				if err := e.block(ctx, child, nb.Block, ev, resourceID, &id, fmt.Sprint(i)); err != nil {
+					return err
+				}
+			}
+		case tfjson.SchemaNestingModeMap:
+			for it := v.ElementIterator(); it.Next(); {
+				k, ev := it.Element()
+				if ev.IsNull() || !ev.IsKnown() {
+					continue
+				}
+				if err := e.block(ctx, child, nb.Block, ev, resourceID, &id, k.AsString()); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := e.block(ctx, child, nb.Block, v, resourceID, &id, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ensureTable creates the table of the block if not exists, or adds the missing columns to it.
+func (e *exporter) ensureTable(ctx context.Context, table string, b *tfjson.SchemaBlock, topLevel bool) error {
+	existing, ok := e.tables[table]
+	if !ok {
+		var err error
+		if existing, err = e.columns(ctx, table); err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			var defs []string
+			if topLevel {
+				defs = append(defs, fmt.Sprintf("%s INTEGER PRIMARY KEY REFERENCES resources (id)", quote(columnResourceID)))
+			} else {
+				defs = append(defs,
+					fmt.Sprintf("%s INTEGER PRIMARY KEY AUTOINCREMENT", quote(columnID)),
+					fmt.Sprintf("%s INTEGER NOT NULL REFERENCES resources (id)", quote(columnResourceID)),
+					fmt.Sprintf("%s INTEGER NOT NULL", quote(columnParentID)),
+					fmt.Sprintf("%s TEXT", quote(columnKey)),
+				)
+			}
+			query := fmt.Sprintf(`CREATE TABLE %s (%s)`, quote(table), strings.Join(defs, ", "))
+			if _, err := e.tx.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("create table %s: %v", table, err)
+			}
+			if _, err := e.tx.ExecContext(ctx, `INSERT INTO resource_tables (name) VALUES (?)`, table); err != nil {
+				return fmt.Errorf("register table %s: %v", table, err)
+			}
+			existing = map[string]bool{}
+		}
+		e.tables[table] = existing
+	}
+
+	for _, name := range sortedKeys(b.Attributes) {
+		if existing[name] {
+			continue
+		}
+		query := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, quote(table), quote(name), sqlType(jsonschema.SchemaAttributeImpliedType(b.Attributes[name])))
+		if _, err := e.tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("add column %q to table %s: %v", name, table, err)
+		}
+		existing[name] = true
+	}
+	return nil
+}
+
+// columns returns the columns of the table, which is empty if the table doesn't exist.
+func (e *exporter) columns(ctx context.Context, table string) (map[string]bool, error) {
+	rows, err := e.tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("get columns of table %s: %v", table, err)
+	}
+	defer rows.Close()
+	ret := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		ret[name] = true
+	}
+	return ret, rows.Err()
+}
+
+func (e *exporter) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := e.statement[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := e.tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("prepare %q: %v", query, err)
+	}
+	e.statement[query] = stmt
+	return stmt, nil
+}
+
+// sqlType returns the SQL type of the column of the cty type.
+func sqlType(ty cty.Type) string {
+	switch ty {
+	case cty.String:
+		return "TEXT"
+	case cty.Number:
+		return "NUMERIC"
+	case cty.Bool:
+		return "BOOLEAN"
+	default:
+		// JSON
+		return "TEXT"
+	}
+}
+
+// sqlValue returns the SQL value of the cty value, which is encoded as JSON if it is not primitive, or forced to.
+// The null and unknown values are NULL.
+func sqlValue(val cty.Value, forceJSON bool) (interface{}, error) {
+	if val == cty.NilVal || val.IsNull() || !val.IsWhollyKnown() {
+		return nil, nil
+	}
+	if !forceJSON {
+		switch val.Type() {
+		case cty.String:
+			return val.AsString(), nil
+		case cty.Number:
+			bf := val.AsBigFloat()
+			if i, acc := bf.Int64(); acc == 0 {
+				return i, nil
+			}
+			f, _ := bf.Float64()
+			return f, nil
+		case cty.Bool:
+			if val.True() {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	}
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// quote quotes the SQL identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,165 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/sqlite"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadState(t *testing.T) (*tfstate.State, *tfjson.ProviderSchemas) {
+	b, err := os.ReadFile("../testdata/opentofu/schemas.json")
+	require.NoError(t, err)
+	var schemas tfjson.ProviderSchemas
+	require.NoError(t, json.Unmarshal(b, &schemas))
+	b, err = os.ReadFile("../testdata/opentofu/state.json")
+	require.NoError(t, err)
+	var rawState tfjson.State
+	require.NoError(t, json.Unmarshal(b, &rawState))
+	state, err := tfstate.FromJSONState(&rawState, &schemas)
+	require.NoError(t, err)
+	return state, &schemas
+}
+
+func queryStrings(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	rows, err := db.Query(query, args...)
+	require.NoError(t, err)
+	defer rows.Close()
+	var ret []string
+	for rows.Next() {
+		var s sql.NullString
+		require.NoError(t, rows.Scan(&s))
+		ret = append(ret, s.String)
+	}
+	require.NoError(t, rows.Err())
+	return ret
+}
+
+func TestExportFile(t *testing.T) {
+	state, schemas := loadState(t)
+	path := filepath.Join(t.TempDir(), "state.db")
+	ctx := context.Background()
+
+	require.NoError(t, sqlite.ExportFile(ctx, path, state, sqlite.Options{Schemas: schemas, Workspace: "dev"}))
+	require.NoError(t, sqlite.ExportFile(ctx, path, state, sqlite.Options{Schemas: schemas, Workspace: "prod"}))
+	// Loading the same workspace again replaces its rows.
+	require.NoError(t, sqlite.ExportFile(ctx, path, state, sqlite.Options{Schemas: schemas, Workspace: "prod"}))
+
+	db, err := sql.Open(sqlite.DriverName, path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.Equal(t, []string{"", `module.app["web"]`, `module.app["web"].module.db`},
+		queryStrings(t, db, `SELECT address FROM modules WHERE workspace = 'dev' ORDER BY address`))
+	require.Equal(t, []string{`module.app["web"]`},
+		queryStrings(t, db, `SELECT parent FROM modules WHERE workspace = 'dev' AND address = 'module.app["web"].module.db'`))
+
+	require.Equal(t, []string{
+		"data.null_data_source.values",
+		`module.app["web"].module.db.null_resource.db`,
+		`module.app["web"].null_resource.this[0]`,
+		`module.app["web"].null_resource.this[1]`,
+		"random_password.this",
+		"random_pet.this",
+	}, queryStrings(t, db, `SELECT address FROM resources WHERE workspace = 'prod' ORDER BY address`))
+	require.Equal(t, []string{"0", "1"},
+		queryStrings(t, db, `SELECT index_key FROM resources WHERE workspace = 'prod' AND type = 'null_resource' AND index_key IS NOT NULL ORDER BY index_key`))
+
+	var (
+		length  int64
+		special bool
+	)
+	require.NoError(t, db.QueryRow(`SELECT p.length, p.special FROM random_password p JOIN resources r ON r.id = p._resource_id WHERE r.workspace = 'dev'`).Scan(&length, &special))
+	require.Equal(t, int64(12), length)
+	require.True(t, special)
+
+	require.Equal(t, []string{"2", "2"},
+		queryStrings(t, db, `SELECT count(*) FROM null_resource n JOIN resources r ON r.id = n._resource_id WHERE r.module = 'module.app["web"]' GROUP BY r.workspace`))
+	require.Equal(t, []string{"dev", "prod"},
+		queryStrings(t, db, `SELECT r.workspace FROM data_null_data_source d JOIN resources r ON r.id = d._resource_id ORDER BY r.workspace`))
+
+	require.Equal(t, []string{`"sunny-toucan"`},
+		queryStrings(t, db, `SELECT value FROM outputs WHERE workspace = 'dev' AND name = 'pet'`))
+}
+
+func TestExportNestedBlocks(t *testing.T) {
+	schemas := &tfjson.ProviderSchemas{
+		FormatVersion: "1.0",
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/hashicorp/demo": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"demo_server": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"id": {AttributeType: cty.String, Computed: true},
+							},
+							NestedBlocks: map[string]*tfjson.SchemaBlockType{
+								"disk": {
+									NestingMode: tfjson.SchemaNestingModeList,
+									Block: &tfjson.SchemaBlock{
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"size": {AttributeType: cty.Number, Optional: true},
+										},
+										NestedBlocks: map[string]*tfjson.SchemaBlockType{
+											"label": {
+												NestingMode: tfjson.SchemaNestingModeMap,
+												Block: &tfjson.SchemaBlock{
+													Attributes: map[string]*tfjson.SchemaAttribute{
+														"value": {AttributeType: cty.String, Optional: true},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	rawState := &tfjson.State{
+		FormatVersion: "1.0",
+		Values: &tfjson.StateValues{
+			RootModule: &tfjson.StateModule{
+				Resources: []*tfjson.StateResource{
+					{
+						Address:      "demo_server.this",
+						Mode:         tfjson.ManagedResourceMode,
+						Type:         "demo_server",
+						Name:         "this",
+						ProviderName: "registry.terraform.io/hashicorp/demo",
+						AttributeValues: map[string]interface{}{
+							"id": "srv",
+							"disk": []interface{}{
+								map[string]interface{}{"size": 10.0, "label": map[string]interface{}{"a": map[string]interface{}{"value": "x"}}},
+								map[string]interface{}{"size": 20.0, "label": map[string]interface{}{}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	state, err := tfstate.FromJSONState(rawState, schemas)
+	require.NoError(t, err)
+
+	db, err := sql.Open(sqlite.DriverName, filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, sqlite.Export(context.Background(), db, state, sqlite.Options{Schemas: schemas}))
+
+	require.Equal(t, []string{"0:10", "1:20"},
+		queryStrings(t, db, `SELECT d._key || ':' || d.size FROM demo_server s JOIN demo_server__disk d ON d._parent_id = s._resource_id WHERE s.id = 'srv' ORDER BY d._key`))
+	require.Equal(t, []string{"10:a:x"},
+		queryStrings(t, db, `SELECT d.size || ':' || l._key || ':' || l.value FROM demo_server__disk d JOIN demo_server__disk__label l ON l._parent_id = d._id`))
+}
@@ -1,6 +1,7 @@
 package tfstate
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -11,6 +12,8 @@ import (
 )
 
 type State struct {
+	// TerraformVersion is the version of Terraform (or OpenTofu) that wrote the state, i.e. the terraform_version of
+	// the JSON state, not its format_version.
 	TerraformVersion string
 	Values           *StateValues
 }
@@ -44,67 +47,20 @@ type StateResource struct {
 	DependsOn       []string
 	Tainted         bool
 	DeposedKey      string
+
+	// IdentitySchemaVersion is the version of the resource identity schema that the Identity conforms to.
+	IdentitySchemaVersion *uint64
+	// Identity is the resource identity, decoded against the resource identity schema.
+	// It is cty.NilVal if the provider defines no identity schema for the resource type.
+	Identity cty.Value
 }
 
 func FromJSONState(rawState *tfjson.State, schemas *tfjson.ProviderSchemas) (*State, error) {
-	if rawState == nil {
-		return nil, nil
-	}
-	state := &State{
-		TerraformVersion: rawState.FormatVersion,
-	}
-	if rawState.Values == nil {
-		return state, nil
-	}
-	state.Values = &StateValues{}
-	if rawState.Values.RootModule != nil {
-		rootModule, err := FromJSONStateModule(rawState.Values.RootModule, schemas)
-		if err != nil {
-			return nil, err
-		}
-		state.Values = &StateValues{
-			RootModule: rootModule,
-		}
-	}
-	if rawState.Values.Outputs != nil {
-		m := make(map[string]*StateOutput, len(rawState.Values.Outputs))
-		for name, output := range rawState.Values.Outputs {
-			m[name] = FromJSONStateOutput(output)
-		}
-		state.Values.Outputs = m
-	}
-	return state, nil
+	return FromJSONStateContext(context.Background(), rawState, schemas, ConvertOptions{})
 }
 
 func FromJSONStateModule(module *tfjson.StateModule, schemas *tfjson.ProviderSchemas) (*StateModule, error) {
-	if module == nil {
-		return nil, nil
-	}
-	ret := &StateModule{
-		Address: module.Address,
-	}
-	var err error
-	if size := len(module.Resources); size > 0 {
-		resources := make([]*StateResource, size)
-		for i, resource := range module.Resources {
-			resources[i], err = FromJSONStateResource(resource, schemas)
-			if err != nil {
-				return nil, fmt.Errorf("converting json state for resource: %v", err)
-			}
-		}
-		ret.Resources = resources
-	}
-	if size := len(module.ChildModules); size > 0 {
-		modules := make([]*StateModule, size)
-		for i, module := range module.ChildModules {
-			modules[i], err = FromJSONStateModule(module, schemas)
-			if err != nil {
-				return nil, fmt.Errorf("converting json state for module: %v", err)
-			}
-		}
-		ret.ChildModules = modules
-	}
-	return ret, nil
+	return fromJSONStateModuleContext(context.Background(), module, schemas, ConvertOptions{})
 }
 
 func FromJSONStateOutput(output *tfjson.StateOutput) *StateOutput {
@@ -121,29 +77,9 @@ func FromJSONStateResource(resource *tfjson.StateResource, schemas *tfjson.Provi
 	if resource == nil {
 		return nil, nil
 	}
-	if schemas == nil {
-		return nil, fmt.Errorf("provider schemas is nil")
-	}
-	if schemas.Schemas == nil {
-		return nil, fmt.Errorf("provider schemas' Schemas is nil")
-	}
-	providerSchema, ok := schemas.Schemas[resource.ProviderName]
-	if !ok {
-		return nil, fmt.Errorf("No provider type %q found in the provider schemas", resource.ProviderName)
-	}
-	var (
-		schema *tfjson.Schema
-	)
-	switch resource.Mode {
-	case tfjson.DataResourceMode:
-		schema, ok = providerSchema.DataSourceSchemas[resource.Type]
-	case tfjson.ManagedResourceMode:
-		schema, ok = providerSchema.ResourceSchemas[resource.Type]
-	default:
-		return nil, fmt.Errorf("Unknown resource mode %q for resource %q", resource.Mode, resource.Address)
-	}
-	if !ok {
-		return nil, fmt.Errorf("No resource type %q found in the provider schema", resource.Type)
+	providerSchema, schema, err := lookupResourceSchema(schemas, resource.ProviderName, resource.Mode, resource.Type, resource.Address)
+	if err != nil {
+		return nil, err
 	}
 	ret := &StateResource{
 		Address:         resource.Address,
@@ -157,11 +93,92 @@ func FromJSONStateResource(resource *tfjson.StateResource, schemas *tfjson.Provi
 		DependsOn:       resource.DependsOn,
 		Tainted:         resource.Tainted,
 		DeposedKey:      resource.DeposedKey,
+
+		IdentitySchemaVersion: resource.IdentitySchemaVersion,
 	}
-	val, err := UnmarshalToCty(resource.AttributeValues, jsonschema.SchemaBlockImpliedType(schema.Block))
+	val, err := UnmarshalToCty(withoutWriteOnlyValues(resource.AttributeValues, schema.Block), jsonschema.SchemaBlockStateImpliedType(schema.Block))
 	if err != nil {
 		return nil, fmt.Errorf("cty json unmarshal attributes: %v", err)
 	}
 	ret.Value = val
+
+	identitySchema, ok := providerSchema.ResourceIdentitySchemas[resource.Type]
+	switch {
+	case ok && resource.Mode == tfjson.ManagedResourceMode:
+		ity := jsonschema.IdentitySchemaImpliedType(identitySchema)
+		if resource.IdentityValues == nil {
+			ret.Identity = cty.NullVal(ity)
+			break
+		}
+		val, err := UnmarshalToCty(resource.IdentityValues, ity)
+		if err != nil {
+			return nil, fmt.Errorf("cty json unmarshal identity: %v", err)
+		}
+		ret.Identity = val
+	case resource.IdentityValues != nil:
+		return nil, fmt.Errorf("No resource identity type %q found in the provider schema", resource.Type)
+	}
 	return ret, nil
 }
+
+// withoutWriteOnlyValues returns the attribute values with the write-only attributes removed, as they are
+// not part of the state implied type. The values are copied only when there is something to remove.
+func withoutWriteOnlyValues(values map[string]interface{}, b *tfjson.SchemaBlock) map[string]interface{} {
+	if values == nil || b == nil || jsonschema.SchemaBlockWithoutWriteOnly(b) == b {
+		return values
+	}
+	ret := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if attrS, ok := b.Attributes[k]; ok {
+			if attrS.WriteOnly {
+				continue
+			}
+			if attrS.AttributeNestedType != nil {
+				v = nestedWithoutWriteOnlyValues(v, attrS.AttributeNestedType.NestingMode, func(v map[string]interface{}) map[string]interface{} {
+					return withoutWriteOnlyValues(v, &tfjson.SchemaBlock{Attributes: attrS.AttributeNestedType.Attributes})
+				})
+			}
+		}
+		if blockS, ok := b.NestedBlocks[k]; ok {
+			v = nestedWithoutWriteOnlyValues(v, blockS.NestingMode, func(v map[string]interface{}) map[string]interface{} {
+				return withoutWriteOnlyValues(v, blockS.Block)
+			})
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+func nestedWithoutWriteOnlyValues(v interface{}, mode tfjson.SchemaNestingMode, f func(map[string]interface{}) map[string]interface{}) interface{} {
+	switch mode {
+	case tfjson.SchemaNestingModeSingle, tfjson.SchemaNestingModeGroup:
+		if m, ok := v.(map[string]interface{}); ok {
+			return f(m)
+		}
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+		if l, ok := v.([]interface{}); ok {
+			ret := make([]interface{}, len(l))
+			for i, e := range l {
+				if m, ok := e.(map[string]interface{}); ok {
+					ret[i] = f(m)
+				} else {
+					ret[i] = e
+				}
+			}
+			return ret
+		}
+	case tfjson.SchemaNestingModeMap:
+		if mm, ok := v.(map[string]interface{}); ok {
+			ret := make(map[string]interface{}, len(mm))
+			for k, e := range mm {
+				if m, ok := e.(map[string]interface{}); ok {
+					ret[k] = f(m)
+				} else {
+					ret[k] = e
+				}
+			}
+			return ret
+		}
+	}
+	return v
+}
@@ -539,3 +539,132 @@ func TestFromJSONState(t *testing.T) {
 		})
 	}
 }
+
+func TestFromJSONStateResourceIdentityAndWriteOnly(t *testing.T) {
+	identitySchemaVersion := uint64(1)
+	state := &tfjson.StateResource{
+		Address:      "demo_resource_foo.test",
+		Mode:         tfjson.ManagedResourceMode,
+		Type:         "demo_resource_foo",
+		Name:         "test",
+		ProviderName: "registry.terraform.io/magodo/demo",
+		AttributeValues: map[string]interface{}{
+			"name":     "foo",
+			"password": nil,
+			"block": []interface{}{
+				map[string]interface{}{
+					"field":  "a",
+					"secret": nil,
+				},
+			},
+		},
+		IdentitySchemaVersion: &identitySchemaVersion,
+		IdentityValues: map[string]interface{}{
+			"id": "/foos/foo",
+		},
+	}
+	schemas := &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/magodo/demo": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"demo_resource_foo": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"name": {
+									AttributeType: cty.String,
+									Required:      true,
+								},
+								"password": {
+									AttributeType: cty.String,
+									Optional:      true,
+									WriteOnly:     true,
+								},
+							},
+							NestedBlocks: map[string]*tfjson.SchemaBlockType{
+								"block": {
+									NestingMode: tfjson.SchemaNestingModeList,
+									Block: &tfjson.SchemaBlock{
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"field": {
+												AttributeType: cty.String,
+												Optional:      true,
+											},
+											"secret": {
+												AttributeType: cty.String,
+												Optional:      true,
+												WriteOnly:     true,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				ResourceIdentitySchemas: map[string]*tfjson.IdentitySchema{
+					"demo_resource_foo": {
+						Version: 1,
+						Attributes: map[string]*tfjson.IdentityAttribute{
+							"id": {
+								IdentityType:      cty.String,
+								RequiredForImport: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	actual, err := tfstate.FromJSONStateResource(state, schemas)
+	require.NoError(t, err)
+	require.Equal(t, &identitySchemaVersion, actual.IdentitySchemaVersion)
+	require.True(t, cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("foo"),
+		"block": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{
+				"field": cty.StringVal("a"),
+			}),
+		}),
+	}).RawEquals(actual.Value), actual.Value.GoString())
+	require.True(t, cty.ObjectVal(map[string]cty.Value{
+		"id": cty.StringVal("/foos/foo"),
+	}).RawEquals(actual.Identity), actual.Identity.GoString())
+
+	// The write-only attributes are kept in the input.
+	require.Contains(t, state.AttributeValues, "password")
+
+	// Identity is a null value when the provider defines an identity schema but it is not recorded in the state.
+	state.IdentitySchemaVersion = nil
+	state.IdentityValues = nil
+	actual, err = tfstate.FromJSONStateResource(state, schemas)
+	require.NoError(t, err)
+	require.True(t, cty.NullVal(cty.Object(map[string]cty.Type{"id": cty.String})).RawEquals(actual.Identity))
+
+	// Identity recorded in the state must have an identity schema.
+	state.IdentityValues = map[string]interface{}{"id": "/foos/foo"}
+	delete(schemas.Schemas["registry.terraform.io/magodo/demo"].ResourceIdentitySchemas, "demo_resource_foo")
+	_, err = tfstate.FromJSONStateResource(state, schemas)
+	require.Error(t, err)
+}
+
+func TestFromJSONStateResourceUnknownMode(t *testing.T) {
+	schemas := &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/magodo/demo": {},
+		},
+	}
+	_, err := tfstate.FromJSONStateResource(&tfjson.StateResource{
+		Address:      "demo_resource_foo.test",
+		Mode:         "bogus",
+		Type:         "demo_resource_foo",
+		ProviderName: "registry.terraform.io/magodo/demo",
+	}, schemas)
+	require.EqualError(t, err, `Unknown resource mode "bogus" for resource "demo_resource_foo.test"`)
+}
+
+func TestFromJSONStateTerraformVersion(t *testing.T) {
+	state, err := tfstate.FromJSONState(&tfjson.State{FormatVersion: "1.0", TerraformVersion: "1.8.0"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1.8.0", state.TerraformVersion)
+}
@@ -0,0 +1,599 @@
+package tfstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// JSONStateDecoder decodes the state in the JSON format (i.e. the output of `terraform show -json`) in a streaming
+// way. Different from FromJSONState, it reads the JSON token by token and builds the value of each resource straight
+// from the tokens, without holding the whole state in memory.
+type JSONStateDecoder struct {
+	dec           *json.Decoder
+	schemas       *tfjson.ProviderSchemas
+	useJSONNumber bool
+	progress      ProgressFunc
+}
+
+// NewJSONStateDecoder returns a JSONStateDecoder that reads the state from r, and decodes the resources with
+// the provider schemas.
+func NewJSONStateDecoder(r io.Reader, schemas *tfjson.ProviderSchemas) *JSONStateDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &JSONStateDecoder{
+		dec:     dec,
+		schemas: schemas,
+	}
+}
+
+// UseJSONNumber controls whether the numbers are decoded with their full precision, the same as
+// tfjson.State.UseJSONNumber. Otherwise, the numbers are decoded as float64, the same as FromJSONState.
+func (d *JSONStateDecoder) UseJSONNumber(b bool) {
+	d.useJSONNumber = b
+}
+
+// Progress sets the callback that is called after each resource is decoded. As the state is not read beforehand,
+// the total is always -1.
+func (d *JSONStateDecoder) Progress(fn ProgressFunc) {
+	d.progress = fn
+}
+
+// Decode decodes the state and calls fn for each resource instance object, in the order they appear in the state.
+// The decoding stops at the first error returned by fn.
+//
+// The returned State contains everything except the resources, i.e. the Terraform version and the outputs.
+func (d *JSONStateDecoder) Decode(fn func(res *StateResource) error) (*State, error) {
+	return d.DecodeContext(context.Background(), fn)
+}
+
+// DecodeContext is the same as Decode, except that the decoding stops when the context is cancelled, in which case
+// the context error is returned.
+func (d *JSONStateDecoder) DecodeContext(ctx context.Context, fn func(res *StateResource) error) (*State, error) {
+	p := &progressCounter{ctx: ctx, fn: d.progress, total: -1}
+	decode := func(res *StateResource) error {
+		if err := fn(res); err != nil {
+			return err
+		}
+		p.inc()
+		return p.check()
+	}
+	state := &State{}
+	err := d.object(func(key string) error {
+		switch key {
+		case "terraform_version":
+			return d.dec.Decode(&state.TerraformVersion)
+		case "values":
+			state.Values = &StateValues{}
+			return d.object(func(key string) error {
+				switch key {
+				case "outputs":
+					var outputs map[string]*tfjson.StateOutput
+					if err := d.dec.Decode(&outputs); err != nil {
+						return err
+					}
+					if outputs != nil {
+						state.Values.Outputs = make(map[string]*StateOutput, len(outputs))
+						for name, output := range outputs {
+							if output != nil {
+								output.Value = d.convertNumbers(output.Value)
+							}
+							state.Values.Outputs[name] = FromJSONStateOutput(output)
+						}
+					}
+					return nil
+				case "root_module":
+					if err := p.check(); err != nil {
+						return err
+					}
+					return d.module(decode)
+				default:
+					return d.skip()
+				}
+			})
+		default:
+			return d.skip()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (d *JSONStateDecoder) module(fn func(res *StateResource) error) error {
+	return d.object(func(key string) error {
+		switch key {
+		case "resources":
+			return d.array(func() error {
+				res, err := d.resource()
+				if err != nil {
+					return err
+				}
+				return fn(res)
+			})
+		case "child_modules":
+			return d.array(func() error {
+				return d.module(fn)
+			})
+		default:
+			return d.skip()
+		}
+	})
+}
+
+func (d *JSONStateDecoder) resource() (*StateResource, error) {
+	var (
+		raw tfjson.StateResource
+		// The values are decoded as they are read if the schema is already known, otherwise they are buffered.
+		values, identity       cty.Value
+		rawValues, rawIdentity json.RawMessage
+		schema                 *tfjson.Schema
+		providerSchema         *tfjson.ProviderSchema
+	)
+	lookup := func() error {
+		if schema != nil {
+			return nil
+		}
+		var err error
+		providerSchema, schema, err = lookupResourceSchema(d.schemas, raw.ProviderName, raw.Mode, raw.Type, raw.Address)
+		return err
+	}
+	known := func() bool {
+		return raw.ProviderName != "" && raw.Mode != "" && raw.Type != ""
+	}
+	err := d.object(func(key string) error {
+		switch key {
+		case "address":
+			return d.dec.Decode(&raw.Address)
+		case "mode":
+			return d.dec.Decode(&raw.Mode)
+		case "type":
+			return d.dec.Decode(&raw.Type)
+		case "name":
+			return d.dec.Decode(&raw.Name)
+		case "index":
+			if err := d.dec.Decode(&raw.Index); err != nil {
+				return err
+			}
+			raw.Index = d.convertNumbers(raw.Index)
+			return nil
+		case "provider_name":
+			return d.dec.Decode(&raw.ProviderName)
+		case "schema_version":
+			return d.dec.Decode(&raw.SchemaVersion)
+		case "sensitive_values":
+			return d.dec.Decode(&raw.SensitiveValues)
+		case "depends_on":
+			return d.dec.Decode(&raw.DependsOn)
+		case "tainted":
+			return d.dec.Decode(&raw.Tainted)
+		case "deposed_key":
+			return d.dec.Decode(&raw.DeposedKey)
+		case "identity_schema_version":
+			return d.dec.Decode(&raw.IdentitySchemaVersion)
+		case "values":
+			if !known() {
+				return d.dec.Decode(&rawValues)
+			}
+			if err := lookup(); err != nil {
+				return err
+			}
+			var err error
+			values, err = d.values(d.dec, schema.Block)
+			return err
+		case "identity":
+			if !known() {
+				return d.dec.Decode(&rawIdentity)
+			}
+			if err := lookup(); err != nil {
+				return err
+			}
+			var err error
+			identity, err = d.identity(d.dec, providerSchema, raw.Type)
+			return err
+		default:
+			return d.skip()
+		}
+	})
+	if err != nil {
+		if raw.Address != "" {
+			return nil, fmt.Errorf("resource %q: %v", raw.Address, err)
+		}
+		return nil, err
+	}
+	if err := lookup(); err != nil {
+		return nil, fmt.Errorf("resource %q: %v", raw.Address, err)
+	}
+	if rawValues != nil {
+		if values, err = d.values(d.rawDecoder(rawValues), schema.Block); err != nil {
+			return nil, fmt.Errorf("resource %q: %v", raw.Address, err)
+		}
+	}
+	if rawIdentity != nil {
+		if identity, err = d.identity(d.rawDecoder(rawIdentity), providerSchema, raw.Type); err != nil {
+			return nil, fmt.Errorf("resource %q: %v", raw.Address, err)
+		}
+	}
+
+	ret := &StateResource{
+		Address:         raw.Address,
+		Mode:            raw.Mode,
+		Type:            raw.Type,
+		Name:            raw.Name,
+		Index:           raw.Index,
+		ProviderName:    raw.ProviderName,
+		SchemaVersion:   raw.SchemaVersion,
+		SensitiveValues: raw.SensitiveValues,
+		DependsOn:       raw.DependsOn,
+		Tainted:         raw.Tainted,
+		DeposedKey:      raw.DeposedKey,
+
+		IdentitySchemaVersion: raw.IdentitySchemaVersion,
+	}
+	if values == cty.NilVal || values.IsNull() {
+		// Align with UnmarshalToCty, which results in an object of null attributes for the absent values.
+		values, _ = UnmarshalToCty(map[string]interface{}{}, jsonschema.SchemaBlockStateImpliedType(schema.Block))
+	}
+	ret.Value = values
+
+	if identitySchema, ok := providerSchema.ResourceIdentitySchemas[raw.Type]; ok && raw.Mode == tfjson.ManagedResourceMode {
+		if identity == cty.NilVal {
+			identity = cty.NullVal(jsonschema.IdentitySchemaImpliedType(identitySchema))
+		}
+		ret.Identity = identity
+	}
+	return ret, nil
+}
+
+// values decodes the resource values, with the write-only attributes removed.
+func (d *JSONStateDecoder) values(dec *json.Decoder, b *tfjson.SchemaBlock) (cty.Value, error) {
+	ty := jsonschema.SchemaBlockImpliedType(b)
+	val, err := d.value(dec, ty, nil)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("cty json unmarshal attributes: %v", wrapPathError(err))
+	}
+	if jsonschema.SchemaBlockWithoutWriteOnly(b) != b {
+		val = conformToType(val, jsonschema.SchemaBlockStateImpliedType(b))
+	}
+	return val, nil
+}
+
+func (d *JSONStateDecoder) identity(dec *json.Decoder, providerSchema *tfjson.ProviderSchema, typ string) (cty.Value, error) {
+	identitySchema, ok := providerSchema.ResourceIdentitySchemas[typ]
+	if !ok {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return cty.NilVal, err
+		}
+		if v != nil {
+			return cty.NilVal, fmt.Errorf("No resource identity type %q found in the provider schema", typ)
+		}
+		return cty.NilVal, nil
+	}
+	val, err := d.value(dec, jsonschema.IdentitySchemaImpliedType(identitySchema), nil)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("cty json unmarshal identity: %v", wrapPathError(err))
+	}
+	return val, nil
+}
+
+// value decodes the next JSON value from the tokens into a cty value of the type, following the same rules as
+// UnmarshalToCty.
+func (d *JSONStateDecoder) value(dec *json.Decoder, t cty.Type, path cty.Path) (cty.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return cty.NilVal, path.NewError(err)
+	}
+	if tok == nil {
+		return cty.NullVal(t), nil
+	}
+	if t == cty.DynamicPseudoType {
+		v, err := tokenInterface(dec, tok)
+		if err != nil {
+			return cty.NilVal, path.NewError(err)
+		}
+		_, val, err := unmarshalDynamic(d.convertNumbers(v), path)
+		return val, err
+	}
+
+	switch {
+	case t.IsPrimitiveType():
+		if _, ok := tok.(json.Delim); ok {
+			return cty.NilVal, path.NewErrorf("primitive value is required")
+		}
+		return unmarshalPrimitive(d.convertNumbers(tok), t, path)
+	case t.IsListType(), t.IsSetType(), t.IsTupleType():
+		if tok != json.Delim('[') {
+			return cty.NilVal, path.NewErrorf("expect a slice, got %v", tok)
+		}
+		var vals []cty.Value
+		for idx := 0; dec.More(); idx++ {
+			ety := cty.DynamicPseudoType
+			switch {
+			case t.IsTupleType():
+				if idx >= len(t.TupleElementTypes()) {
+					return cty.NilVal, path.NewErrorf("too many tuple elements (need %d)", len(t.TupleElementTypes()))
+				}
+				ety = t.TupleElementType(idx)
+			default:
+				ety = t.ElementType()
+			}
+			el, err := d.value(dec, ety, append(path, cty.IndexStep{Key: cty.NumberIntVal(int64(idx))}))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			vals = append(vals, el)
+		}
+		if _, err := dec.Token(); err != nil {
+			return cty.NilVal, path.NewError(err)
+		}
+		switch {
+		case t.IsTupleType():
+			if len(vals) != len(t.TupleElementTypes()) {
+				return cty.NilVal, path.NewErrorf("not enough tuple elements (need %d)", len(t.TupleElementTypes()))
+			}
+			if len(vals) == 0 {
+				return cty.EmptyTupleVal, nil
+			}
+			return cty.TupleVal(vals), nil
+		case t.IsListType():
+			if len(vals) == 0 {
+				return cty.ListValEmpty(t.ElementType()), nil
+			}
+			return cty.ListVal(vals), nil
+		default:
+			if len(vals) == 0 {
+				return cty.SetValEmpty(t.ElementType()), nil
+			}
+			return cty.SetVal(vals), nil
+		}
+	case t.IsMapType(), t.IsObjectType():
+		if tok != json.Delim('{') {
+			return cty.NilVal, path.NewErrorf("expect a map, got %v", tok)
+		}
+		vals := map[string]cty.Value{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return cty.NilVal, path.NewError(err)
+			}
+			k := keyTok.(string)
+			if t.IsMapType() {
+				el, err := d.value(dec, t.ElementType(), append(path, cty.IndexStep{Key: cty.StringVal(k)}))
+				if err != nil {
+					return cty.NilVal, err
+				}
+				vals[k] = el
+				continue
+			}
+			if !t.HasAttribute(k) {
+				return cty.NilVal, path.NewErrorf("unsupported attribute %q", k)
+			}
+			el, err := d.value(dec, t.AttributeType(k), append(path, cty.GetAttrStep{Name: k}))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			vals[k] = el
+		}
+		if _, err := dec.Token(); err != nil {
+			return cty.NilVal, path.NewError(err)
+		}
+		if t.IsMapType() {
+			if len(vals) == 0 {
+				return cty.MapValEmpty(t.ElementType()), nil
+			}
+			return cty.MapVal(vals), nil
+		}
+		for k, aty := range t.AttributeTypes() {
+			if _, exists := vals[k]; !exists {
+				vals[k] = cty.NullVal(aty)
+			}
+		}
+		if len(vals) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		return cty.ObjectVal(vals), nil
+	default:
+		return cty.NilVal, path.NewErrorf("unsupported type %s", t.FriendlyName())
+	}
+}
+
+func wrapPathError(err error) error {
+	if err, ok := err.(cty.PathError); ok {
+		return PathError{err}
+	}
+	return err
+}
+
+// convertNumbers converts the json.Number in the value to float64, unless UseJSONNumber is set.
+func (d *JSONStateDecoder) convertNumbers(v interface{}) interface{} {
+	if d.useJSONNumber {
+		return v
+	}
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = d.convertNumbers(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = d.convertNumbers(e)
+		}
+	}
+	return v
+}
+
+func (d *JSONStateDecoder) rawDecoder(b json.RawMessage) *json.Decoder {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec
+}
+
+// object reads a JSON object (or null), and calls fn for each key, which must consume the value.
+func (d *JSONStateDecoder) object(fn func(key string) error) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expect an object, got %v", tok)
+	}
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := fn(tok.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = d.dec.Token()
+	return err
+}
+
+// array reads a JSON array (or null), and calls fn for each element, which must consume the element.
+func (d *JSONStateDecoder) array(fn func() error) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expect an array, got %v", tok)
+	}
+	for d.dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	_, err = d.dec.Token()
+	return err
+}
+
+func (d *JSONStateDecoder) skip() error {
+	var v json.RawMessage
+	return d.dec.Decode(&v)
+}
+
+// tokenInterface reads the rest of the JSON value started with the token into the generic form, the same as
+// json.Unmarshal into an interface{}.
+func tokenInterface(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	switch tok {
+	case json.Delim('['):
+		l := []interface{}{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := tokenInterface(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		_, err := dec.Token()
+		return l, err
+	case json.Delim('{'):
+		m := map[string]interface{}{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := tokenInterface(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			m[key.(string)] = v
+		}
+		_, err := dec.Token()
+		return m, err
+	default:
+		return tok, nil
+	}
+}
+
+// conformToType returns the value conformed to the type, which has (nested) object types with less attributes than
+// the type of the value. The attributes absent in the type are removed.
+func conformToType(val cty.Value, ty cty.Type) cty.Value {
+	if val.Type().Equals(ty) {
+		return val
+	}
+	if val.IsNull() {
+		return cty.NullVal(ty)
+	}
+	if !val.IsKnown() {
+		return cty.UnknownVal(ty)
+	}
+	switch {
+	case ty.IsObjectType():
+		if len(ty.AttributeTypes()) == 0 {
+			return cty.EmptyObjectVal
+		}
+		vals := map[string]cty.Value{}
+		for name, aty := range ty.AttributeTypes() {
+			vals[name] = conformToType(val.GetAttr(name), aty)
+		}
+		return cty.ObjectVal(vals)
+	case ty.IsListType(), ty.IsSetType():
+		var vals []cty.Value
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			vals = append(vals, conformToType(v, ty.ElementType()))
+		}
+		switch {
+		case len(vals) == 0 && ty.IsListType():
+			return cty.ListValEmpty(ty.ElementType())
+		case len(vals) == 0:
+			return cty.SetValEmpty(ty.ElementType())
+		case ty.IsListType():
+			return cty.ListVal(vals)
+		default:
+			return cty.SetVal(vals)
+		}
+	case ty.IsMapType():
+		vals := map[string]cty.Value{}
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			vals[k.AsString()] = conformToType(v, ty.ElementType())
+		}
+		if len(vals) == 0 {
+			return cty.MapValEmpty(ty.ElementType())
+		}
+		return cty.MapVal(vals)
+	case ty.IsTupleType():
+		var vals []cty.Value
+		for i, ety := range ty.TupleElementTypes() {
+			vals = append(vals, conformToType(val.Index(cty.NumberIntVal(int64(i))), ety))
+		}
+		if len(vals) == 0 {
+			return cty.EmptyTupleVal
+		}
+		return cty.TupleVal(vals)
+	default:
+		return val
+	}
+}
@@ -0,0 +1,113 @@
+package tfstate_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestJSONStateDecoder(t *testing.T) {
+	b, err := os.ReadFile("testdata/opentofu/state.json")
+	require.NoError(t, err)
+	schemas := loadOpenTofuSchemas(t)
+
+	expect, err := tfstate.FromJSONState(loadOpenTofuJSONState(t), schemas)
+	require.NoError(t, err)
+
+	var addresses []string
+	resources := map[string]*tfstate.StateResource{}
+	state, err := tfstate.NewJSONStateDecoder(bytes.NewReader(b), schemas).Decode(func(res *tfstate.StateResource) error {
+		addresses = append(addresses, res.Address)
+		resources[res.Address] = res
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expect.TerraformVersion, state.TerraformVersion)
+	require.Equal(t, expect.Values.Outputs, state.Values.Outputs)
+	require.Nil(t, state.Values.RootModule)
+
+	expectResources := stateResources(expect)
+	require.Len(t, addresses, len(expectResources))
+	for addr, res := range expectResources {
+		require.Contains(t, resources, addr)
+		require.Equal(t, res.Index, resources[addr].Index, addr)
+		require.True(t, res.Value.RawEquals(resources[addr].Value), addr)
+		require.True(t, res.Identity.RawEquals(resources[addr].Identity), addr)
+		require.Equal(t, res.SensitiveValues, resources[addr].SensitiveValues, addr)
+		require.Equal(t, res.DependsOn, resources[addr].DependsOn, addr)
+	}
+
+	// The decoding stops at the first error returned by the callback.
+	stop := errors.New("stop")
+	var n int
+	_, err = tfstate.NewJSONStateDecoder(bytes.NewReader(b), schemas).Decode(func(res *tfstate.StateResource) error {
+		n++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, n)
+}
+
+func TestJSONStateDecoderFieldOrder(t *testing.T) {
+	// The values come before the provider name, so that they are decoded after the resource object is read.
+	input := `{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "resources": [
+        {
+          "values": {"id": "foo", "count": 1.5, "block": [{"field": "a"}]},
+          "address": "demo_resource_foo.test[\"a\"]",
+          "index": "a",
+          "mode": "managed",
+          "type": "demo_resource_foo",
+          "name": "test",
+          "provider_name": "registry.terraform.io/magodo/demo"
+        }
+      ]
+    }
+  }
+}`
+	schemas := &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/magodo/demo": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"demo_resource_foo": {
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"id":    {AttributeType: cty.String, Computed: true},
+								"count": {AttributeType: cty.Number, Optional: true},
+							},
+							NestedBlocks: map[string]*tfjson.SchemaBlockType{
+								"block": {
+									NestingMode: tfjson.SchemaNestingModeList,
+									Block: &tfjson.SchemaBlock{
+										Attributes: map[string]*tfjson.SchemaAttribute{
+											"field": {AttributeType: cty.String, Optional: true},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	var resources []*tfstate.StateResource
+	_, err := tfstate.NewJSONStateDecoder(bytes.NewReader([]byte(input)), schemas).Decode(func(res *tfstate.StateResource) error {
+		resources = append(resources, res)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Equal(t, "a", resources[0].Index)
+	require.Equal(t, "foo", resources[0].Value.GetAttr("id").AsString())
+	require.Equal(t, "1.5", resources[0].Value.GetAttr("count").AsBigFloat().String())
+}
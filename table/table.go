@@ -0,0 +1,377 @@
+// Package table flattens the state into rows, one per resource instance object, which can be written as CSV or
+// newline-delimited JSON, e.g. for the inventory or cost reporting.
+package table
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ColumnType is the type of the values of a column.
+type ColumnType string
+
+const (
+	ColumnString ColumnType = "string"
+	ColumnNumber ColumnType = "number"
+	ColumnBool   ColumnType = "bool"
+	// ColumnJSON is the type of the JSON encoded values, e.g. the collections that are not expanded.
+	ColumnJSON ColumnType = "json"
+)
+
+// NestedMode is how the collection (and object) values are flattened.
+type NestedMode int
+
+const (
+	// NestedJSON encodes the collection values as JSON, in a single column.
+	NestedJSON NestedMode = iota
+	// NestedExpand expands the collection values into a column per element (recursively), named by the path of the
+	// element. The objects are expanded by their attributes, the maps by the union of their keys among all rows, the
+	// sets by the union of their elements among all rows (as the set elements are indexed by themselves), and the
+	// lists by the indexes up to the maximum length among all rows.
+	NestedExpand
+)
+
+// Column is a column of the table.
+type Column struct {
+	// Name is the name of the column, which is the attribute path (formatted by tfstate.FormatPath) for the attribute
+	// columns.
+	Name string
+	// Path is the attribute path of the column, or nil for the fixed columns (e.g. "address").
+	Path cty.Path
+	Type ColumnType
+}
+
+// The fixed columns, which come first.
+var fixedColumns = []Column{
+	{Name: "address", Type: ColumnString},
+	{Name: "module", Type: ColumnString},
+	{Name: "mode", Type: ColumnString},
+	{Name: "type", Type: ColumnString},
+	{Name: "provider", Type: ColumnString},
+}
+
+// valuesColumnName is the column name of the empty attribute path, i.e. the whole value.
+const valuesColumnName = "values"
+
+type Options struct {
+	// Attributes are the attribute paths (in the syntax of tfstate.ParsePath, without wildcards) of the values to include,
+	// following the fixed columns. An empty path means the whole value, whose column is named "values".
+	Attributes []string
+
+	// Nested is how the collection values are flattened.
+	Nested NestedMode
+
+	// Schemas are the provider schemas, whose implied types of the resources are used to infer the column types.
+	// Without it, the types of the resource values are used instead, which are the same except for the dynamically
+	// typed attributes.
+	Schemas *tfjson.ProviderSchemas
+
+	// Filter selects the resources to include, all resources are included if it is nil.
+	Filter func(res *tfstate.StateResource) bool
+}
+
+// Table is the flattened state.
+type Table struct {
+	Columns []Column
+	// Rows are the rows of the table, each has a cell per column. A cell is nil for a null (or absent, or unknown)
+	// value, otherwise it is a string, json.Number or bool, or json.RawMessage for ColumnJSON.
+	Rows [][]interface{}
+}
+
+// New flattens the state into a table. The sensitive values are not redacted.
+//
+// The type of an attribute column is inferred from the types of the attribute in all the resources having it, which
+// must be the same primitive type, otherwise (e.g. collections that are not expanded, or conflicting types) it is
+// ColumnJSON.
+func New(state *tfstate.State, opts Options) (*Table, error) {
+	var paths []cty.Path
+	for _, attr := range opts.Attributes {
+		path, err := tfstate.ParsePath(attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute path %q: %v", attr, err)
+		}
+		paths = append(paths, path)
+	}
+
+	type row struct {
+		res  *tfstate.StateResource
+		addr tfstate.Address
+		ty   cty.Type
+	}
+	var rows []row
+	var walk func(module *tfstate.StateModule) error
+	walk = func(module *tfstate.StateModule) error {
+		if module == nil {
+			return nil
+		}
+		for _, res := range module.Resources {
+			if opts.Filter != nil && !opts.Filter(res) {
+				continue
+			}
+			addr, err := tfstate.ParseAddress(res.Address)
+			if err != nil {
+				return fmt.Errorf("resource %q: %v", res.Address, err)
+			}
+			ty := cty.DynamicPseudoType
+			if res.Value != cty.NilVal {
+				ty = res.Value.Type()
+			}
+			if opts.Schemas != nil {
+				schema, err := tfstate.LookupResourceSchema(opts.Schemas, res.ProviderName, res.Mode, res.Type)
+				if err != nil {
+					return fmt.Errorf("resource %q: %v", res.Address, err)
+				}
+				ty = jsonschema.SchemaBlockStateImpliedType(schema.Block)
+			}
+			rows = append(rows, row{res: res, addr: addr, ty: ty})
+		}
+		for _, module := range module.ChildModules {
+			if err := walk(module); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if state != nil && state.Values != nil {
+		if err := walk(state.Values.RootModule); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := &Table{Columns: append([]Column{}, fixedColumns...)}
+
+	// columns returns the columns of the path, which has the given type (the unified type among all rows).
+	var columns func(path cty.Path, ty cty.Type) []Column
+	columns = func(path cty.Path, ty cty.Type) []Column {
+		name := tfstate.FormatPath(path)
+		if name == "" {
+			name = valuesColumnName
+		}
+		switch {
+		case ty == cty.String:
+			return []Column{{Name: name, Path: path, Type: ColumnString}}
+		case ty == cty.Number:
+			return []Column{{Name: name, Path: path, Type: ColumnNumber}}
+		case ty == cty.Bool:
+			return []Column{{Name: name, Path: path, Type: ColumnBool}}
+		case opts.Nested != NestedExpand || ty == cty.DynamicPseudoType:
+			return []Column{{Name: name, Path: path, Type: ColumnJSON}}
+		}
+
+		var ret []Column
+		switch {
+		case ty.IsObjectType():
+			var names []string
+			for name := range ty.AttributeTypes() {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				ret = append(ret, columns(path.Copy().GetAttr(name), ty.AttributeType(name))...)
+			}
+		case ty.IsMapType():
+			keys := map[string]bool{}
+			for _, r := range rows {
+				val, err := tfstate.ApplyPath(r.res.Value, path)
+				if err != nil || val.IsNull() || !val.IsKnown() || !val.Type().IsMapType() {
+					continue
+				}
+				for it := val.ElementIterator(); it.Next(); {
+					k, _ := it.Element()
+					keys[k.AsString()] = true
+				}
+			}
+			var names []string
+			for k := range keys {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				ret = append(ret, columns(path.Copy().IndexString(k), ty.ElementType())...)
+			}
+		case ty.IsSetType():
+			// The sets are expanded by the union of their elements, which are the keys of the set elements.
+			var elems []cty.Value
+			for _, r := range rows {
+				val, err := tfstate.ApplyPath(r.res.Value, path)
+				if err != nil || val.IsNull() || !val.IsWhollyKnown() || !val.Type().Equals(ty) {
+					continue
+				}
+				elems = append(elems, val.AsValueSlice()...)
+			}
+			if len(elems) == 0 {
+				break
+			}
+			for it := cty.SetVal(elems).ElementIterator(); it.Next(); {
+				elem, _ := it.Element()
+				ret = append(ret, columns(path.Copy().Index(elem), ty.ElementType())...)
+			}
+		case ty.IsListType():
+			var n int
+			for _, r := range rows {
+				val, err := tfstate.ApplyPath(r.res.Value, path)
+				if err != nil || val.IsNull() || !val.IsKnown() {
+					continue
+				}
+				if l := val.LengthInt(); l > n {
+					n = l
+				}
+			}
+			for i := 0; i < n; i++ {
+				ret = append(ret, columns(path.Copy().IndexInt(i), ty.ElementType())...)
+			}
+		case ty.IsTupleType():
+			for i, ety := range ty.TupleElementTypes() {
+				ret = append(ret, columns(path.Copy().IndexInt(i), ety)...)
+			}
+		default:
+			return []Column{{Name: name, Path: path, Type: ColumnJSON}}
+		}
+		return ret
+	}
+	for _, path := range paths {
+		ty := cty.NilType
+		for _, r := range rows {
+			aty, ok := typeAtPath(r.ty, path)
+			if !ok {
+				continue
+			}
+			switch {
+			case ty == cty.NilType:
+				ty = aty
+			case !ty.Equals(aty):
+				ty = cty.DynamicPseudoType
+			}
+		}
+		if ty == cty.NilType {
+			// No resource has this attribute, the column is still kept to have a stable layout.
+			ty = cty.DynamicPseudoType
+		}
+		ret.Columns = append(ret.Columns, columns(path, ty)...)
+	}
+
+	for _, r := range rows {
+		cells := []interface{}{
+			r.res.Address,
+			r.addr.ModuleAddress(),
+			string(r.res.Mode),
+			r.res.Type,
+			r.res.ProviderName,
+		}
+		for _, col := range ret.Columns[len(fixedColumns):] {
+			cell, err := cellValue(r.res.Value, col)
+			if err != nil {
+				return nil, fmt.Errorf("resource %q: column %q: %v", r.res.Address, col.Name, err)
+			}
+			cells = append(cells, cell)
+		}
+		ret.Rows = append(ret.Rows, cells)
+	}
+	return ret, nil
+}
+
+// typeAtPath returns the type at the path of the given type, with the same leniency as tfstate.ApplyPath.
+// It returns false if the path doesn't exist in the type.
+func typeAtPath(ty cty.Type, path cty.Path) (cty.Type, bool) {
+	for _, step := range path {
+		if ty == cty.DynamicPseudoType {
+			return ty, true
+		}
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			switch {
+			case ty.IsObjectType():
+				if !ty.HasAttribute(step.Name) {
+					return cty.NilType, false
+				}
+				ty = ty.AttributeType(step.Name)
+			case ty.IsMapType():
+				ty = ty.ElementType()
+			case ty.IsListType():
+				if _, err := strconv.Atoi(step.Name); err != nil {
+					return cty.NilType, false
+				}
+				ty = ty.ElementType()
+			case ty.IsSetType():
+				// The set elements are indexed by themselves.
+				if _, err := convert.Convert(cty.StringVal(step.Name), ty.ElementType()); err != nil {
+					return cty.NilType, false
+				}
+				ty = ty.ElementType()
+			case ty.IsTupleType():
+				i, err := strconv.Atoi(step.Name)
+				if err != nil || i < 0 || i >= len(ty.TupleElementTypes()) {
+					return cty.NilType, false
+				}
+				ty = ty.TupleElementType(i)
+			default:
+				return cty.NilType, false
+			}
+		case cty.IndexStep:
+			switch {
+			case ty.IsObjectType():
+				if step.Key.Type() != cty.String || !ty.HasAttribute(step.Key.AsString()) {
+					return cty.NilType, false
+				}
+				ty = ty.AttributeType(step.Key.AsString())
+			case ty.IsMapType() && step.Key.Type() == cty.String,
+				ty.IsListType() && step.Key.Type() == cty.Number:
+				ty = ty.ElementType()
+			case ty.IsSetType():
+				if _, err := convert.Convert(step.Key, ty.ElementType()); err != nil {
+					return cty.NilType, false
+				}
+				ty = ty.ElementType()
+			case ty.IsTupleType() && step.Key.Type() == cty.Number:
+				i, _ := step.Key.AsBigFloat().Int64()
+				if i < 0 || i >= int64(len(ty.TupleElementTypes())) {
+					return cty.NilType, false
+				}
+				ty = ty.TupleElementType(int(i))
+			default:
+				return cty.NilType, false
+			}
+		}
+	}
+	return ty, true
+}
+
+// cellValue returns the cell value of the column of a resource value.
+func cellValue(val cty.Value, col Column) (interface{}, error) {
+	if val == cty.NilVal {
+		return nil, nil
+	}
+	val, err := tfstate.ApplyPath(val, col.Path)
+	if err != nil {
+		// The attribute is absent in this resource.
+		return nil, nil
+	}
+	if val.IsNull() || !val.IsWhollyKnown() {
+		return nil, nil
+	}
+	switch col.Type {
+	case ColumnString, ColumnNumber, ColumnBool:
+		switch ty := val.Type(); {
+		case ty == cty.String:
+			return val.AsString(), nil
+		case ty == cty.Number:
+			return json.Number(val.AsBigFloat().Text('f', -1)), nil
+		case ty == cty.Bool:
+			return val.True(), nil
+		}
+	}
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
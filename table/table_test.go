@@ -0,0 +1,148 @@
+package table_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate"
+	"github.com/magodo/tfstate/table"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadState(t *testing.T) (*tfstate.State, *tfjson.ProviderSchemas) {
+	b, err := os.ReadFile("../testdata/opentofu/schemas.json")
+	require.NoError(t, err)
+	var schemas tfjson.ProviderSchemas
+	require.NoError(t, json.Unmarshal(b, &schemas))
+	b, err = os.ReadFile("../testdata/opentofu/state.json")
+	require.NoError(t, err)
+	var rawState tfjson.State
+	require.NoError(t, json.Unmarshal(b, &rawState))
+	state, err := tfstate.FromJSONState(&rawState, &schemas)
+	require.NoError(t, err)
+	return state, &schemas
+}
+
+func columnTypes(tbl *table.Table) map[string]table.ColumnType {
+	ret := map[string]table.ColumnType{}
+	for _, col := range tbl.Columns {
+		ret[col.Name] = col.Type
+	}
+	return ret
+}
+
+func TestNew(t *testing.T) {
+	state, schemas := loadState(t)
+	filter := func(res *tfstate.StateResource) bool { return res.Mode == tfjson.ManagedResourceMode }
+
+	tbl, err := table.New(state, table.Options{
+		Attributes: []string{"id", "length", "special", "triggers"},
+		Schemas:    schemas,
+		Filter:     filter,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]table.ColumnType{
+		"address":   table.ColumnString,
+		"module":    table.ColumnString,
+		"mode":      table.ColumnString,
+		"type":      table.ColumnString,
+		"provider":  table.ColumnString,
+		".id":       table.ColumnString,
+		".length":   table.ColumnNumber,
+		".special":  table.ColumnBool,
+		".triggers": table.ColumnJSON,
+	}, columnTypes(tbl))
+	require.Len(t, tbl.Rows, 5)
+
+	var buf bytes.Buffer
+	require.NoError(t, tbl.WriteCSV(&buf))
+	require.Equal(t, `address,module,mode,type,provider,.id,.length,.special,.triggers
+random_password.this,,managed,random_password,registry.opentofu.org/hashicorp/random,none,12,true,
+random_pet.this,,managed,random_pet,registry.opentofu.org/hashicorp/random,sunny-toucan,2,,
+"module.app[""web""].null_resource.this[0]","module.app[""web""]",managed,null_resource,registry.opentofu.org/hashicorp/null,5577006791947779410,,,"{""pet"":""sunny-toucan""}"
+"module.app[""web""].null_resource.this[1]","module.app[""web""]",managed,null_resource,registry.opentofu.org/hashicorp/null,8674665223082153551,,,"{""pet"":""sunny-toucan""}"
+"module.app[""web""].module.db.null_resource.db","module.app[""web""].module.db",managed,null_resource,registry.opentofu.org/hashicorp/null,6129484611666145821,,,
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, tbl.WriteNDJSON(&buf))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 5)
+	require.Equal(t, `{"address":"module.app[\"web\"].null_resource.this[0]","module":"module.app[\"web\"]","mode":"managed","type":"null_resource","provider":"registry.opentofu.org/hashicorp/null",".id":"5577006791947779410",".length":null,".special":null,".triggers":{"pet":"sunny-toucan"}}`, string(lines[2]))
+}
+
+func TestNewExpand(t *testing.T) {
+	state, _ := loadState(t)
+
+	// Without the schemas, the types of the values are used.
+	tbl, err := table.New(state, table.Options{
+		Attributes: []string{"triggers", "inputs", "missing"},
+		Nested:     table.NestedExpand,
+	})
+	require.NoError(t, err)
+	var names []string
+	for _, col := range tbl.Columns {
+		names = append(names, col.Name)
+	}
+	require.Equal(t, []string{"address", "module", "mode", "type", "provider", `.triggers["pet"]`, `.inputs["env"]`, ".missing"}, names)
+	require.Equal(t, table.ColumnString, tbl.Columns[5].Type)
+	require.Equal(t, table.ColumnJSON, tbl.Columns[7].Type)
+
+	var buf bytes.Buffer
+	require.NoError(t, tbl.WriteNDJSON(&buf))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Equal(t, `{"address":"data.null_data_source.values","module":"","mode":"data","type":"null_data_source","provider":"registry.opentofu.org/hashicorp/null",".triggers[\"pet\"]":null,".inputs[\"env\"]":"test",".missing":null}`, string(lines[0]))
+
+	// The whole value.
+	tbl, err = table.New(state, table.Options{Attributes: []string{""}})
+	require.NoError(t, err)
+	require.Equal(t, "values", tbl.Columns[5].Name)
+	require.Equal(t, json.RawMessage(`{"id":"sunny-toucan","keepers":{"env":"test"},"length":2,"prefix":null,"separator":"-"}`), tbl.Rows[2][5])
+
+	_, err = table.New(state, table.Options{Attributes: []string{"a["}})
+	require.Error(t, err)
+}
+
+func TestNewExpandSet(t *testing.T) {
+	newResource := func(name string, ports ...int64) *tfstate.StateResource {
+		var vals []cty.Value
+		for _, port := range ports {
+			vals = append(vals, cty.NumberIntVal(port))
+		}
+		return &tfstate.StateResource{
+			Address: "demo." + name,
+			Mode:    tfjson.ManagedResourceMode,
+			Type:    "demo",
+			Name:    name,
+			Value:   cty.ObjectVal(map[string]cty.Value{"ports": cty.SetVal(vals)}),
+		}
+	}
+	state := &tfstate.State{
+		Values: &tfstate.StateValues{
+			RootModule: &tfstate.StateModule{
+				Resources: []*tfstate.StateResource{newResource("a", 8080, 80), newResource("b", 443)},
+			},
+		},
+	}
+
+	// The sets are expanded by their elements, the same as the set elements addressed by the paths.
+	tbl, err := table.New(state, table.Options{
+		Attributes: []string{".ports", ".ports[8080]"},
+		Nested:     table.NestedExpand,
+	})
+	require.NoError(t, err)
+	var names []string
+	for _, col := range tbl.Columns[5:] {
+		names = append(names, col.Name)
+		path, err := tfstate.ParsePath(col.Name)
+		require.NoError(t, err)
+		require.True(t, path.Equals(col.Path), col.Name)
+	}
+	require.Equal(t, []string{".ports[80]", ".ports[443]", ".ports[8080]", ".ports[8080]"}, names)
+	require.Equal(t, []interface{}{json.Number("80"), nil, json.Number("8080"), json.Number("8080")}, tbl.Rows[0][5:])
+	require.Equal(t, []interface{}{nil, json.Number("443"), nil, nil}, tbl.Rows[1][5:])
+}
@@ -0,0 +1,84 @@
+package table
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes the table as CSV, with a header row of the column names. The null cells are written as empty
+// strings, and the JSON cells as their JSON encoding.
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = col.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			switch cell := cell.(type) {
+			case nil:
+				record[i] = ""
+			case string:
+				record[i] = cell
+			case json.Number:
+				record[i] = cell.String()
+			case bool:
+				record[i] = strconv.FormatBool(cell)
+			case json.RawMessage:
+				record[i] = string(cell)
+			default:
+				return fmt.Errorf("unexpected cell type %T", cell)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteNDJSON writes the table as newline-delimited JSON, one object per row, whose keys are the column names in the
+// order of the columns. The JSON cells are embedded as is, rather than being encoded as strings.
+func (t *Table) WriteNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	keys := make([][]byte, len(t.Columns))
+	for i, col := range t.Columns {
+		b, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		keys[i] = b
+	}
+	var buf bytes.Buffer
+	for _, row := range t.Rows {
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, cell := range row {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(keys[i])
+			buf.WriteByte(':')
+			b, err := json.Marshal(cell)
+			if err != nil {
+				return fmt.Errorf("marshal cell of column %q: %v", t.Columns[i].Name, err)
+			}
+			buf.Write(b)
+		}
+		buf.WriteString("}\n")
+		if _, err := bw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
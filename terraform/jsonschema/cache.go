@@ -0,0 +1,322 @@
+package jsonschema
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultSchemaCacheSize is the default maximum number of schema blocks whose results are cached.
+const DefaultSchemaCacheSize = 4096
+
+// CacheStats is the statistics of the schema cache.
+type CacheStats struct {
+	// Hits is the number of lookups that found a cached result.
+	Hits uint64
+	// Misses is the number of lookups that found no cached result.
+	Misses uint64
+	// Evictions is the number of entries evicted for exceeding the size bound.
+	Evictions uint64
+	// Size is the current number of entries.
+	Size int
+}
+
+// schemaCache is a global LRU cache of the generated hcldec.Spec and implied type of the SchemaBlocks, keyed by the
+// hash of the block content, rather than the block pointer. So the results are shared by the equal blocks, even
+// across different loads of the provider schemas.
+//
+// The cached results are never modified, so they are safe to be shared. The cache is safe for concurrent use.
+type schemaCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ll      *list.List
+	entries map[schemaHash]*list.Element
+	stats   CacheStats
+}
+
+type schemaHash [sha256.Size]byte
+
+type schemaCacheEntry struct {
+	key         schemaHash
+	spec        hcldec.Spec
+	impliedType cty.Type
+}
+
+var decoderSpecCache = newSchemaCache(DefaultSchemaCacheSize)
+
+func newSchemaCache(size int) *schemaCache {
+	return &schemaCache{
+		maxSize: size,
+		ll:      list.New(),
+		entries: map[schemaHash]*list.Element{},
+	}
+}
+
+// SchemaCacheStats returns the statistics of the cache used by DecoderSpec and SchemaBlockImpliedType.
+func SchemaCacheStats() CacheStats {
+	return decoderSpecCache.Stats()
+}
+
+// SetSchemaCacheSize sets the maximum number of schema blocks whose results are cached by DecoderSpec and
+// SchemaBlockImpliedType, evicting the least recently used entries if needed. A non-positive size disables the cache.
+func SetSchemaCacheSize(size int) {
+	decoderSpecCache.SetSize(size)
+}
+
+// ResetSchemaCache removes all the cached entries and resets the statistics.
+func ResetSchemaCache() {
+	decoderSpecCache.Reset()
+	blockHashes.reset()
+}
+
+func (c *schemaCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	return stats
+}
+
+func (c *schemaCache) SetSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = size
+	c.evict()
+}
+
+func (c *schemaCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.entries = map[schemaHash]*list.Element{}
+	c.stats = CacheStats{}
+}
+
+// spec returns the cached Spec of the block, or nil if not found.
+func (c *schemaCache) spec(key schemaHash) hcldec.Spec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		if e := elem.Value.(*schemaCacheEntry); e.spec != nil {
+			c.ll.MoveToFront(elem)
+			c.stats.Hits++
+			return e.spec
+		}
+	}
+	c.stats.Misses++
+	return nil
+}
+
+// impliedType returns the cached implied type of the block, or cty.NilType if not found.
+func (c *schemaCache) impliedType(key schemaHash) cty.Type {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		if e := elem.Value.(*schemaCacheEntry); e.impliedType != cty.NilType {
+			c.ll.MoveToFront(elem)
+			c.stats.Hits++
+			return e.impliedType
+		}
+	}
+	c.stats.Misses++
+	return cty.NilType
+}
+
+func (c *schemaCache) setSpec(key schemaHash, spec hcldec.Spec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(key).spec = spec
+}
+
+func (c *schemaCache) setImpliedType(key schemaHash, ty cty.Type) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(key).impliedType = ty
+}
+
+// entry returns the entry of the key, which is created if not exists.
+// The caller must hold the lock.
+func (c *schemaCache) entry(key schemaHash) *schemaCacheEntry {
+	if elem, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(elem)
+		return elem.Value.(*schemaCacheEntry)
+	}
+	e := &schemaCacheEntry{key: key}
+	c.entries[key] = c.ll.PushFront(e)
+	c.evict()
+	return e
+}
+
+// evict removes the least recently used entries that exceed the size bound.
+// The caller must hold the lock.
+func (c *schemaCache) evict() {
+	for c.ll.Len() > 0 && c.ll.Len() > c.maxSize {
+		elem := c.ll.Back()
+		c.ll.Remove(elem)
+		delete(c.entries, elem.Value.(*schemaCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// maxBlockHashes is the number of the memoized block hashes, beyond which they are all dropped, so that the blocks of
+// the discarded provider schemas are not retained forever.
+const maxBlockHashes = 1 << 16
+
+// blockHashMemo memoizes the hashes of the blocks by their pointers, so that a cache hit doesn't hash the whole block
+// again. It assumes the blocks are not modified once looked up, as the provider schemas are read-only.
+type blockHashMemo struct {
+	mu     sync.Mutex
+	hashes map[*tfjson.SchemaBlock]schemaHash
+}
+
+var blockHashes = &blockHashMemo{hashes: map[*tfjson.SchemaBlock]schemaHash{}}
+
+func (m *blockHashMemo) get(b *tfjson.SchemaBlock) (schemaHash, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.hashes[b]
+	return h, ok
+}
+
+func (m *blockHashMemo) set(b *tfjson.SchemaBlock, h schemaHash) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.hashes) >= maxBlockHashes {
+		m.hashes = map[*tfjson.SchemaBlock]schemaHash{}
+	}
+	m.hashes[b] = h
+}
+
+func (m *blockHashMemo) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hashes = map[*tfjson.SchemaBlock]schemaHash{}
+}
+
+// schemaBlockHash returns the hash of the block content that affects its Spec and implied type, which excludes
+// the descriptions and deprecation. The hashes are memoized per block, including the nested ones.
+func schemaBlockHash(b *tfjson.SchemaBlock) schemaHash {
+	if b == nil {
+		return computeSchemaBlockHash(b)
+	}
+	if ret, ok := blockHashes.get(b); ok {
+		return ret
+	}
+	ret := computeSchemaBlockHash(b)
+	blockHashes.set(b, ret)
+	return ret
+}
+
+func computeSchemaBlockHash(b *tfjson.SchemaBlock) schemaHash {
+	h := sha256.New()
+	hashSchemaBlock(h, b)
+	var ret schemaHash
+	h.Sum(ret[:0])
+	return ret
+}
+
+func hashSchemaBlock(h hash.Hash, b *tfjson.SchemaBlock) {
+	if b == nil {
+		hashString(h, "nil")
+		return
+	}
+	hashString(h, "block")
+	hashUint(h, uint64(len(b.Attributes)))
+	for _, name := range sortedMapKeys(b.Attributes) {
+		hashString(h, name)
+		hashSchemaAttribute(h, b.Attributes[name])
+	}
+	hashUint(h, uint64(len(b.NestedBlocks)))
+	for _, name := range sortedMapKeys(b.NestedBlocks) {
+		nb := b.NestedBlocks[name]
+		hashString(h, name)
+		if nb == nil {
+			hashString(h, "nil")
+			continue
+		}
+		hashString(h, string(nb.NestingMode))
+		hashUint(h, nb.MinItems)
+		hashUint(h, nb.MaxItems)
+		// The nested block is hashed on its own, so that its memoized hash is reused, e.g. by DecoderSpec recursing
+		// into it.
+		nh := schemaBlockHash(nb.Block)
+		h.Write(nh[:])
+	}
+}
+
+func hashSchemaAttribute(h hash.Hash, a *tfjson.SchemaAttribute) {
+	if a == nil {
+		hashString(h, "nil")
+		return
+	}
+	hashString(h, "attribute")
+	hashType(h, a.AttributeType)
+	hashBools(h, a.Required, a.Optional, a.Computed, a.Sensitive, a.WriteOnly)
+	hashSchemaNestedAttributeType(h, a.AttributeNestedType)
+}
+
+func hashSchemaNestedAttributeType(h hash.Hash, o *tfjson.SchemaNestedAttributeType) {
+	if o == nil {
+		hashString(h, "nil")
+		return
+	}
+	hashString(h, string(o.NestingMode))
+	hashUint(h, o.MinItems)
+	hashUint(h, o.MaxItems)
+	hashUint(h, uint64(len(o.Attributes)))
+	for _, name := range sortedMapKeys(o.Attributes) {
+		hashString(h, name)
+		hashSchemaAttribute(h, o.Attributes[name])
+	}
+}
+
+func hashType(h hash.Hash, ty cty.Type) {
+	if ty == cty.NilType {
+		hashString(h, "nil")
+		return
+	}
+	// The JSON form of a type is canonical, where the object attributes are sorted.
+	b, err := ty.MarshalJSON()
+	if err != nil {
+		// Capsule types can't be marshaled, which should never appear in the provider schemas.
+		b = []byte(ty.GoString())
+	}
+	hashString(h, string(b))
+}
+
+func hashString(h hash.Hash, s string) {
+	hashUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func hashUint(h hash.Hash, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	h.Write(b[:])
+}
+
+func hashBools(h hash.Hash, bs ...bool) {
+	var v uint64
+	for i, b := range bs {
+		if b {
+			v |= 1 << i
+		}
+	}
+	hashUint(h, v)
+}
+
+func sortedMapKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
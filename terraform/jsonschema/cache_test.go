@@ -0,0 +1,176 @@
+package jsonschema
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty-debug/ctydebug"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSchemaBlockHash(t *testing.T) {
+	newBlock := func() *tfjson.SchemaBlock {
+		return &tfjson.SchemaBlock{
+			Attributes: map[string]*tfjson.SchemaAttribute{
+				"name": {AttributeType: cty.String, Required: true, Description: "The name."},
+				"tags": {AttributeType: cty.Map(cty.String), Optional: true},
+			},
+			NestedBlocks: map[string]*tfjson.SchemaBlockType{
+				"list": {
+					NestingMode: tfjson.SchemaNestingModeList,
+					Block: &tfjson.SchemaBlock{
+						Attributes: map[string]*tfjson.SchemaAttribute{
+							"field": {AttributeType: cty.Number, Optional: true},
+						},
+					},
+				},
+			},
+		}
+	}
+	base := schemaBlockHash(newBlock())
+
+	tests := map[string]struct {
+		modify func(b *tfjson.SchemaBlock)
+		equal  bool
+	}{
+		"same content": {
+			modify: func(b *tfjson.SchemaBlock) {},
+			equal:  true,
+		},
+		"description": {
+			modify: func(b *tfjson.SchemaBlock) { b.Attributes["name"].Description = "Another name." },
+			equal:  true,
+		},
+		"attribute type": {
+			modify: func(b *tfjson.SchemaBlock) { b.Attributes["tags"].AttributeType = cty.Map(cty.Number) },
+		},
+		"attribute flag": {
+			modify: func(b *tfjson.SchemaBlock) { b.Attributes["name"].Computed = true },
+		},
+		"attribute name": {
+			modify: func(b *tfjson.SchemaBlock) {
+				b.Attributes["labels"] = b.Attributes["tags"]
+				delete(b.Attributes, "tags")
+			},
+		},
+		"nesting mode": {
+			modify: func(b *tfjson.SchemaBlock) { b.NestedBlocks["list"].NestingMode = tfjson.SchemaNestingModeSet },
+		},
+		"nested attribute": {
+			modify: func(b *tfjson.SchemaBlock) { b.NestedBlocks["list"].Block.Attributes["field"].WriteOnly = true },
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := newBlock()
+			test.modify(b)
+			if got := schemaBlockHash(b) == base; got != test.equal {
+				t.Fatalf("expect equal hash to be %t, got %t", test.equal, got)
+			}
+		})
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	defer func() {
+		SetSchemaCacheSize(DefaultSchemaCacheSize)
+		ResetSchemaCache()
+	}()
+	ResetSchemaCache()
+
+	newBlock := func(attr string) *tfjson.SchemaBlock {
+		return &tfjson.SchemaBlock{
+			Attributes: map[string]*tfjson.SchemaAttribute{
+				attr: {AttributeType: cty.String, Optional: true},
+			},
+		}
+	}
+
+	// Equal blocks of different pointers share the cached results.
+	want := cty.Object(map[string]cty.Type{"foo": cty.String})
+	for i := 0; i < 3; i++ {
+		if got := SchemaBlockImpliedType(newBlock("foo")); !got.Equals(want) {
+			t.Fatalf("wrong result: %s", cmp.Diff(want, got, ctydebug.CmpOptions))
+		}
+	}
+	stats := SchemaCacheStats()
+	// The first call misses both the implied type and the spec, the rest hit the implied type.
+	if diff := cmp.Diff(CacheStats{Hits: 2, Misses: 2, Size: 1}, stats); diff != "" {
+		t.Fatalf("wrong stats: %s", diff)
+	}
+
+	// The least recently used entries are evicted when exceeding the size bound.
+	SetSchemaCacheSize(2)
+	DecoderSpec(newBlock("bar"))
+	DecoderSpec(newBlock("foo"))
+	DecoderSpec(newBlock("baz"))
+	stats = SchemaCacheStats()
+	if stats.Size != 2 || stats.Evictions != 1 {
+		t.Fatalf("wrong stats: %#v", stats)
+	}
+	hits := stats.Hits
+	DecoderSpec(newBlock("foo"))
+	if stats = SchemaCacheStats(); stats.Hits != hits+1 {
+		t.Fatalf("expect foo to be cached: %#v", stats)
+	}
+	DecoderSpec(newBlock("bar"))
+	if stats = SchemaCacheStats(); stats.Hits != hits+1 {
+		t.Fatalf("expect bar to be evicted: %#v", stats)
+	}
+
+	// A non-positive size disables the cache.
+	SetSchemaCacheSize(0)
+	DecoderSpec(newBlock("foo"))
+	if stats = SchemaCacheStats(); stats.Size != 0 {
+		t.Fatalf("expect no entry: %#v", stats)
+	}
+}
+
+// benchmarkBlock returns a block of 200 attributes and 20 nested blocks, each of which has 20 attributes.
+func benchmarkBlock() *tfjson.SchemaBlock {
+	newAttrs := func(n int) map[string]*tfjson.SchemaAttribute {
+		attrs := map[string]*tfjson.SchemaAttribute{}
+		for i := 0; i < n; i++ {
+			attrs[fmt.Sprintf("attr_%d", i)] = &tfjson.SchemaAttribute{
+				AttributeType: cty.Map(cty.List(cty.String)),
+				Optional:      true,
+			}
+		}
+		return attrs
+	}
+	b := &tfjson.SchemaBlock{
+		Attributes:   newAttrs(200),
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{},
+	}
+	for i := 0; i < 20; i++ {
+		b.NestedBlocks[fmt.Sprintf("block_%d", i)] = &tfjson.SchemaBlockType{
+			NestingMode: tfjson.SchemaNestingModeList,
+			Block:       &tfjson.SchemaBlock{Attributes: newAttrs(20)},
+		}
+	}
+	return b
+}
+
+func BenchmarkDecoderSpec(b *testing.B) {
+	defer ResetSchemaCache()
+	block := benchmarkBlock()
+
+	b.Run("hit", func(b *testing.B) {
+		ResetSchemaCache()
+		DecoderSpec(block)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			DecoderSpec(block)
+		}
+	})
+	b.Run("miss", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			ResetSchemaCache()
+			b.StartTimer()
+			DecoderSpec(block)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package jsonschema
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DecodeBody decodes the given HCL body (e.g. the body of a resource block in a .tf file) using the
+// decoder spec of the given schema block. The resulting value conforms to SchemaBlockImpliedType(b),
+// which makes it comparable to the value of a resource in the state.
+//
+// The ctx is used to evaluate the expressions inside the body. It can be nil, in which case any
+// reference to variables or functions results in error diagnostics.
+func DecodeBody(body hcl.Body, b *tfjson.SchemaBlock, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	return hcldec.Decode(body, DecoderSpec(b), ctx)
+}
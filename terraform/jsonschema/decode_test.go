@@ -0,0 +1,125 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty-debug/ctydebug"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDecodeBody(t *testing.T) {
+	schema := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"id": {
+				AttributeType: cty.String,
+				Computed:      true,
+			},
+			"name": {
+				AttributeType: cty.String,
+				Required:      true,
+			},
+			"tags": {
+				AttributeType: cty.Map(cty.String),
+				Optional:      true,
+			},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"rule": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block: &tfjson.SchemaBlock{
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"port": {
+							AttributeType: cty.Number,
+							Required:      true,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		Config    string
+		Ctx       *hcl.EvalContext
+		Want      cty.Value
+		DiagCount int
+	}{
+		"literal": {
+			Config: `
+name = "foo"
+tags = {
+  env = "test"
+}
+rule {
+  port = 80
+}
+rule {
+  port = 443
+}
+`,
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":   cty.NullVal(cty.String),
+				"name": cty.StringVal("foo"),
+				"tags": cty.MapVal(map[string]cty.Value{
+					"env": cty.StringVal("test"),
+				}),
+				"rule": cty.ListVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)}),
+					cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(443)}),
+				}),
+			}),
+		},
+		"variable": {
+			Config: `name = var.name`,
+			Ctx: &hcl.EvalContext{
+				Variables: map[string]cty.Value{
+					"var": cty.ObjectVal(map[string]cty.Value{
+						"name": cty.StringVal("foo"),
+					}),
+				},
+			},
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":   cty.NullVal(cty.String),
+				"name": cty.StringVal("foo"),
+				"tags": cty.NullVal(cty.Map(cty.String)),
+				"rule": cty.ListValEmpty(cty.Object(map[string]cty.Type{"port": cty.Number})),
+			}),
+		},
+		"variable without context": {
+			Config: `name = var.name`,
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":   cty.NullVal(cty.String),
+				"name": cty.UnknownVal(cty.String),
+				"tags": cty.NullVal(cty.Map(cty.String)),
+				"rule": cty.ListValEmpty(cty.Object(map[string]cty.Type{"port": cty.Number})),
+			}),
+			DiagCount: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "test.tf", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("parsing config: %s", diags.Error())
+			}
+			got, diags := DecodeBody(f.Body, schema, test.Ctx)
+			if len(diags) != test.DiagCount {
+				t.Errorf("wrong number of diagnostics %d; want %d", len(diags), test.DiagCount)
+				for _, diag := range diags {
+					t.Logf("- %s", diag.Error())
+				}
+			}
+			if test.DiagCount == 0 && !got.Type().Equals(SchemaBlockImpliedType(schema)) {
+				t.Errorf("wrong type\ngot:  %#v\nwant: %#v", got.Type(), SchemaBlockImpliedType(schema))
+			}
+			if diff := cmp.Diff(test.Want, got, ctydebug.CmpOptions); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+		})
+	}
+}
@@ -3,10 +3,6 @@
 package jsonschema
 
 import (
-	"runtime"
-	"sync"
-	"unsafe"
-
 	"github.com/hashicorp/hcl/v2/hcldec"
 	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/zclconf/go-cty/cty"
@@ -14,65 +10,6 @@ import (
 
 var mapLabelNames = []string{"key"}
 
-// specCache is a global cache of all the generated hcldec.Spec values for
-// Blocks. This cache is used by the DecoderSpec function to memoize calls
-// and prevent unnecessary regeneration of the spec, especially when they are
-// large and deeply nested.
-// Caching these externally rather than within the struct is required because
-// Blocks are used by value and copied when working with NestedBlocks, and the
-// copying of the value prevents any safe synchronisation of the struct itself.
-//
-// While we are using the *SchemaBlock pointer as the cache key, and the SchemaBlock
-// contents are mutable, once a SchemaBlock is created it is treated as immutable for
-// the duration of its life. Because a SchemaBlock is a representation of a logical
-// schema, which cannot change while it's being used, any modifications to the
-// schema during execution would be an error.
-type specCache struct {
-	sync.Mutex
-	specs map[uintptr]hcldec.Spec
-}
-
-var decoderSpecCache = specCache{
-	specs: map[uintptr]hcldec.Spec{},
-}
-
-// get returns the Spec associated with the given SchemaBlock, or nil if non is
-// found.
-func (s *specCache) get(b *tfjson.SchemaBlock) hcldec.Spec {
-	s.Lock()
-	defer s.Unlock()
-	k := uintptr(unsafe.Pointer(b))
-	return s.specs[k]
-}
-
-// set stores the given Spec as being the result of b.DecoderSpec().
-func (s *specCache) set(b *tfjson.SchemaBlock, spec hcldec.Spec) {
-	s.Lock()
-	defer s.Unlock()
-
-	// the uintptr value gets us a unique identifier for each block, without
-	// tying this to the block value itself.
-	k := uintptr(unsafe.Pointer(b))
-	if _, ok := s.specs[k]; ok {
-		return
-	}
-
-	s.specs[k] = spec
-
-	// This must use a finalizer tied to the SchemaBlock, otherwise we'll continue to
-	// build up Spec values as the Blocks are recycled.
-	runtime.SetFinalizer(b, s.delete)
-}
-
-// delete removes the spec associated with the given SchemaBlock.
-func (s *specCache) delete(b *tfjson.SchemaBlock) {
-	s.Lock()
-	defer s.Unlock()
-
-	k := uintptr(unsafe.Pointer(b))
-	delete(s.specs, k)
-}
-
 // DecoderSpec returns a hcldec.Spec that can be used to decode a HCL body using the facilities in the hcldec package.
 func DecoderSpec(b *tfjson.SchemaBlock) hcldec.Spec {
 	ret := hcldec.ObjectSpec{}
@@ -80,7 +17,8 @@ func DecoderSpec(b *tfjson.SchemaBlock) hcldec.Spec {
 		return ret
 	}
 
-	if spec := decoderSpecCache.get(b); spec != nil {
+	key := schemaBlockHash(b)
+	if spec := decoderSpecCache.spec(key); spec != nil {
 		return spec
 	}
 
@@ -174,7 +112,7 @@ func DecoderSpec(b *tfjson.SchemaBlock) hcldec.Spec {
 		}
 	}
 
-	decoderSpecCache.set(b, ret)
+	decoderSpecCache.setSpec(key, ret)
 	return ret
 }
 
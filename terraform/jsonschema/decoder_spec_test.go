@@ -1,7 +1,9 @@
 package jsonschema
 
 import (
+	"fmt"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -932,3 +934,68 @@ func TestListOptionalAttrsFromSchemaNestedAttributeType(t *testing.T) {
 		}
 	}
 }
+
+// TestDecoderSpecConcurrent ensures the decoderSpecCache is safe for concurrent access, which should be run with
+// the race detector (go test -race).
+func TestDecoderSpecConcurrent(t *testing.T) {
+	newBlock := func() *tfjson.SchemaBlock {
+		return &tfjson.SchemaBlock{
+			Attributes: map[string]*tfjson.SchemaAttribute{
+				"name": {AttributeType: cty.String, Required: true},
+				"tags": {AttributeType: cty.Map(cty.String), Optional: true},
+			},
+			NestedBlocks: map[string]*tfjson.SchemaBlockType{
+				"list": {
+					NestingMode: tfjson.SchemaNestingModeList,
+					Block: &tfjson.SchemaBlock{
+						Attributes: map[string]*tfjson.SchemaAttribute{
+							"field": {AttributeType: cty.Number, Optional: true},
+						},
+					},
+				},
+			},
+		}
+	}
+	want := cty.Object(map[string]cty.Type{
+		"name": cty.String,
+		"tags": cty.Map(cty.String),
+		"list": cty.List(cty.Object(map[string]cty.Type{
+			"field": cty.Number,
+		})),
+	})
+
+	shared := newBlock()
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// Mix the lookups of a shared block with the ones of fresh (but equal) blocks, and resize the cache
+				// along the way, so that the cache entries are concurrently read, written and evicted.
+				b := shared
+				if j%2 == 0 {
+					b = newBlock()
+				}
+				if got := hcldec.ImpliedType(DecoderSpec(b)); !got.Equals(want) {
+					errs <- fmt.Sprintf("wrong spec type: %s", cmp.Diff(want, got, ctydebug.CmpOptions))
+					return
+				}
+				if got := SchemaBlockImpliedType(b); !got.Equals(want) {
+					errs <- fmt.Sprintf("wrong implied type: %s", cmp.Diff(want, got, ctydebug.CmpOptions))
+					return
+				}
+				if i%16 == 0 && j%10 == 0 {
+					SetSchemaCacheSize(j % 3)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	SetSchemaCacheSize(DefaultSchemaCacheSize)
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -11,7 +11,16 @@ import (
 // SchemaBlockImpliedType returns the cty.Type that would result from decoding a
 // configuration block using the receiving block schema.
 func SchemaBlockImpliedType(b *tfjson.SchemaBlock) cty.Type {
-	return schemaBlockSpecType(b).WithoutOptionalAttributesDeep()
+	if b == nil {
+		return cty.EmptyObject
+	}
+	key := schemaBlockHash(b)
+	if ty := decoderSpecCache.impliedType(key); ty != cty.NilType {
+		return ty
+	}
+	ty := schemaBlockSpecType(b).WithoutOptionalAttributesDeep()
+	decoderSpecCache.setImpliedType(key, ty)
+	return ty
 }
 
 func schemaBlockSpecType(b *tfjson.SchemaBlock) cty.Type {
@@ -70,3 +79,97 @@ func SchemaAttributeImpliedType(o *tfjson.SchemaAttribute) cty.Type {
 	}
 	return o.AttributeType
 }
+
+// SchemaBlockStateImpliedType returns the cty.Type of the value that is persisted in the state for the
+// receiving block schema. It differs from SchemaBlockImpliedType in that the write-only attributes are
+// excluded, as they are never persisted.
+func SchemaBlockStateImpliedType(b *tfjson.SchemaBlock) cty.Type {
+	return SchemaBlockImpliedType(SchemaBlockWithoutWriteOnly(b))
+}
+
+// SchemaBlockWithoutWriteOnly returns a copy of the receiving block schema with all the write-only
+// attributes removed, including those inside nested blocks and nested attribute types.
+// The block itself is returned if it contains no write-only attribute.
+func SchemaBlockWithoutWriteOnly(b *tfjson.SchemaBlock) *tfjson.SchemaBlock {
+	if !schemaBlockHasWriteOnly(b) {
+		return b
+	}
+
+	ret := *b
+	ret.Attributes = make(map[string]*tfjson.SchemaAttribute, len(b.Attributes))
+	for name, attrS := range b.Attributes {
+		if attrS.WriteOnly {
+			continue
+		}
+		ret.Attributes[name] = schemaAttributeWithoutWriteOnly(attrS)
+	}
+	ret.NestedBlocks = make(map[string]*tfjson.SchemaBlockType, len(b.NestedBlocks))
+	for name, blockS := range b.NestedBlocks {
+		nb := *blockS
+		nb.Block = SchemaBlockWithoutWriteOnly(blockS.Block)
+		ret.NestedBlocks[name] = &nb
+	}
+	return &ret
+}
+
+func schemaAttributeWithoutWriteOnly(a *tfjson.SchemaAttribute) *tfjson.SchemaAttribute {
+	if a.AttributeNestedType == nil || !schemaNestedAttributeTypeHasWriteOnly(a.AttributeNestedType) {
+		return a
+	}
+	ret := *a
+	nt := *a.AttributeNestedType
+	nt.Attributes = make(map[string]*tfjson.SchemaAttribute, len(a.AttributeNestedType.Attributes))
+	for name, attrS := range a.AttributeNestedType.Attributes {
+		if attrS.WriteOnly {
+			continue
+		}
+		nt.Attributes[name] = schemaAttributeWithoutWriteOnly(attrS)
+	}
+	ret.AttributeNestedType = &nt
+	return &ret
+}
+
+func schemaBlockHasWriteOnly(b *tfjson.SchemaBlock) bool {
+	if b == nil {
+		return false
+	}
+	for _, attrS := range b.Attributes {
+		if attrS.WriteOnly {
+			return true
+		}
+		if attrS.AttributeNestedType != nil && schemaNestedAttributeTypeHasWriteOnly(attrS.AttributeNestedType) {
+			return true
+		}
+	}
+	for _, blockS := range b.NestedBlocks {
+		if schemaBlockHasWriteOnly(blockS.Block) {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaNestedAttributeTypeHasWriteOnly(o *tfjson.SchemaNestedAttributeType) bool {
+	for _, attrS := range o.Attributes {
+		if attrS.WriteOnly {
+			return true
+		}
+		if attrS.AttributeNestedType != nil && schemaNestedAttributeTypeHasWriteOnly(attrS.AttributeNestedType) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentitySchemaImpliedType returns the cty.Type of the resource identity described by the
+// receiving identity schema.
+func IdentitySchemaImpliedType(s *tfjson.IdentitySchema) cty.Type {
+	if s == nil {
+		return cty.EmptyObject
+	}
+	attrTys := make(map[string]cty.Type, len(s.Attributes))
+	for name, attrS := range s.Attributes {
+		attrTys[name] = attrS.IdentityType
+	}
+	return cty.Object(attrTys)
+}
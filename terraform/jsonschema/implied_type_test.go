@@ -446,3 +446,150 @@ func TestSchemaNestedAttributeTypeSpecType(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaBlockStateImpliedType(t *testing.T) {
+	tests := map[string]struct {
+		Schema *tfjson.SchemaBlock
+		Want   cty.Type
+	}{
+		"nil": {
+			nil,
+			cty.EmptyObject,
+		},
+		"no write-only": {
+			&tfjson.SchemaBlock{
+				Attributes: map[string]*tfjson.SchemaAttribute{
+					"name": {
+						AttributeType: cty.String,
+						Required:      true,
+					},
+				},
+			},
+			cty.Object(map[string]cty.Type{
+				"name": cty.String,
+			}),
+		},
+		"write-only": {
+			&tfjson.SchemaBlock{
+				Attributes: map[string]*tfjson.SchemaAttribute{
+					"name": {
+						AttributeType: cty.String,
+						Required:      true,
+					},
+					"password": {
+						AttributeType: cty.String,
+						Optional:      true,
+						WriteOnly:     true,
+					},
+					"nested": {
+						AttributeNestedType: &tfjson.SchemaNestedAttributeType{
+							NestingMode: tfjson.SchemaNestingModeSingle,
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"foo": {
+									AttributeType: cty.String,
+									Optional:      true,
+								},
+								"secret": {
+									AttributeType: cty.String,
+									Optional:      true,
+									WriteOnly:     true,
+								},
+							},
+						},
+						Optional: true,
+					},
+				},
+				NestedBlocks: map[string]*tfjson.SchemaBlockType{
+					"list": {
+						NestingMode: tfjson.SchemaNestingModeList,
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"foo": {
+									AttributeType: cty.String,
+									Optional:      true,
+								},
+								"secret": {
+									AttributeType: cty.String,
+									Optional:      true,
+									WriteOnly:     true,
+								},
+							},
+						},
+					},
+				},
+			},
+			cty.Object(map[string]cty.Type{
+				"name": cty.String,
+				"nested": cty.Object(map[string]cty.Type{
+					"foo": cty.String,
+				}),
+				"list": cty.List(cty.Object(map[string]cty.Type{
+					"foo": cty.String,
+				})),
+			}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := SchemaBlockStateImpliedType(test.Schema)
+			if !got.Equals(test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestSchemaBlockWithoutWriteOnlyUnchanged(t *testing.T) {
+	b := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name": {
+				AttributeType: cty.String,
+				Required:      true,
+			},
+		},
+	}
+	if got := SchemaBlockWithoutWriteOnly(b); got != b {
+		t.Errorf("expect the same block to be returned")
+	}
+}
+
+func TestIdentitySchemaImpliedType(t *testing.T) {
+	tests := map[string]struct {
+		Schema *tfjson.IdentitySchema
+		Want   cty.Type
+	}{
+		"nil": {
+			nil,
+			cty.EmptyObject,
+		},
+		"attributes": {
+			&tfjson.IdentitySchema{
+				Version: 1,
+				Attributes: map[string]*tfjson.IdentityAttribute{
+					"id": {
+						IdentityType:      cty.String,
+						RequiredForImport: true,
+					},
+					"tags": {
+						IdentityType:      cty.List(cty.String),
+						OptionalForImport: true,
+					},
+				},
+			},
+			cty.Object(map[string]cty.Type{
+				"id":   cty.String,
+				"tags": cty.List(cty.String),
+			}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := IdentitySchemaImpliedType(test.Schema)
+			if !got.Equals(test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
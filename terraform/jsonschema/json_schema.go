@@ -0,0 +1,232 @@
+package jsonschema
+
+import (
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// JSONSchemaDialect is the JSON Schema dialect of the documents returned by SchemaBlockJSONSchema.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is a (subset of) JSON Schema document, which is marshaled as JSON.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Description string `json:"description,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	// ReadOnly is set for the computed only attributes, that are managed by the provider.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// Type is either a string or a []string, e.g. []string{"string", "null"} for a nullable string. No type means any
+	// value.
+	Type interface{} `json:"type,omitempty"`
+
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	// AdditionalProperties is either a *JSONSchema, or false to disallow the undeclared properties.
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+
+	PrefixItems []*JSONSchema `json:"prefixItems,omitempty"`
+	// Items is either a *JSONSchema, or false to disallow the items beyond the PrefixItems.
+	Items       interface{} `json:"items,omitempty"`
+	MinItems    *uint64     `json:"minItems,omitempty"`
+	MaxItems    *uint64     `json:"maxItems,omitempty"`
+	UniqueItems bool        `json:"uniqueItems,omitempty"`
+}
+
+// SchemaBlockJSONSchema returns the JSON Schema (draft 2020-12) document of the state value of the receiving block
+// schema, i.e. the "values" of a resource in the output of `terraform show -json`. The write-only attributes are
+// excluded, as they are never persisted.
+//
+// The required attributes are required and not nullable, while the others are nullable (but still allowed to be
+// absent). The descriptions and deprecation are carried over, and the computed only attributes are marked as read
+// only. The nested blocks of the list, set and map nesting modes are arrays (or objects) with the min and max items
+// of the block, while the single nested blocks are nullable objects.
+func SchemaBlockJSONSchema(b *tfjson.SchemaBlock) *JSONSchema {
+	ret := schemaBlockJSONSchema(SchemaBlockWithoutWriteOnly(b))
+	ret.Schema = JSONSchemaDialect
+	return ret
+}
+
+func schemaBlockJSONSchema(b *tfjson.SchemaBlock) *JSONSchema {
+	ret := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		AdditionalProperties: false,
+	}
+	if b == nil {
+		return ret
+	}
+	ret.Description = b.Description
+	ret.Deprecated = b.Deprecated
+	for name, attrS := range b.Attributes {
+		ret.Properties[name] = schemaAttributeJSONSchema(attrS)
+		if attrS.Required {
+			ret.Required = append(ret.Required, name)
+		}
+	}
+	for name, blockS := range b.NestedBlocks {
+		ret.Properties[name] = schemaBlockTypeJSONSchema(blockS)
+	}
+	sort.Strings(ret.Required)
+	return ret
+}
+
+func schemaBlockTypeJSONSchema(b *tfjson.SchemaBlockType) *JSONSchema {
+	elem := schemaBlockJSONSchema(b.Block)
+	var ret *JSONSchema
+	switch b.NestingMode {
+	case tfjson.SchemaNestingModeSingle:
+		elem.Type = nullable(elem.Type)
+		return elem
+	case tfjson.SchemaNestingModeGroup:
+		// A group block is never null, its attributes are null instead.
+		return elem
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+		ret = &JSONSchema{
+			Type:        []string{"array", "null"},
+			Items:       elem,
+			UniqueItems: b.NestingMode == tfjson.SchemaNestingModeSet,
+		}
+	case tfjson.SchemaNestingModeMap:
+		ret = &JSONSchema{
+			Type:                 []string{"object", "null"},
+			AdditionalProperties: elem,
+		}
+	default:
+		return &JSONSchema{}
+	}
+	// The description of the block is put at the collection level.
+	ret.Description, elem.Description = elem.Description, ""
+	ret.Deprecated, elem.Deprecated = elem.Deprecated, false
+	if b.NestingMode != tfjson.SchemaNestingModeMap {
+		ret.MinItems = uintPtr(b.MinItems)
+		ret.MaxItems = uintPtr(b.MaxItems)
+	}
+	return ret
+}
+
+func schemaAttributeJSONSchema(a *tfjson.SchemaAttribute) *JSONSchema {
+	var ret *JSONSchema
+	if a.AttributeNestedType != nil {
+		ret = schemaNestedAttributeTypeJSONSchema(a.AttributeNestedType)
+	} else {
+		ret = typeJSONSchema(a.AttributeType)
+	}
+	if !a.Required {
+		ret.Type = nullable(ret.Type)
+	}
+	ret.Description = a.Description
+	ret.Deprecated = a.Deprecated
+	ret.ReadOnly = a.Computed && !a.Optional
+	return ret
+}
+
+func schemaNestedAttributeTypeJSONSchema(o *tfjson.SchemaNestedAttributeType) *JSONSchema {
+	elem := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		AdditionalProperties: false,
+	}
+	for name, attrS := range o.Attributes {
+		elem.Properties[name] = schemaAttributeJSONSchema(attrS)
+		if attrS.Required {
+			elem.Required = append(elem.Required, name)
+		}
+	}
+	sort.Strings(elem.Required)
+
+	var ret *JSONSchema
+	switch o.NestingMode {
+	case tfjson.SchemaNestingModeSingle:
+		return elem
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+		ret = &JSONSchema{
+			Type:        "array",
+			Items:       elem,
+			UniqueItems: o.NestingMode == tfjson.SchemaNestingModeSet,
+		}
+	case tfjson.SchemaNestingModeMap:
+		return &JSONSchema{
+			Type:                 "object",
+			AdditionalProperties: elem,
+		}
+	default:
+		return &JSONSchema{}
+	}
+	ret.MinItems = uintPtr(o.MinItems)
+	ret.MaxItems = uintPtr(o.MaxItems)
+	return ret
+}
+
+// typeJSONSchema returns the JSON Schema of the JSON encoding of the values of the cty type, whose attributes (of
+// object types) are nullable.
+func typeJSONSchema(ty cty.Type) *JSONSchema {
+	switch {
+	case ty == cty.String:
+		return &JSONSchema{Type: "string"}
+	case ty == cty.Number:
+		return &JSONSchema{Type: "number"}
+	case ty == cty.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case ty.IsListType():
+		return &JSONSchema{Type: "array", Items: typeJSONSchema(ty.ElementType())}
+	case ty.IsSetType():
+		return &JSONSchema{Type: "array", Items: typeJSONSchema(ty.ElementType()), UniqueItems: true}
+	case ty.IsMapType():
+		return &JSONSchema{Type: "object", AdditionalProperties: typeJSONSchema(ty.ElementType())}
+	case ty.IsObjectType():
+		ret := &JSONSchema{
+			Type:                 "object",
+			Properties:           map[string]*JSONSchema{},
+			AdditionalProperties: false,
+		}
+		for name, aty := range ty.AttributeTypes() {
+			s := typeJSONSchema(aty)
+			s.Type = nullable(s.Type)
+			ret.Properties[name] = s
+			if !ty.AttributeOptional(name) {
+				ret.Required = append(ret.Required, name)
+			}
+		}
+		sort.Strings(ret.Required)
+		return ret
+	case ty.IsTupleType():
+		ret := &JSONSchema{Type: "array", Items: false}
+		for _, ety := range ty.TupleElementTypes() {
+			ret.PrefixItems = append(ret.PrefixItems, typeJSONSchema(ety))
+		}
+		n := uint64(len(ret.PrefixItems))
+		ret.MinItems, ret.MaxItems = &n, &n
+		return ret
+	default:
+		// Dynamic (whose JSON encoding is arbitrary) and capsule types
+		return &JSONSchema{}
+	}
+}
+
+// nullable returns the type that additionally allows null. The empty type (i.e. any) is kept as is.
+func nullable(typ interface{}) interface{} {
+	switch typ := typ.(type) {
+	case string:
+		return []string{typ, "null"}
+	case []string:
+		for _, t := range typ {
+			if t == "null" {
+				return typ
+			}
+		}
+		return append(typ, "null")
+	default:
+		return typ
+	}
+}
+
+// uintPtr returns the pointer of n, or nil for 0 (i.e. the absence of the limit).
+func uintPtr(n uint64) *uint64 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
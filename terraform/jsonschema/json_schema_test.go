@@ -0,0 +1,183 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSchemaBlockJSONSchema(t *testing.T) {
+	tests := map[string]struct {
+		Schema *tfjson.SchemaBlock
+		Want   string
+	}{
+		"nil": {
+			nil,
+			`{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object", "additionalProperties": false}`,
+		},
+		"attributes": {
+			&tfjson.SchemaBlock{
+				Description: "A server.",
+				Attributes: map[string]*tfjson.SchemaAttribute{
+					"id":       {AttributeType: cty.String, Computed: true},
+					"name":     {AttributeType: cty.String, Required: true, Description: "The name."},
+					"password": {AttributeType: cty.String, Optional: true, WriteOnly: true},
+					"port":     {AttributeType: cty.Number, Optional: true, Computed: true, Deprecated: true},
+					"tags":     {AttributeType: cty.Map(cty.String), Optional: true},
+					"any":      {AttributeType: cty.DynamicPseudoType, Optional: true},
+					"pair":     {AttributeType: cty.Tuple([]cty.Type{cty.String, cty.Bool}), Optional: true},
+					"rules": {
+						AttributeType: cty.Set(cty.Object(map[string]cty.Type{"from": cty.Number})),
+						Required:      true,
+					},
+				},
+			},
+			`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"description": "A server.",
+	"type": "object",
+	"properties": {
+		"any": {},
+		"id": {"type": ["string", "null"], "readOnly": true},
+		"name": {"type": "string", "description": "The name."},
+		"pair": {
+			"type": ["array", "null"],
+			"prefixItems": [{"type": "string"}, {"type": "boolean"}],
+			"items": false,
+			"minItems": 2,
+			"maxItems": 2
+		},
+		"port": {"type": ["number", "null"], "deprecated": true},
+		"rules": {
+			"type": "array",
+			"uniqueItems": true,
+			"items": {
+				"type": "object",
+				"properties": {"from": {"type": ["number", "null"]}},
+				"required": ["from"],
+				"additionalProperties": false
+			}
+		},
+		"tags": {"type": ["object", "null"], "additionalProperties": {"type": "string"}}
+	},
+	"required": ["name", "rules"],
+	"additionalProperties": false
+}`,
+		},
+		"nested attributes": {
+			&tfjson.SchemaBlock{
+				Attributes: map[string]*tfjson.SchemaAttribute{
+					"disks": {
+						AttributeNestedType: &tfjson.SchemaNestedAttributeType{
+							NestingMode: tfjson.SchemaNestingModeList,
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"size":   {AttributeType: cty.Number, Required: true},
+								"secret": {AttributeType: cty.String, Optional: true, WriteOnly: true},
+							},
+							MaxItems: 4,
+						},
+						Optional: true,
+					},
+				},
+			},
+			`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"disks": {
+			"type": ["array", "null"],
+			"maxItems": 4,
+			"items": {
+				"type": "object",
+				"properties": {"size": {"type": "number"}},
+				"required": ["size"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"additionalProperties": false
+}`,
+		},
+		"blocks": {
+			&tfjson.SchemaBlock{
+				NestedBlocks: map[string]*tfjson.SchemaBlockType{
+					"rule": {
+						NestingMode: tfjson.SchemaNestingModeList,
+						Block: &tfjson.SchemaBlock{
+							Description: "A rule.",
+							Deprecated:  true,
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"port": {AttributeType: cty.Number, Required: true},
+							},
+						},
+						MinItems: 1,
+						MaxItems: 2,
+					},
+					"label": {
+						NestingMode: tfjson.SchemaNestingModeMap,
+						Block:       &tfjson.SchemaBlock{},
+					},
+					"timeouts": {
+						NestingMode: tfjson.SchemaNestingModeSingle,
+						Block: &tfjson.SchemaBlock{
+							Attributes: map[string]*tfjson.SchemaAttribute{
+								"create": {AttributeType: cty.String, Optional: true},
+							},
+						},
+					},
+				},
+			},
+			`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"label": {
+			"type": ["object", "null"],
+			"additionalProperties": {"type": "object", "additionalProperties": false}
+		},
+		"rule": {
+			"type": ["array", "null"],
+			"description": "A rule.",
+			"deprecated": true,
+			"minItems": 1,
+			"maxItems": 2,
+			"items": {
+				"type": "object",
+				"properties": {"port": {"type": "number"}},
+				"required": ["port"],
+				"additionalProperties": false
+			}
+		},
+		"timeouts": {
+			"type": ["object", "null"],
+			"properties": {"create": {"type": ["string", "null"]}},
+			"additionalProperties": false
+		}
+	},
+	"additionalProperties": false
+}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(SchemaBlockJSONSchema(test.Schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.Want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+		})
+	}
+}
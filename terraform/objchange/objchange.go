@@ -0,0 +1,575 @@
+// This is derived from github.com/hashicorp/terraform/internal/plans/objchange/objchange.go (c395d90b375e2b230384d0c213fe26a06b76222b)
+
+package objchange
+
+import (
+	"fmt"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/magodo/tfstate/terraform/jsonschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ProposedNew constructs a proposed new object value by combining the
+// computed attribute values from "prior" with the configured attribute values
+// from "config".
+//
+// Both value must conform to the given schema's implied type, or this function
+// will panic.
+//
+// The prior value must be wholly known, but the config value may be unknown
+// or have nested unknown values.
+//
+// The merging of the two objects includes the attributes of any nested blocks,
+// which will be correlated in a manner appropriate for their nesting mode.
+// Note in particular that the correlation for blocks backed by sets is a
+// heuristic based on matching non-computed attribute values and so it may
+// produce strange results with more "extreme" cases, such as a nested set
+// block where _all_ attributes are computed.
+//
+// Unlike Terraform core, which leaves this to the provider, any computed
+// attribute that ends up null (i.e. it is neither set in the config nor known
+// from the prior state) is marked as unknown, as a provider would do during
+// planning.
+func ProposedNew(schema *tfjson.SchemaBlock, prior, config cty.Value) cty.Value {
+	// If the config and prior are both null, return early here before
+	// populating the prior block. The prevents non-null blocks from appearing
+	// the proposed state value.
+	if config.IsNull() && prior.IsNull() {
+		return prior
+	}
+
+	if prior.IsNull() {
+		// In this case, we will construct a synthetic prior value that is
+		// similar to the result of decoding an empty configuration block,
+		// which simplifies our handling of the top-level attributes/blocks
+		// below by giving us one non-null level of object to pull values from.
+		//
+		// "All attributes null" happens to be the definition of EmptyValue for
+		// a Block, so we can just delegate to that
+		prior = jsonschema.SchemaBlockEmptyValue(schema)
+	}
+	return proposedNew(schema, prior, config)
+}
+
+// PlannedDataResourceObject is similar to ProposedNew but tailored for
+// planning data resources in particular. Specifically, it replaces the values
+// of any Computed attributes not set in the configuration with an unknown
+// value, which serves as a placeholder for a value to be filled in by the
+// provider when the data resource is finally read.
+//
+// Data resources are different because the planning of them is handled
+// entirely within Terraform Core and not subject to customization by the
+// provider. This function is, in effect, producing an equivalent result to
+// passing the ProposedNew result into a provider's PlanResourceChange
+// function, assuming a fixed implementation of PlanResourceChange that just
+// fills in unknown values as needed.
+func PlannedDataResourceObject(schema *tfjson.SchemaBlock, config cty.Value) cty.Value {
+	// Our trick here is to run the proposedNew logic with an
+	// entirely-unknown prior value. Because of cty's unknown short-circuit
+	// behavior, any operation on prior returns another unknown, and so
+	// unknown values propagate into all of the parts of the resulting value
+	// that would normally be filled in by preserving the prior state.
+	prior := cty.UnknownVal(jsonschema.SchemaBlockImpliedType(schema))
+	return proposedNew(schema, prior, config)
+}
+
+func proposedNew(schema *tfjson.SchemaBlock, prior, config cty.Value) cty.Value {
+	if config.IsNull() || !config.IsKnown() {
+		// A block config should never be null at this point. The only nullable
+		// block type is NestingSingle, which will return early before coming
+		// back here. We'll allow the null here anyway to free callers from
+		// needing to specifically check for these cases, and any mismatch will
+		// be caught in validation, so just take the prior value rather than
+		// the invalid null.
+		return prior
+	}
+
+	if (!prior.Type().IsObjectType()) || (!config.Type().IsObjectType()) {
+		panic("ProposedNew only supports object-typed values")
+	}
+
+	// From this point onwards, we can assume that both values are non-null
+	// object types, and that the config value itself is known (though it
+	// may contain nested values that are unknown.)
+	newAttrs := proposedNewAttributes(schema.Attributes, prior, config)
+
+	// Merging nested blocks is a little more complex, since we need to
+	// correlate blocks between both objects and then recursively propose
+	// a new object for each. The correlation logic depends on the nesting
+	// mode for each block type.
+	for name, blockType := range schema.NestedBlocks {
+		priorV := prior.GetAttr(name)
+		configV := config.GetAttr(name)
+		newAttrs[name] = proposedNewNestedBlock(blockType, priorV, configV)
+	}
+
+	return cty.ObjectVal(newAttrs)
+}
+
+func proposedNewNestedBlock(schema *tfjson.SchemaBlockType, prior, config cty.Value) cty.Value {
+	// The only time we should encounter an entirely unknown block is from the
+	// use of dynamic with an unknown for_each expression.
+	if !config.IsKnown() {
+		return config
+	}
+
+	newV := config
+
+	switch schema.NestingMode {
+	case tfjson.SchemaNestingModeSingle:
+		if !config.IsNull() {
+			newV = proposedNew(schema.Block, emptyIfNull(schema.Block, prior), config)
+		} else {
+			newV = cty.NullVal(config.Type())
+		}
+
+	case tfjson.SchemaNestingModeGroup:
+		newV = proposedNew(schema.Block, emptyIfNull(schema.Block, prior), config)
+
+	case tfjson.SchemaNestingModeList:
+		// Nested blocks are correlated by index.
+		configVLen := 0
+		if !config.IsNull() {
+			configVLen = config.LengthInt()
+		}
+		if configVLen > 0 {
+			newVals := make([]cty.Value, 0, configVLen)
+			for it := config.ElementIterator(); it.Next(); {
+				idx, configEV := it.Element()
+				if prior.IsKnown() && (prior.IsNull() || !prior.HasIndex(idx).True()) {
+					// If there is no corresponding prior element then
+					// we propose against an empty one, so that the computed
+					// attributes of the new element end up unknown.
+					newVals = append(newVals, proposedNew(schema.Block, jsonschema.SchemaBlockEmptyValue(schema.Block), configEV))
+					continue
+				}
+				priorEV := prior.Index(idx)
+
+				newEV := proposedNew(schema.Block, priorEV, configEV)
+				newVals = append(newVals, newEV)
+			}
+			// Despite the name, a NestingList might also be a tuple, if
+			// its nested schema contains dynamically-typed attributes.
+			if config.Type().IsTupleType() {
+				newV = cty.TupleVal(newVals)
+			} else {
+				newV = cty.ListVal(newVals)
+			}
+		} else {
+			// Despite the name, a NestingList might also be a tuple, if
+			// its nested schema contains dynamically-typed attributes.
+			if config.Type().IsTupleType() {
+				newV = cty.EmptyTupleVal
+			} else {
+				newV = cty.ListValEmpty(jsonschema.SchemaBlockImpliedType(schema.Block))
+			}
+		}
+
+	case tfjson.SchemaNestingModeMap:
+		// Despite the name, a NestingMap may produce either a map or
+		// object value, depending on whether the nested schema contains
+		// dynamically-typed attributes.
+		if config.Type().IsObjectType() {
+			// Nested blocks are correlated by key.
+			configVLen := 0
+			if config.IsKnown() && !config.IsNull() {
+				configVLen = config.LengthInt()
+			}
+			if configVLen > 0 {
+				newVals := make(map[string]cty.Value, configVLen)
+				atys := config.Type().AttributeTypes()
+				for name := range atys {
+					configEV := config.GetAttr(name)
+					if !prior.IsKnown() || prior.IsNull() || !prior.Type().HasAttribute(name) {
+						// If there is no corresponding prior element then
+						// we propose against an empty one, so that the computed
+						// attributes of the new element end up unknown.
+						newVals[name] = proposedNew(schema.Block, jsonschema.SchemaBlockEmptyValue(schema.Block), configEV)
+						continue
+					}
+					priorEV := prior.GetAttr(name)
+
+					newEV := proposedNew(schema.Block, priorEV, configEV)
+					newVals[name] = newEV
+				}
+				// Although we call the nesting mode "map", we actually use
+				// object values so that elements might have different types
+				// in case of dynamically-typed attributes.
+				newV = cty.ObjectVal(newVals)
+			} else {
+				newV = cty.EmptyObjectVal
+			}
+		} else {
+			configVLen := 0
+			if config.IsKnown() && !config.IsNull() {
+				configVLen = config.LengthInt()
+			}
+			if configVLen > 0 {
+				newVals := make(map[string]cty.Value, configVLen)
+				for it := config.ElementIterator(); it.Next(); {
+					idx, configEV := it.Element()
+					k := idx.AsString()
+					if prior.IsKnown() && (prior.IsNull() || !prior.HasIndex(idx).True()) {
+						// If there is no corresponding prior element then
+						// we propose against an empty one, so that the computed
+						// attributes of the new element end up unknown.
+						newVals[k] = proposedNew(schema.Block, jsonschema.SchemaBlockEmptyValue(schema.Block), configEV)
+						continue
+					}
+					priorEV := prior.Index(idx)
+
+					newEV := proposedNew(schema.Block, priorEV, configEV)
+					newVals[k] = newEV
+				}
+				newV = cty.MapVal(newVals)
+			} else {
+				newV = cty.MapValEmpty(jsonschema.SchemaBlockImpliedType(schema.Block))
+			}
+		}
+
+	case tfjson.SchemaNestingModeSet:
+		if !config.Type().IsSetType() {
+			panic("NestingSet value is not a set as expected")
+		}
+
+		// Nested blocks are correlated by comparing the element values
+		// after eliminating all of the computed attributes. In practice,
+		// this means that any config change produces an entirely new
+		// nested object, and we only propagate prior computed values
+		// if the non-computed attribute values are identical.
+		var cmpVals [][2]cty.Value
+		if prior.IsKnown() && !prior.IsNull() {
+			cmpVals = setElementCompareValues(schema.Block, prior)
+		}
+		configVLen := 0
+		if config.IsKnown() && !config.IsNull() {
+			configVLen = config.LengthInt()
+		}
+		if configVLen > 0 {
+			used := make([]bool, len(cmpVals)) // track used elements in case multiple have the same compare value
+			newVals := make([]cty.Value, 0, configVLen)
+			for it := config.ElementIterator(); it.Next(); {
+				_, configEV := it.Element()
+				var priorEV cty.Value
+				for i, cmp := range cmpVals {
+					if used[i] {
+						continue
+					}
+					if cmp[1].RawEquals(setElementCompareValue(schema.Block, configEV)) {
+						priorEV = cmp[0]
+						used[i] = true // we can't use this value on a future iteration
+						break
+					}
+				}
+				if priorEV == cty.NilVal {
+					priorEV = jsonschema.SchemaBlockEmptyValue(schema.Block)
+				}
+
+				newEV := proposedNew(schema.Block, priorEV, configEV)
+				newVals = append(newVals, newEV)
+			}
+			newV = cty.SetVal(newVals)
+		} else {
+			newV = cty.SetValEmpty(jsonschema.SchemaBlockImpliedType(schema.Block))
+		}
+
+	default:
+		// Should never happen, since the above cases are comprehensive.
+		panic(fmt.Sprintf("unsupported block nesting mode %s", schema.NestingMode))
+	}
+	return newV
+}
+
+func proposedNewAttributes(attrs map[string]*tfjson.SchemaAttribute, prior, config cty.Value) map[string]cty.Value {
+	newAttrs := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		var priorV cty.Value
+		if prior.IsNull() {
+			priorV = cty.NullVal(prior.Type().AttributeType(name))
+		} else {
+			priorV = prior.GetAttr(name)
+		}
+
+		configV := config.GetAttr(name)
+		var newV cty.Value
+		switch {
+		case attr.Computed && attr.Optional:
+			// This is the trickiest scenario: we want to keep the prior value
+			// if the config isn't overriding it. Note that due to some
+			// ambiguity here, setting an optional+computed attribute from
+			// config and then later switching the config to null in a
+			// subsequent change causes the initial config value to be "sticky"
+			// unless the provider specifically overrides it during its own
+			// plan customization step.
+			if configV.IsNull() {
+				newV = priorV
+			} else {
+				newV = configV
+			}
+		case attr.Computed:
+			// configV will always be null in this case, by definition.
+			// priorV may also be null, but that's okay.
+			newV = priorV
+		default:
+			if attr.AttributeNestedType != nil {
+				// For non-computed NestedType attributes, we need to descend
+				// into the individual nested attributes to build the final
+				// value, unless the entire nested attribute is unknown.
+				if !configV.IsKnown() {
+					newV = configV
+				} else {
+					newV = proposedNewNestedType(attr.AttributeNestedType, priorV, configV)
+				}
+			} else {
+				// For non-computed attributes, we always take the config value,
+				// even if it is null. If it's _required_ then null values
+				// should have been caught during config validation, so we will
+				// only get here if the value is optional.
+				newV = configV
+			}
+		}
+
+		// A computed attribute that is still null will be decided by the provider.
+		if attr.Computed && newV.IsNull() {
+			newV = cty.UnknownVal(newV.Type())
+		}
+
+		newAttrs[name] = newV
+	}
+	return newAttrs
+}
+
+func proposedNewNestedType(schema *tfjson.SchemaNestedAttributeType, prior, config cty.Value) cty.Value {
+	// if the config isn't known at all, then we must use that value
+	if !config.IsNull() && !config.IsKnown() {
+		return config
+	}
+
+	// Even if the config is null or empty, we will be using this default value.
+	newV := config
+
+	switch schema.NestingMode {
+	case tfjson.SchemaNestingModeSingle:
+		// If the config is null, we already have our value. If the attribute
+		// is optional+computed, we won't reach this branch with a null value
+		// since the computed case would have been taken.
+		if config.IsNull() {
+			break
+		}
+
+		newV = cty.ObjectVal(proposedNewAttributes(schema.Attributes, prior, config))
+
+	case tfjson.SchemaNestingModeList:
+		// Nested objects are correlated by index.
+		configVLen := 0
+		if !config.IsNull() {
+			configVLen = config.LengthInt()
+		}
+		if configVLen > 0 {
+			newVals := make([]cty.Value, 0, configVLen)
+			for it := config.ElementIterator(); it.Next(); {
+				idx, configEV := it.Element()
+				priorEV := cty.NullVal(configEV.Type())
+				if prior.IsKnown() && !prior.IsNull() && prior.HasIndex(idx).True() {
+					priorEV = prior.Index(idx)
+				}
+				newVals = append(newVals, cty.ObjectVal(proposedNewAttributes(schema.Attributes, priorEV, configEV)))
+			}
+			newV = cty.ListVal(newVals)
+		}
+
+	case tfjson.SchemaNestingModeMap:
+		// Nested objects are correlated by key.
+		configVLen := 0
+		if !config.IsNull() {
+			configVLen = config.LengthInt()
+		}
+		if configVLen > 0 {
+			newVals := make(map[string]cty.Value, configVLen)
+			for it := config.ElementIterator(); it.Next(); {
+				idx, configEV := it.Element()
+				priorEV := cty.NullVal(configEV.Type())
+				if prior.IsKnown() && !prior.IsNull() && prior.HasIndex(idx).True() {
+					priorEV = prior.Index(idx)
+				}
+				newVals[idx.AsString()] = cty.ObjectVal(proposedNewAttributes(schema.Attributes, priorEV, configEV))
+			}
+			newV = cty.MapVal(newVals)
+		}
+
+	case tfjson.SchemaNestingModeSet:
+		// Nested objects are correlated by comparing the element values
+		// after eliminating all of the computed attributes.
+		var priorVals []cty.Value
+		if prior.IsKnown() && !prior.IsNull() {
+			priorVals = prior.AsValueSlice()
+		}
+		configVLen := 0
+		if !config.IsNull() {
+			configVLen = config.LengthInt()
+		}
+		if configVLen > 0 {
+			used := make([]bool, len(priorVals))
+			newVals := make([]cty.Value, 0, configVLen)
+			for it := config.ElementIterator(); it.Next(); {
+				_, configEV := it.Element()
+				priorEV := cty.NullVal(configEV.Type())
+				for i, priorCandidate := range priorVals {
+					if used[i] {
+						continue
+					}
+					if nestedTypeCompareValue(schema, priorCandidate).RawEquals(nestedTypeCompareValue(schema, configEV)) {
+						priorEV = priorCandidate
+						used[i] = true
+						break
+					}
+				}
+				newVals = append(newVals, cty.ObjectVal(proposedNewAttributes(schema.Attributes, priorEV, configEV)))
+			}
+			newV = cty.SetVal(newVals)
+		}
+
+	default:
+		// Should never happen, since the above cases are comprehensive.
+		panic(fmt.Sprintf("unsupported attribute nesting mode %s", schema.NestingMode))
+	}
+
+	return newV
+}
+
+// setElementCompareValues takes a known, non-null value of a set type and
+// returns a list of pairs of the original element and its compare value, which
+// has all of the computed (including optional+computed) attributes nulled out.
+func setElementCompareValues(schema *tfjson.SchemaBlock, set cty.Value) [][2]cty.Value {
+	ret := make([][2]cty.Value, 0, set.LengthInt())
+	for it := set.ElementIterator(); it.Next(); {
+		_, ev := it.Element()
+		ret = append(ret, [2]cty.Value{ev, setElementCompareValue(schema, ev)})
+	}
+	return ret
+}
+
+// setElementCompareValue creates a new value that has all of the same
+// non-computed attribute values as the one given but has all computed
+// (including optional+computed) attribute values forced to null. This makes
+// an element from the prior state comparable to one from the config.
+//
+// The input value must conform to the schema's implied type, and the return
+// value is guaranteed to conform to it.
+func setElementCompareValue(schema *tfjson.SchemaBlock, v cty.Value) cty.Value {
+	if v.IsNull() || !v.IsKnown() {
+		return v
+	}
+
+	attrs := map[string]cty.Value{}
+	for name, attr := range schema.Attributes {
+		attrs[name] = attributeCompareValue(attr, v.GetAttr(name))
+	}
+
+	for name, blockType := range schema.NestedBlocks {
+		elementType := jsonschema.SchemaBlockImpliedType(blockType.Block)
+
+		switch blockType.NestingMode {
+		case tfjson.SchemaNestingModeSingle, tfjson.SchemaNestingModeGroup:
+			attrs[name] = setElementCompareValue(blockType.Block, v.GetAttr(name))
+
+		case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+			cv := v.GetAttr(name)
+			if cv.IsNull() || !cv.IsKnown() {
+				attrs[name] = cv
+				continue
+			}
+
+			if l := cv.LengthInt(); l > 0 {
+				elems := make([]cty.Value, 0, l)
+				for it := cv.ElementIterator(); it.Next(); {
+					_, ev := it.Element()
+					elems = append(elems, setElementCompareValue(blockType.Block, ev))
+				}
+
+				switch {
+				case blockType.NestingMode == tfjson.SchemaNestingModeSet:
+					// SetValEmpty would panic if given elements that are not
+					// all of the same type, but that's guaranteed not to
+					// happen here because our input value was _already_ a
+					// set and we've not changed the types of any elements here.
+					attrs[name] = cty.SetVal(elems)
+
+				// NestingList cases
+				case elementType.HasDynamicTypes():
+					attrs[name] = cty.TupleVal(elems)
+				default:
+					attrs[name] = cty.ListVal(elems)
+				}
+			} else {
+				switch {
+				case blockType.NestingMode == tfjson.SchemaNestingModeSet:
+					attrs[name] = cty.SetValEmpty(elementType)
+
+				// NestingList cases
+				case elementType.HasDynamicTypes():
+					attrs[name] = cty.EmptyTupleVal
+				default:
+					attrs[name] = cty.ListValEmpty(elementType)
+				}
+			}
+
+		case tfjson.SchemaNestingModeMap:
+			cv := v.GetAttr(name)
+			if cv.IsNull() || !cv.IsKnown() || cv.LengthInt() == 0 {
+				attrs[name] = cv
+				continue
+			}
+			elems := make(map[string]cty.Value)
+			for it := cv.ElementIterator(); it.Next(); {
+				kv, ev := it.Element()
+				elems[kv.AsString()] = setElementCompareValue(blockType.Block, ev)
+			}
+
+			switch {
+			case elementType.HasDynamicTypes():
+				attrs[name] = cty.ObjectVal(elems)
+			default:
+				attrs[name] = cty.MapVal(elems)
+			}
+
+		default:
+			// Should never happen, since the above cases are comprehensive.
+			panic(fmt.Sprintf("unsupported block nesting mode %s", blockType.NestingMode))
+		}
+	}
+
+	return cty.ObjectVal(attrs)
+}
+
+// nestedTypeCompareValue is the counterpart of setElementCompareValue for
+// the elements of a set-nested attribute.
+func nestedTypeCompareValue(schema *tfjson.SchemaNestedAttributeType, v cty.Value) cty.Value {
+	if v.IsNull() || !v.IsKnown() {
+		return v
+	}
+
+	attrs := map[string]cty.Value{}
+	for name, attr := range schema.Attributes {
+		attrs[name] = attributeCompareValue(attr, v.GetAttr(name))
+	}
+	return cty.ObjectVal(attrs)
+}
+
+func attributeCompareValue(attr *tfjson.SchemaAttribute, v cty.Value) cty.Value {
+	if attr.Computed {
+		return cty.NullVal(v.Type())
+	}
+	return v
+}
+
+// emptyIfNull returns the empty value of the block if the prior block value is
+// null (e.g. the block is newly added in the config), as ProposedNew does for
+// the top-level object, so that the nested blocks can be pulled from it.
+func emptyIfNull(schema *tfjson.SchemaBlock, prior cty.Value) cty.Value {
+	if prior.IsKnown() && prior.IsNull() {
+		return jsonschema.SchemaBlockEmptyValue(schema)
+	}
+	return prior
+}
@@ -0,0 +1,335 @@
+package objchange
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty-debug/ctydebug"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestProposedNew(t *testing.T) {
+	nestedBlock := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name": {
+				AttributeType: cty.String,
+				Required:      true,
+			},
+			"id": {
+				AttributeType: cty.String,
+				Computed:      true,
+			},
+		},
+	}
+	nestedType := cty.Object(map[string]cty.Type{
+		"name": cty.String,
+		"id":   cty.String,
+	})
+	schema := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"id": {
+				AttributeType: cty.String,
+				Computed:      true,
+			},
+			"name": {
+				AttributeType: cty.String,
+				Required:      true,
+			},
+			"zone": {
+				AttributeType: cty.String,
+				Optional:      true,
+				Computed:      true,
+			},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"single": {
+				NestingMode: tfjson.SchemaNestingModeSingle,
+				Block:       nestedBlock,
+			},
+			"list": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block:       nestedBlock,
+			},
+			"set": {
+				NestingMode: tfjson.SchemaNestingModeSet,
+				Block:       nestedBlock,
+			},
+			"map": {
+				NestingMode: tfjson.SchemaNestingModeMap,
+				Block:       nestedBlock,
+			},
+		},
+	}
+	nested := func(name, id cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"name": name,
+			"id":   id,
+		})
+	}
+
+	tests := map[string]struct {
+		Prior  cty.Value
+		Config cty.Value
+		Want   cty.Value
+	}{
+		"both null": {
+			Prior:  cty.NullVal(cty.DynamicPseudoType),
+			Config: cty.NullVal(cty.DynamicPseudoType),
+			Want:   cty.NullVal(cty.DynamicPseudoType),
+		},
+		"create": {
+			Prior: cty.NullVal(cty.DynamicPseudoType),
+			Config: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.NullVal(cty.String),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.NullVal(cty.String),
+				"single": nested(cty.StringVal("a"), cty.NullVal(cty.String)),
+				"list":   cty.ListVal([]cty.Value{nested(cty.StringVal("a"), cty.NullVal(cty.String))}),
+				"set":    cty.SetValEmpty(nestedType),
+				"map":    cty.MapValEmpty(nestedType),
+			}),
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.UnknownVal(cty.String),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.UnknownVal(cty.String),
+				"single": nested(cty.StringVal("a"), cty.UnknownVal(cty.String)),
+				"list":   cty.ListVal([]cty.Value{nested(cty.StringVal("a"), cty.UnknownVal(cty.String))}),
+				"set":    cty.SetValEmpty(nestedType),
+				"map":    cty.MapValEmpty(nestedType),
+			}),
+		},
+		"update": {
+			Prior: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.StringVal("1"),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.StringVal("z1"),
+				"single": nested(cty.StringVal("a"), cty.StringVal("s")),
+				"list": cty.ListVal([]cty.Value{
+					nested(cty.StringVal("a"), cty.StringVal("l0")),
+				}),
+				"set": cty.SetVal([]cty.Value{
+					nested(cty.StringVal("a"), cty.StringVal("sa")),
+					nested(cty.StringVal("b"), cty.StringVal("sb")),
+				}),
+				"map": cty.MapVal(map[string]cty.Value{
+					"k1": nested(cty.StringVal("a"), cty.StringVal("m1")),
+				}),
+			}),
+			Config: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.NullVal(cty.String),
+				"name":   cty.StringVal("bar"),
+				"zone":   cty.NullVal(cty.String),
+				"single": nested(cty.StringVal("b"), cty.NullVal(cty.String)),
+				"list": cty.ListVal([]cty.Value{
+					nested(cty.StringVal("a"), cty.NullVal(cty.String)),
+					nested(cty.StringVal("b"), cty.NullVal(cty.String)),
+				}),
+				"set": cty.SetVal([]cty.Value{
+					nested(cty.StringVal("b"), cty.NullVal(cty.String)),
+					nested(cty.StringVal("c"), cty.NullVal(cty.String)),
+				}),
+				"map": cty.MapVal(map[string]cty.Value{
+					"k1": nested(cty.StringVal("a"), cty.NullVal(cty.String)),
+					"k2": nested(cty.StringVal("b"), cty.NullVal(cty.String)),
+				}),
+			}),
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.StringVal("1"),
+				"name":   cty.StringVal("bar"),
+				"zone":   cty.StringVal("z1"),
+				"single": nested(cty.StringVal("b"), cty.StringVal("s")),
+				"list": cty.ListVal([]cty.Value{
+					nested(cty.StringVal("a"), cty.StringVal("l0")),
+					nested(cty.StringVal("b"), cty.UnknownVal(cty.String)),
+				}),
+				"set": cty.SetVal([]cty.Value{
+					nested(cty.StringVal("b"), cty.StringVal("sb")),
+					nested(cty.StringVal("c"), cty.UnknownVal(cty.String)),
+				}),
+				"map": cty.MapVal(map[string]cty.Value{
+					"k1": nested(cty.StringVal("a"), cty.StringVal("m1")),
+					"k2": nested(cty.StringVal("b"), cty.UnknownVal(cty.String)),
+				}),
+			}),
+		},
+		"optional computed overridden": {
+			Prior: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.StringVal("1"),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.StringVal("z1"),
+				"single": cty.NullVal(nestedType),
+				"list":   cty.ListValEmpty(nestedType),
+				"set":    cty.SetValEmpty(nestedType),
+				"map":    cty.MapValEmpty(nestedType),
+			}),
+			Config: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.NullVal(cty.String),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.StringVal("z2"),
+				"single": cty.NullVal(nestedType),
+				"list":   cty.ListValEmpty(nestedType),
+				"set":    cty.SetValEmpty(nestedType),
+				"map":    cty.MapValEmpty(nestedType),
+			}),
+			Want: cty.ObjectVal(map[string]cty.Value{
+				"id":     cty.StringVal("1"),
+				"name":   cty.StringVal("foo"),
+				"zone":   cty.StringVal("z2"),
+				"single": cty.NullVal(nestedType),
+				"list":   cty.ListValEmpty(nestedType),
+				"set":    cty.SetValEmpty(nestedType),
+				"map":    cty.MapValEmpty(nestedType),
+			}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ProposedNew(schema, test.Prior, test.Config)
+			if diff := cmp.Diff(test.Want, got, ctydebug.CmpOptions); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProposedNewNullPriorSingleBlock(t *testing.T) {
+	innerBlock := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name": {AttributeType: cty.String, Required: true},
+			"id":   {AttributeType: cty.String, Computed: true},
+		},
+	}
+	innerType := cty.Object(map[string]cty.Type{"name": cty.String, "id": cty.String})
+	outerBlock := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name": {AttributeType: cty.String, Optional: true},
+		},
+		NestedBlocks: map[string]*tfjson.SchemaBlockType{
+			"inner": {
+				NestingMode: tfjson.SchemaNestingModeList,
+				Block:       innerBlock,
+			},
+		},
+	}
+	outerType := cty.Object(map[string]cty.Type{"name": cty.String, "inner": cty.List(innerType)})
+
+	for _, mode := range []tfjson.SchemaNestingMode{tfjson.SchemaNestingModeSingle, tfjson.SchemaNestingModeGroup} {
+		t.Run(string(mode), func(t *testing.T) {
+			schema := &tfjson.SchemaBlock{
+				NestedBlocks: map[string]*tfjson.SchemaBlockType{
+					"outer": {
+						NestingMode: mode,
+						Block:       outerBlock,
+					},
+				},
+			}
+			// The block is newly added in the config.
+			prior := cty.ObjectVal(map[string]cty.Value{
+				"outer": cty.NullVal(outerType),
+			})
+			config := cty.ObjectVal(map[string]cty.Value{
+				"outer": cty.ObjectVal(map[string]cty.Value{
+					"name": cty.StringVal("a"),
+					"inner": cty.ListVal([]cty.Value{
+						cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("b"), "id": cty.NullVal(cty.String)}),
+					}),
+				}),
+			})
+			want := cty.ObjectVal(map[string]cty.Value{
+				"outer": cty.ObjectVal(map[string]cty.Value{
+					"name": cty.StringVal("a"),
+					"inner": cty.ListVal([]cty.Value{
+						cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("b"), "id": cty.UnknownVal(cty.String)}),
+					}),
+				}),
+			})
+			got := ProposedNew(schema, prior, config)
+			if diff := cmp.Diff(want, got, ctydebug.CmpOptions); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProposedNewNestedType(t *testing.T) {
+	schema := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"rules": {
+				AttributeNestedType: &tfjson.SchemaNestedAttributeType{
+					NestingMode: tfjson.SchemaNestingModeSet,
+					Attributes: map[string]*tfjson.SchemaAttribute{
+						"port": {
+							AttributeType: cty.Number,
+							Required:      true,
+						},
+						"id": {
+							AttributeType: cty.String,
+							Computed:      true,
+						},
+					},
+				},
+				Optional: true,
+			},
+		},
+	}
+	rule := func(port int64, id cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"port": cty.NumberIntVal(port),
+			"id":   id,
+		})
+	}
+
+	prior := cty.ObjectVal(map[string]cty.Value{
+		"rules": cty.SetVal([]cty.Value{
+			rule(80, cty.StringVal("a")),
+			rule(443, cty.StringVal("b")),
+		}),
+	})
+	config := cty.ObjectVal(map[string]cty.Value{
+		"rules": cty.SetVal([]cty.Value{
+			rule(443, cty.NullVal(cty.String)),
+			rule(8080, cty.NullVal(cty.String)),
+		}),
+	})
+	want := cty.ObjectVal(map[string]cty.Value{
+		"rules": cty.SetVal([]cty.Value{
+			rule(443, cty.StringVal("b")),
+			rule(8080, cty.UnknownVal(cty.String)),
+		}),
+	})
+
+	got := ProposedNew(schema, prior, config)
+	if diff := cmp.Diff(want, got, ctydebug.CmpOptions); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
+
+func TestPlannedDataResourceObject(t *testing.T) {
+	schema := &tfjson.SchemaBlock{
+		Attributes: map[string]*tfjson.SchemaAttribute{
+			"name": {
+				AttributeType: cty.String,
+				Required:      true,
+			},
+			"id": {
+				AttributeType: cty.String,
+				Computed:      true,
+			},
+		},
+	}
+	config := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("foo"),
+		"id":   cty.NullVal(cty.String),
+	})
+	want := cty.ObjectVal(map[string]cty.Value{
+		"name": cty.StringVal("foo"),
+		"id":   cty.UnknownVal(cty.String),
+	})
+
+	got := PlannedDataResourceObject(schema, config)
+	if diff := cmp.Diff(want, got, ctydebug.CmpOptions); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
@@ -0,0 +1,144 @@
+package tfstate
+
+import (
+	"fmt"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ToJSONState converts the State back into the tfjson.State, which is the reverse of FromJSONState.
+// This is useful to write out a state that has been modified, e.g. via Move, Remove or ReplaceProvider.
+func ToJSONState(state *State) (*tfjson.State, error) {
+	return toJSONState(state, nil)
+}
+
+func toJSONState(state *State, p *progressCounter) (*tfjson.State, error) {
+	if state == nil {
+		return nil, nil
+	}
+	ret := &tfjson.State{
+		FormatVersion:    "1.0",
+		TerraformVersion: state.TerraformVersion,
+	}
+	if state.Values == nil {
+		return ret, nil
+	}
+	ret.Values = &tfjson.StateValues{}
+	if state.Values.RootModule != nil {
+		rootModule, err := toJSONStateModule(state.Values.RootModule, p)
+		if err != nil {
+			return nil, err
+		}
+		ret.Values.RootModule = rootModule
+	}
+	if state.Values.Outputs != nil {
+		m := make(map[string]*tfjson.StateOutput, len(state.Values.Outputs))
+		for name, output := range state.Values.Outputs {
+			m[name] = ToJSONStateOutput(output)
+		}
+		ret.Values.Outputs = m
+	}
+	return ret, nil
+}
+
+func ToJSONStateModule(module *StateModule) (*tfjson.StateModule, error) {
+	return toJSONStateModule(module, nil)
+}
+
+func toJSONStateModule(module *StateModule, p *progressCounter) (*tfjson.StateModule, error) {
+	if module == nil {
+		return nil, nil
+	}
+	ret := &tfjson.StateModule{
+		Address: module.Address,
+	}
+	var err error
+	if size := len(module.Resources); size > 0 {
+		resources := make([]*tfjson.StateResource, size)
+		for i, resource := range module.Resources {
+			if err := p.check(); err != nil {
+				return nil, err
+			}
+			resources[i], err = ToJSONStateResource(resource)
+			if err != nil {
+				return nil, fmt.Errorf("converting state for resource: %v", err)
+			}
+			p.inc()
+		}
+		ret.Resources = resources
+	}
+	if size := len(module.ChildModules); size > 0 {
+		modules := make([]*tfjson.StateModule, size)
+		for i, module := range module.ChildModules {
+			modules[i], err = toJSONStateModule(module, p)
+			if err != nil {
+				if ctxErr := p.check(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				return nil, fmt.Errorf("converting state for module: %v", err)
+			}
+		}
+		ret.ChildModules = modules
+	}
+	return ret, nil
+}
+
+func ToJSONStateOutput(output *StateOutput) *tfjson.StateOutput {
+	if output == nil {
+		return nil
+	}
+	return &tfjson.StateOutput{
+		Sensitive: output.Sensitive,
+		Value:     output.Value,
+	}
+}
+
+func ToJSONStateResource(resource *StateResource) (*tfjson.StateResource, error) {
+	if resource == nil {
+		return nil, nil
+	}
+	ret := &tfjson.StateResource{
+		Address:               resource.Address,
+		Mode:                  resource.Mode,
+		Type:                  resource.Type,
+		Name:                  resource.Name,
+		Index:                 resource.Index,
+		ProviderName:          resource.ProviderName,
+		SchemaVersion:         resource.SchemaVersion,
+		SensitiveValues:       resource.SensitiveValues,
+		DependsOn:             resource.DependsOn,
+		Tainted:               resource.Tainted,
+		DeposedKey:            resource.DeposedKey,
+		IdentitySchemaVersion: resource.IdentitySchemaVersion,
+	}
+	values, err := valueToMap(resource.Value)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: %v", resource.Address, err)
+	}
+	ret.AttributeValues = values
+	identity, err := valueToMap(resource.Identity)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: identity: %v", resource.Address, err)
+	}
+	ret.IdentityValues = identity
+	return ret, nil
+}
+
+// valueToMap converts an object value into its JSON representation, as is used by the attribute values of tfjson.
+func valueToMap(val cty.Value) (map[string]interface{}, error) {
+	if val == cty.NilVal || val.IsNull() {
+		return nil, nil
+	}
+	b, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, fmt.Errorf("marshal value: %v", err)
+	}
+	var m map[string]interface{}
+	// The numbers are kept as json.Number, which would lose the precision beyond float64 otherwise.
+	if err := unmarshalUseNumber(b, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal value: %v", err)
+	}
+	return m, nil
+}